@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/supermuesli/computeshader/pkg/accel"
+	"github.com/supermuesli/computeshader/pkg/bvh"
+	"github.com/supermuesli/computeshader/pkg/grid"
+	"github.com/supermuesli/computeshader/pkg/kdtree"
+	"github.com/supermuesli/computeshader/pkg/meshutil"
+	"github.com/supermuesli/computeshader/pkg/objparser"
+)
+
+// structures are the acceleration structures that are compared
+var structures = []struct {
+	name  string
+	build func(triangles []objparser.Triangle) accel.Structure
+}{
+	{"bvh", func(t []objparser.Triangle) accel.Structure { return bvh.Build(t) }},
+	{"grid", func(t []objparser.Triangle) accel.Structure { return grid.Build(t) }},
+	{"kdtree", func(t []objparser.Triangle) accel.Structure { return kdtree.Build(t) }},
+}
+
+// accelOptions are what benchAccel reports besides the speed
+type accelOptions struct {
+	// stats prints the Stats of every structure
+	stats bool
+	// wireframe is the directory the node bounds are written to as .obj,
+	// none if empty
+	wireframe string
+	// depth is the deepest level of the wireframes, all if < 0
+	depth int
+}
+
+// benchAccel builds every structure over triangles and shoots n rays at it
+func benchAccel(model string, triangles []objparser.Triangle, n int, opts accelOptions) {
+	rays := randomRays(triangles, n)
+	for _, s := range structures {
+		start := time.Now()
+		a := s.build(triangles)
+		build := time.Since(start)
+
+		hits := 0
+		start = time.Now()
+		for _, r := range rays {
+			if _, ok := a.Intersect(r, accel.Inf); ok {
+				hits++
+			}
+		}
+		query := time.Since(start)
+
+		fmt.Printf("%-28s %-10s %8d nodes %10d bytes %12v build %12.0f rays/s %8d hits\n",
+			model, "accel/"+s.name, a.NodeCount(), accel.Size(a), build, float64(len(rays))/query.Seconds(), hits)
+
+		if opts.stats {
+			st := accel.Measure(a)
+			if err := st.Write(os.Stdout); err != nil {
+				log.Fatal(err)
+			}
+		}
+		if opts.wireframe != "" {
+			name := strings.TrimSuffix(model, filepath.Ext(model)) + "." + s.name + ".obj"
+			if err := writeWireframe(filepath.Join(opts.wireframe, name), a, opts.depth); err != nil {
+				log.Fatal(err)
+			}
+		}
+	}
+}
+
+func writeWireframe(path string, s accel.Structure, depth int) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := accel.WriteWireframe(f, s, depth); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// randomRays returns n rays from around the model to points inside it, the
+// same ones for the same triangles. A third starts inside the model.
+func randomRays(triangles []objparser.Triangle, n int) []accel.Ray {
+	bounds := meshutil.EmptyBox()
+	for _, t := range triangles {
+		for _, p := range [...]mgl32.Vec4{t.A, t.B, t.C} {
+			bounds.Grow(p.Vec3())
+		}
+	}
+	center, size := bounds.Center(), bounds.Size().Len()
+
+	r := rand.New(rand.NewSource(1))
+	point := func(scale float32) mgl32.Vec3 {
+		return center.Add(mgl32.Vec3{r.Float32() - 0.5, r.Float32() - 0.5, r.Float32() - 0.5}.Mul(scale))
+	}
+	rays := make([]accel.Ray, n)
+	for i := range rays {
+		origin := point(2 * size)
+		if i%3 == 0 {
+			origin = point(size / 2)
+		}
+		rays[i] = accel.Ray{Origin: origin, Dir: point(size / 2).Sub(origin).Normalize()}
+	}
+	return rays
+}
@@ -0,0 +1,43 @@
+package main
+
+// bench compares the acceleration structures by size and CPU rays per
+// second on the bundled models. The loaders and the bvh builder are
+// benchmarked with go test -bench in pkg/objparser and pkg/bvh.
+//
+//	go run ./cmd/bench [-models pkg/3dmodels] [-rays n] [-stats]
+//		[-wireframe dir] [-depth n]
+
+import (
+	"flag"
+	"log"
+	"path/filepath"
+
+	"github.com/supermuesli/computeshader/pkg/objparser"
+)
+
+func main() {
+	models := flag.String("models", "pkg/3dmodels", "directory with the .obj files to benchmark")
+	rays := flag.Int("rays", 100000, "rays per acceleration structure")
+	var opts accelOptions
+	flag.BoolVar(&opts.stats, "stats", false, "print the quality stats of the acceleration structures")
+	flag.StringVar(&opts.wireframe, "wireframe", "", "directory to write the node bounds of the acceleration structures to as .obj")
+	flag.IntVar(&opts.depth, "depth", -1, "deepest level of the wireframes, all if < 0")
+	flag.Parse()
+
+	paths, err := filepath.Glob(filepath.Join(*models, "*.obj"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(paths) == 0 {
+		log.Fatalf("no .obj files in %s", *models)
+	}
+
+	for _, path := range paths {
+		l := objparser.Loader{Lenient: true}
+		mesh, err := l.Load(path)
+		if err != nil {
+			log.Fatal(err)
+		}
+		benchAccel(filepath.Base(path), mesh.Triangles(), *rays, opts)
+	}
+}
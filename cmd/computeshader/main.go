@@ -10,7 +10,7 @@ import (
 	"github.com/go-gl/gl/v4.5-core/gl"
 	"github.com/go-gl/glfw/v3.2/glfw"
 	"github.com/supermuesli/computeshader/pkg/shaders"
-	"github.com/supermuesli/computeshader/pkg/objparser"
+	"github.com/supermuesli/computeshader/pkg/scene"
 	"github.com/supermuesli/computeshader/internal/shaderutils"
 	_ "github.com/inkyblackness/imgui-go"
 	"fmt"
@@ -19,11 +19,8 @@ import (
 	"runtime"
 	"unsafe"
 	"os"
-)
-
-const (
-	windowWidth = 800
-	windowHeight = 600
+	"path/filepath"
+	"reflect"
 )
 
 func init() {
@@ -32,6 +29,37 @@ func init() {
 }
 
 func main() {
+	cwd, err := os.Getwd()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// a scene description or any model file format scene knows, e.g.
+	// go run cmd/computeshader/main.go model.glb
+	modelPath := cwd + "/pkg/3dmodels/" + "CornellBox-Original.obj"
+	if len(os.Args) > 1 {
+		modelPath = os.Args[1]
+	}
+
+	loader := scene.Loader{Lenient: true}
+	// reuse the parsed model on the next start, unless it changed
+	if dir, err := os.UserCacheDir(); err == nil {
+		loader.CacheDir = filepath.Join(dir, "computeshader")
+		if err := os.MkdirAll(loader.CacheDir, 0755); err != nil {
+			loader.CacheDir = ""
+		}
+	}
+	// every mesh uploaded once and the instances placing them, straight
+	// from the mapped cache file if it is up to date
+	sc, instanced, err := loader.LoadInstanced(modelPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer instanced.Close()
+	for _, w := range sc.Warnings() {
+		fmt.Println("warning:", w)
+	}
+
 	if err := glfw.Init(); err != nil {
 		log.Fatalln("failed to initialize glfw:", err)
 	}
@@ -42,7 +70,7 @@ func main() {
 	glfw.WindowHint(glfw.ContextVersionMinor, 5)
 	glfw.WindowHint(glfw.OpenGLProfile, glfw.OpenGLCoreProfile)
 	glfw.WindowHint(glfw.OpenGLForwardCompatible, glfw.True)
-	window, err := glfw.CreateWindow(windowWidth, windowHeight, "compute shady boi", nil, nil)
+	window, err := glfw.CreateWindow(sc.Settings.Width, sc.Settings.Height, "compute shady boi", nil, nil)
 	if err != nil {
 		panic(err)
 	}
@@ -110,7 +138,7 @@ func main() {
 	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_T, gl.CLAMP_TO_EDGE)
 	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.LINEAR)
 	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.LINEAR)
-	gl.TexImage2D(gl.TEXTURE_2D, 0, gl.RGBA32F, windowWidth, windowHeight, 0, gl.RGBA, gl.FLOAT, nil)
+	gl.TexImage2D(gl.TEXTURE_2D, 0, gl.RGBA32F, int32(sc.Settings.Width), int32(sc.Settings.Height), 0, gl.RGBA, gl.FLOAT, nil)
 	
 	// define quad vao
 	var quadVao uint32
@@ -126,19 +154,14 @@ func main() {
 	gl.EnableVertexAttribArray(0)
 	gl.VertexAttribPointer(0, 2, gl.BYTE, false, 0, nil)
 
-	cwd, err := os.Getwd()
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	// define 3d model vertices ssbo
-	var modelSSBO uint32
-	gl.GenBuffers(1, &modelSSBO)
-	gl.BindBuffer(gl.SHADER_STORAGE_BUFFER, modelSSBO)
-	triangles := objparser.GetTriangles(cwd + "/pkg/3dmodels/" + "CornellBox-Original.obj")
-	// bound to binding point 3
-	gl.BindBufferBase(gl.SHADER_STORAGE_BUFFER, 3, modelSSBO)
-	gl.BufferData(gl.SHADER_STORAGE_BUFFER, (len(triangles)+1)*5*4*4, unsafe.Pointer(&triangles[0]), gl.STATIC_COPY)
+	// define 3d model ssbos
+	fmt.Println("len(triangles)", len(instanced.Triangles), "len(instances)", len(instanced.Instances))
+	newStorageBuffer(3, instanced.Triangles)
+	newStorageBuffer(4, instanced.Instances)
+	newStorageBuffer(5, instanced.Materials)
+	fmt.Println("len(bvh nodes)", len(instanced.BVH.Nodes))
+	newStorageBuffer(7, instanced.BVH.Nodes)
+	newStorageBuffer(8, instanced.BVH.Indices)
 
 	// color (black) that gl.Clear() is going to use
 	gl.ClearColor(0.0, 0.0, 0.0, 1.0)
@@ -147,7 +170,7 @@ func main() {
 	previousTime := glfw.GetTime()
 
 	// define camera
-	cameraVec := []float32{0, 300, 950}
+	cameraVec := []float32{sc.Camera.Position[0], sc.Camera.Position[1], sc.Camera.Position[2]}
 	
 	// more misc definitions
 	window.SetInputMode(glfw.CursorMode, glfw.CursorHidden)
@@ -204,6 +227,17 @@ func main() {
 		gl.Uniform3f(camLocation, cameraVec[0], cameraVec[1], cameraVec[2])	
 	}
 
+	// the uniforms that are only sent on change
+	gl.UseProgram(computeShader)
+	gl.Uniform1f(gl.GetUniformLocation(computeShader, gl.Str("width"+"\x00")), float32(curWidth))
+	gl.Uniform1f(gl.GetUniformLocation(computeShader, gl.Str("height"+"\x00")), float32(curHeight))
+	gl.Uniform1i(gl.GetUniformLocation(computeShader, gl.Str("hops"+"\x00")), int32(sc.Settings.Hops))
+	gl.Uniform1i(gl.GetUniformLocation(computeShader, gl.Str("bvh_root"+"\x00")), instanced.Root)
+	direction := sc.Camera.LookDirection()
+	gl.Uniform3f(gl.GetUniformLocation(computeShader, gl.Str("cam_direction"+"\x00")), direction[0], direction[1], direction[2])
+	gl.Uniform1f(gl.GetUniformLocation(computeShader, gl.Str("cam_fov"+"\x00")), sc.Camera.FieldOfView())
+	sendCamera()
+
 	for !window.ShouldClose() {
 		gl.UseProgram(computeShader)
 
@@ -217,19 +251,19 @@ func main() {
 		sendCursor()
 
 		if window.GetKey(glfw.KeyW) == glfw.Press {
-			cameraVec[2] -= 50
+			cameraVec[2] -= sc.Camera.Speed
 			sendCamera()			
 		}
 		if window.GetKey(glfw.KeyS) == glfw.Press {
-			cameraVec[2] += 50
+			cameraVec[2] += sc.Camera.Speed
 			sendCamera()						
 		}
 		if window.GetKey(glfw.KeyA) == glfw.Press {
-			cameraVec[0] -= 50		
+			cameraVec[0] -= sc.Camera.Speed		
 			sendCamera()	
 		}
 		if window.GetKey(glfw.KeyD) == glfw.Press {
-			cameraVec[0] += 50		
+			cameraVec[0] += sc.Camera.Speed		
 			sendCamera()	
 		}
 
@@ -271,4 +305,22 @@ func main() {
 		window.SwapBuffers()
 		samples += 1
 	}
-}
\ No newline at end of file
+}
+
+// newStorageBuffer uploads the slice data to a new shader storage buffer
+// bound to binding point binding
+func newStorageBuffer(binding uint32, data interface{}) uint32 {
+	var ssbo uint32
+	gl.GenBuffers(1, &ssbo)
+	gl.BindBuffer(gl.SHADER_STORAGE_BUFFER, ssbo)
+	gl.BindBufferBase(gl.SHADER_STORAGE_BUFFER, binding, ssbo)
+
+	v := reflect.ValueOf(data)
+	if v.Len() == 0 {
+		gl.BufferData(gl.SHADER_STORAGE_BUFFER, 0, nil, gl.STATIC_COPY)
+		return ssbo
+	}
+	size := v.Len() * int(v.Type().Elem().Size())
+	gl.BufferData(gl.SHADER_STORAGE_BUFFER, size, gl.Ptr(data), gl.STATIC_COPY)
+	return ssbo
+}
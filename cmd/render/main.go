@@ -0,0 +1,57 @@
+package main
+
+// render renders a scene with the CPU path tracer into a png, without a
+// GPU or window
+//
+//	go run ./cmd/render [-o render.png] [-samples n] [-workers n] [scene]
+
+import (
+	"flag"
+	"fmt"
+	"image/png"
+	"log"
+	"os"
+	"time"
+
+	"github.com/supermuesli/computeshader/pkg/scene"
+	"github.com/supermuesli/computeshader/pkg/tracer"
+)
+
+func main() {
+	out := flag.String("o", "render.png", "png file to write")
+	samples := flag.Int("samples", 1, "paths per pixel")
+	workers := flag.Int("workers", 0, "goroutines, all cpus if 0")
+	flag.Parse()
+
+	// a scene description or any model file format scene knows
+	path := "pkg/3dmodels/CornellBox-Original.obj"
+	if flag.NArg() > 0 {
+		path = flag.Arg(0)
+	}
+	loader := scene.Loader{Lenient: true}
+	sc, err := loader.Load(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, w := range sc.Warnings() {
+		fmt.Println("warning:", w)
+	}
+
+	r := tracer.New(sc)
+	r.Workers = *workers
+	start := time.Now()
+	img := r.Render(sc.Instanced(), *samples)
+	fmt.Printf("%dx%d, %d samples in %v\n", img.Width, img.Height, *samples, time.Since(start))
+
+	f, err := os.Create(*out)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := png.Encode(f, img); err != nil {
+		f.Close()
+		log.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,159 @@
+// Package accel is what the acceleration structures have in common: they
+// are built over a triangle soup, answer closest hit queries on the CPU
+// and serialize to the shader storage buffers the compute shader reads.
+package accel
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/supermuesli/computeshader/pkg/meshutil"
+	"github.com/supermuesli/computeshader/pkg/objparser"
+)
+
+// Ray is a half line, Dir does not have to be unit length. Distances are
+// in multiples of Dir.
+type Ray struct {
+	Origin, Dir mgl32.Vec3
+}
+
+// At returns the point at distance t
+func (r Ray) At(t float32) mgl32.Vec3 {
+	return r.Origin.Add(r.Dir.Mul(t))
+}
+
+// InvDir returns 1/Dir per component, as the box tests want it
+func (r Ray) InvDir() mgl32.Vec3 {
+	return mgl32.Vec3{1 / r.Dir[0], 1 / r.Dir[1], 1 / r.Dir[2]}
+}
+
+// Hit is where a ray hits a triangle
+type Hit struct {
+	// index of the triangle in the slice the structure was built over
+	Triangle int32
+	Distance float32
+}
+
+// Structure is an acceleration structure over a triangle soup
+type Structure interface {
+	// Intersect returns the closest triangle the ray hits closer than max
+	Intersect(r Ray, max float32) (Hit, bool)
+	// Buffers returns the structure as shader storage buffers
+	Buffers() []Buffer
+	// NodeCount is the number of nodes, or cells of grids
+	NodeCount() int
+	// Walk visits the nodes depth first, parents before their children
+	Walk(visit func(Node))
+}
+
+// Buffer is the content of a shader storage buffer
+type Buffer struct {
+	Name string
+	// std430, little endian
+	Data []byte
+}
+
+// Encode returns data, a slice of std430 structs, as bytes
+func Encode(data interface{}) []byte {
+	var buf bytes.Buffer
+	if err := binary.Write(&buf, binary.LittleEndian, data); err != nil {
+		// only a programming error, the structs are fixed size
+		panic(err)
+	}
+	return buf.Bytes()
+}
+
+// Size is the number of bytes the buffers of s take
+func Size(s Structure) int {
+	size := 0
+	for _, b := range s.Buffers() {
+		size += len(b.Data)
+	}
+	return size
+}
+
+// minimum distance of a hit, as in the compute shader
+const Epsilon = 0.0001
+
+// Inf is the max of queries without a limit
+var Inf = float32(math.Inf(1))
+
+// IntersectTriangle is the möller trumbore test of the compute shader
+func IntersectTriangle(r Ray, t *objparser.Triangle) (float32, bool) {
+	p0, p1, p2 := t.A.Vec3(), t.B.Vec3(), t.C.Vec3()
+	edge1, edge2 := p1.Sub(p0), p2.Sub(p0)
+	h := r.Dir.Cross(edge2)
+	a := edge1.Dot(h)
+	if a > -Epsilon && a < Epsilon {
+		// parallel to the triangle
+		return 0, false
+	}
+	f := 1 / a
+	s := r.Origin.Sub(p0)
+	u := f * s.Dot(h)
+	if u < 0 || u > 1 {
+		return 0, false
+	}
+	q := s.Cross(edge1)
+	v := f * r.Dir.Dot(q)
+	if v < 0 || u+v > 1 {
+		return 0, false
+	}
+	d := f * edge2.Dot(q)
+	return d, d > Epsilon && d < 1/Epsilon
+}
+
+// IntersectBox is the slab test, it returns the distances at which the ray
+// enters and leaves b if it does so between 0 and max
+func IntersectBox(r Ray, invDir mgl32.Vec3, b meshutil.Box, max float32) (near, far float32, ok bool) {
+	near, far = 0, max
+	for i := 0; i < 3; i++ {
+		t0 := (b.Min[i] - r.Origin[i]) * invDir[i]
+		t1 := (b.Max[i] - r.Origin[i]) * invDir[i]
+		if t0 > t1 {
+			t0, t1 = t1, t0
+		}
+		// NaN for rays in the plane of a side, they do not limit the range
+		if t0 > near {
+			near = t0
+		}
+		if t1 < far {
+			far = t1
+		}
+	}
+	return near, far, near <= far
+}
+
+// Brute tests every triangle, the baseline for the other structures
+type Brute []objparser.Triangle
+
+func (b Brute) Intersect(r Ray, max float32) (Hit, bool) {
+	hit := Hit{Triangle: -1, Distance: max}
+	for i := range b {
+		if d, ok := IntersectTriangle(r, &b[i]); ok && d < hit.Distance {
+			hit = Hit{Triangle: int32(i), Distance: d}
+		}
+	}
+	return hit, hit.Triangle >= 0
+}
+
+func (b Brute) Buffers() []Buffer {
+	return nil
+}
+
+func (b Brute) NodeCount() int {
+	return 0
+}
+
+// Walk visits a single leaf with all triangles
+func (b Brute) Walk(visit func(Node)) {
+	bounds := meshutil.EmptyBox()
+	for _, t := range b {
+		bounds.Grow(t.A.Vec3())
+		bounds.Grow(t.B.Vec3())
+		bounds.Grow(t.C.Vec3())
+	}
+	visit(Node{Bounds: bounds, Primitives: len(b)})
+}
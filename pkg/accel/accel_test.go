@@ -0,0 +1,105 @@
+package accel_test
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/supermuesli/computeshader/pkg/accel"
+	"github.com/supermuesli/computeshader/pkg/bvh"
+	"github.com/supermuesli/computeshader/pkg/grid"
+	"github.com/supermuesli/computeshader/pkg/kdtree"
+	"github.com/supermuesli/computeshader/pkg/objparser"
+)
+
+var structures = []struct {
+	name  string
+	build func([]objparser.Triangle) accel.Structure
+}{
+	{"bvh", func(t []objparser.Triangle) accel.Structure { return bvh.Build(t) }},
+	{"grid", func(t []objparser.Triangle) accel.Structure { return grid.Build(t) }},
+	{"kdtree", func(t []objparser.Triangle) accel.Structure { return kdtree.Build(t) }},
+}
+
+// randomTriangles returns n triangles in the cube [0, 10], a quarter of
+// them in planes perpendicular to an axis at whole numbers
+func randomTriangles(rng *rand.Rand, n int) []objparser.Triangle {
+	point := func() mgl32.Vec3 {
+		return mgl32.Vec3{rng.Float32() * 10, rng.Float32() * 10, rng.Float32() * 10}
+	}
+	triangles := make([]objparser.Triangle, n)
+	for i := range triangles {
+		a := point()
+		b := a.Add(point().Sub(mgl32.Vec3{5, 5, 5}).Mul(0.3))
+		c := a.Add(point().Sub(mgl32.Vec3{5, 5, 5}).Mul(0.3))
+		if i%4 == 0 {
+			axis := rng.Intn(3)
+			plane := float32(rng.Intn(11))
+			a[axis], b[axis], c[axis] = plane, plane, plane
+		}
+		triangles[i] = objparser.Triangle{A: a.Vec4(1), B: b.Vec4(1), C: c.Vec4(1)}
+	}
+	return triangles
+}
+
+func TestIntersect(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	triangles := randomTriangles(rng, 500)
+	brute := accel.Brute(triangles)
+
+	axes := []mgl32.Vec3{{1, 0, 0}, {-1, 0, 0}, {0, 1, 0}, {0, -1, 0}, {0, 0, 1}, {0, 0, -1}}
+	rays := []accel.Ray{}
+	for i := 0; i < 3000; i++ {
+		var r accel.Ray
+		switch i % 4 {
+		case 0:
+			// from outside the bounds
+			r.Origin = mgl32.Vec3{rng.Float32()*30 - 10, rng.Float32()*30 - 10, rng.Float32()*30 - 10}
+			r.Dir = mgl32.Vec3{5, 5, 5}.Sub(r.Origin).Add(mgl32.Vec3{rng.Float32(), rng.Float32(), rng.Float32()})
+		case 1:
+			// from inside the bounds
+			r.Origin = mgl32.Vec3{rng.Float32() * 10, rng.Float32() * 10, rng.Float32() * 10}
+			r.Dir = mgl32.Vec3{float32(rng.NormFloat64()), float32(rng.NormFloat64()), float32(rng.NormFloat64())}
+		case 2:
+			// parallel to an axis from inside the bounds
+			r.Origin = mgl32.Vec3{rng.Float32() * 10, rng.Float32() * 10, rng.Float32() * 10}
+			r.Dir = axes[rng.Intn(len(axes))]
+		case 3:
+			// parallel to an axis, in the plane of the corner of a
+			// triangle, where splits are
+			r.Origin = mgl32.Vec3{rng.Float32() * 10, rng.Float32() * 10, rng.Float32() * 10}
+			r.Dir = axes[rng.Intn(len(axes))]
+			corner := triangles[rng.Intn(len(triangles))].B
+			for axis := range r.Dir {
+				if r.Dir[axis] == 0 && rng.Intn(2) == 0 {
+					r.Origin[axis] = corner[axis]
+				}
+			}
+		}
+		rays = append(rays, r)
+	}
+
+	for _, s := range structures {
+		st := s.build(triangles)
+		misses := 0
+		for i, r := range rays {
+			max := accel.Inf
+			if i%3 == 0 {
+				max = 4
+			}
+			want, wantOK := brute.Intersect(r, max)
+			got, ok := st.Intersect(r, max)
+			// ties between triangles may go either way, the distance may not
+			if ok != wantOK || ok && math.Abs(float64(got.Distance-want.Distance)) > 1e-5*float64(want.Distance) {
+				misses++
+				if misses <= 5 {
+					t.Errorf("%s: ray %+v with max %v: got %+v, %t, want %+v, %t", s.name, r, max, got, ok, want, wantOK)
+				}
+			}
+		}
+		if misses > 0 {
+			t.Errorf("%s: %d of %d rays differ from the brute force test", s.name, misses, len(rays))
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package accel
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strings"
+
+	"github.com/supermuesli/computeshader/pkg/meshutil"
+)
+
+// Node is how Structure.Walk presents the nodes of a structure
+type Node struct {
+	// the root is at depth 0
+	Depth  int
+	Bounds meshutil.Box
+	// Children are the bounds of the children of inner nodes, nil for leaves
+	Children []meshutil.Box
+	// Cells is the number of children of inner nodes that are split into
+	// cells, like the root of a grid. Cells cannot overlap, so they are not
+	// in Children.
+	Cells int
+	// Primitives is the number of triangles of leaves
+	Primitives int
+}
+
+func (n *Node) Leaf() bool {
+	return n.Children == nil && n.Cells == 0
+}
+
+// costs of the surface area heuristic of Stats, relative to intersecting
+// one triangle
+const (
+	TraversalCost    = 1
+	IntersectionCost = 1
+)
+
+// Stats tells how good a structure is
+type Stats struct {
+	Nodes, Leaves int
+	// Primitives is the number of triangles in all leaves, more than were
+	// built over if the structure puts them in several leaves
+	Primitives int
+	// Cost is the expected cost of a ray that hits the root, by the surface
+	// area heuristic
+	Cost float64
+	// Overlap is the mean over inner nodes of the area their children have
+	// in common, relative to the area of the node. Cells do not overlap.
+	Overlap float64
+	// Depths[d] is the number of leaves at depth d
+	Depths []int
+	// LeafSizes[n] is the number of leaves with n primitives
+	LeafSizes []int
+}
+
+// Measure walks s and gathers its Stats
+func Measure(s Structure) Stats {
+	st := Stats{Depths: []int{}, LeafSizes: []int{}}
+	rootArea, overlaps := 0.0, 0
+	s.Walk(func(n Node) {
+		st.Nodes++
+		area := surfaceArea(n.Bounds)
+		if n.Depth == 0 {
+			rootArea = area
+		}
+		// relative to the root, nodes of the same size as the root are
+		// always visited
+		p := 1.0
+		if rootArea > 0 {
+			p = area / rootArea
+		}
+
+		if !n.Leaf() {
+			st.Cost += TraversalCost * p
+			if area > 0 {
+				st.Overlap += overlap(n.Children) / area
+			}
+			overlaps++
+			return
+		}
+
+		st.Leaves++
+		st.Primitives += n.Primitives
+		st.Cost += IntersectionCost * float64(n.Primitives) * p
+		for len(st.Depths) <= n.Depth {
+			st.Depths = append(st.Depths, 0)
+		}
+		st.Depths[n.Depth]++
+		for len(st.LeafSizes) <= n.Primitives {
+			st.LeafSizes = append(st.LeafSizes, 0)
+		}
+		st.LeafSizes[n.Primitives]++
+	})
+	if overlaps > 0 {
+		st.Overlap /= float64(overlaps)
+	}
+	return st
+}
+
+// surfaceArea is the surface area of b, 0 for the empty box
+func surfaceArea(b meshutil.Box) float64 {
+	if b.Empty() {
+		return 0
+	}
+	d := b.Size()
+	return 2 * float64(d[0]*d[1]+d[1]*d[2]+d[2]*d[0])
+}
+
+// overlap is the summed area of the intersections of all pairs of boxes.
+// Boxes that only touch, like the children of kd-trees, do not overlap.
+func overlap(boxes []meshutil.Box) float64 {
+	sum := 0.0
+	for i := range boxes {
+		for j := i + 1; j < len(boxes); j++ {
+			a, b := boxes[i], boxes[j]
+			thick := true
+			for k := 0; k < 3; k++ {
+				a.Min[k] = float32(math.Max(float64(a.Min[k]), float64(b.Min[k])))
+				a.Max[k] = float32(math.Min(float64(a.Max[k]), float64(b.Max[k])))
+				thick = thick && a.Min[k] < a.Max[k]
+			}
+			if thick {
+				sum += surfaceArea(a)
+			}
+		}
+	}
+	return sum
+}
+
+// MaxDepth is the depth of the deepest leaf
+func (s *Stats) MaxDepth() int {
+	return len(s.Depths) - 1
+}
+
+// Write prints the stats with histograms of the leaf depths and sizes
+func (s *Stats) Write(w io.Writer) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "nodes %d, leaves %d, primitives in leaves %d, max depth %d\n", s.Nodes, s.Leaves, s.Primitives, s.MaxDepth())
+	fmt.Fprintf(&b, "sah cost %.2f, overlap %.1f%%\n", s.Cost, 100*s.Overlap)
+	histogram(&b, "depth", s.Depths)
+	histogram(&b, "leaf size", s.LeafSizes)
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func (s Stats) String() string {
+	var b strings.Builder
+	s.Write(&b)
+	return b.String()
+}
+
+// histogram writes the non zero counts with a bar each
+func histogram(b *strings.Builder, name string, counts []int) {
+	max := 0
+	for _, c := range counts {
+		if c > max {
+			max = c
+		}
+	}
+	fmt.Fprintf(b, "%10s %8s\n", name, "leaves")
+	for i, c := range counts {
+		if c == 0 {
+			continue
+		}
+		fmt.Fprintf(b, "%10d %8d %s\n", i, c, strings.Repeat("#", (40*c+max-1)/max))
+	}
+}
@@ -0,0 +1,67 @@
+package accel_test
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/supermuesli/computeshader/pkg/accel"
+	"github.com/supermuesli/computeshader/pkg/meshutil"
+)
+
+// walker is a structure made of the nodes it walks
+type walker []accel.Node
+
+func (w walker) Intersect(r accel.Ray, max float32) (accel.Hit, bool) {
+	return accel.Hit{Triangle: -1, Distance: max}, false
+}
+
+func (w walker) Buffers() []accel.Buffer { return nil }
+
+func (w walker) NodeCount() int { return len(w) }
+
+func (w walker) Walk(visit func(accel.Node)) {
+	for _, n := range w {
+		visit(n)
+	}
+}
+
+// twoLeaves is a root of area 10 with two overlapping leaves of areas 8
+// and 6 that have a box of area 4 in common
+var twoLeaves = walker{
+	{Depth: 0, Bounds: box(0, 0, 0, 2, 1, 1), Children: []meshutil.Box{box(0, 0, 0, 1.5, 1, 1), box(1, 0, 0, 2, 1, 1)}},
+	{Depth: 1, Bounds: box(0, 0, 0, 1.5, 1, 1), Primitives: 3},
+	{Depth: 1, Bounds: box(1, 0, 0, 2, 1, 1), Primitives: 1},
+}
+
+func box(x0, y0, z0, x1, y1, z1 float32) meshutil.Box {
+	return meshutil.Box{Min: mgl32.Vec3{x0, y0, z0}, Max: mgl32.Vec3{x1, y1, z1}}
+}
+
+func TestMeasure(t *testing.T) {
+	st := accel.Measure(twoLeaves)
+	if st.Nodes != 3 || st.Leaves != 2 || st.Primitives != 4 || st.MaxDepth() != 1 {
+		t.Errorf("got %d nodes, %d leaves, %d primitives, depth %d, want 3, 2, 4, 1", st.Nodes, st.Leaves, st.Primitives, st.MaxDepth())
+	}
+	if !reflect.DeepEqual(st.Depths, []int{0, 2}) || !reflect.DeepEqual(st.LeafSizes, []int{0, 1, 0, 1}) {
+		t.Errorf("got depths %v and leaf sizes %v, want [0 2] and [0 1 0 1]", st.Depths, st.LeafSizes)
+	}
+	// the root plus 3 triangles in 8/10 and 1 in 6/10 of the rays
+	if want := 1 + 3*0.8 + 0.6; math.Abs(st.Cost-want) > 1e-9 {
+		t.Errorf("got cost %v, want %v", st.Cost, want)
+	}
+	if math.Abs(st.Overlap-0.4) > 1e-9 {
+		t.Errorf("got overlap %v, want 0.4", st.Overlap)
+	}
+
+	// children that only touch do not overlap
+	touching := walker{
+		{Depth: 0, Bounds: box(0, 0, 0, 2, 1, 1), Children: []meshutil.Box{box(0, 0, 0, 1, 1, 1), box(1, 0, 0, 2, 1, 1)}},
+		{Depth: 1, Bounds: box(0, 0, 0, 1, 1, 1)},
+		{Depth: 1, Bounds: box(1, 0, 0, 2, 1, 1)},
+	}
+	if st := accel.Measure(touching); st.Overlap != 0 {
+		t.Errorf("got overlap %v of touching children, want 0", st.Overlap)
+	}
+}
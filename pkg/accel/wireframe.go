@@ -0,0 +1,55 @@
+package accel
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+// the edges of a box between the corners numbered by their bits x, y, z
+var boxEdges = [12][2]int{
+	{0, 1}, {2, 3}, {4, 5}, {6, 7},
+	{0, 2}, {1, 3}, {4, 6}, {5, 7},
+	{0, 4}, {1, 5}, {2, 6}, {3, 7},
+}
+
+// WriteWireframe writes the bounds of the nodes of s up to maxDepth as
+// the edges of boxes in an .obj file, a group per depth so that viewers
+// can show the levels one by one. maxDepth < 0 writes all nodes. The
+// edges are l statements, objparser reads and skips them.
+func WriteWireframe(w io.Writer, s Structure, maxDepth int) error {
+	out := bufio.NewWriter(w)
+	// nodes are written per depth, Walk goes depth first
+	var levels [][]Node
+	s.Walk(func(n Node) {
+		if maxDepth >= 0 && n.Depth > maxDepth {
+			return
+		}
+		for len(levels) <= n.Depth {
+			levels = append(levels, nil)
+		}
+		levels[n.Depth] = append(levels[n.Depth], n)
+	})
+
+	vertices := 0
+	for depth, nodes := range levels {
+		fmt.Fprintf(out, "g depth%d\n", depth)
+		for _, n := range nodes {
+			for corner := 0; corner < 8; corner++ {
+				p := n.Bounds.Min
+				for axis := uint(0); axis < 3; axis++ {
+					if corner&(1<<axis) != 0 {
+						p[axis] = n.Bounds.Max[axis]
+					}
+				}
+				fmt.Fprintf(out, "v %g %g %g\n", p[0], p[1], p[2])
+			}
+			for _, e := range boxEdges {
+				// .obj indices start at 1
+				fmt.Fprintf(out, "l %d %d\n", vertices+e[0]+1, vertices+e[1]+1)
+			}
+			vertices += 8
+		}
+	}
+	return out.Flush()
+}
@@ -0,0 +1,59 @@
+package accel_test
+
+import (
+	"bytes"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/supermuesli/computeshader/pkg/accel"
+	"github.com/supermuesli/computeshader/pkg/objparser"
+)
+
+func TestWireframe(t *testing.T) {
+	for _, maxDepth := range []int{-1, 0} {
+		var buf bytes.Buffer
+		if err := accel.WriteWireframe(&buf, twoLeaves, maxDepth); err != nil {
+			t.Fatal(err)
+		}
+		boxes := 3
+		if maxDepth == 0 {
+			boxes = 1
+		}
+		if n := strings.Count(buf.String(), "\nl "); n != 12*boxes {
+			t.Errorf("max depth %d: got %d edges, want %d", maxDepth, n, 12*boxes)
+		}
+
+		// a strict load reads the lines and skips them
+		var vertices []mgl32.Vec3
+		p := objparser.Parser{OnVertex: func(v mgl32.Vec3) error {
+			vertices = append(vertices, v)
+			return nil
+		}}
+		if err := p.Parse(bytes.NewReader(buf.Bytes()), "wireframe.obj"); err != nil {
+			t.Fatalf("max depth %d: %v", maxDepth, err)
+		}
+		if len(vertices) != 8*boxes || vertices[0] != (mgl32.Vec3{0, 0, 0}) || vertices[7] != (mgl32.Vec3{2, 1, 1}) {
+			t.Errorf("max depth %d: got vertices %v, want the corners of %d boxes", maxDepth, vertices, boxes)
+		}
+	}
+
+	// the exports of the real structures
+	triangles := randomTriangles(rand.New(rand.NewSource(1)), 100)
+	for _, s := range structures {
+		var buf bytes.Buffer
+		if err := accel.WriteWireframe(&buf, s.build(triangles), -1); err != nil {
+			t.Fatal(err)
+		}
+		for _, workers := range []int{0, 4} {
+			l := objparser.Loader{Workers: workers}
+			m, err := l.Parse(bytes.NewReader(buf.Bytes()), s.name+".obj")
+			if err != nil {
+				t.Errorf("%s, %d workers: %v", s.name, workers, err)
+			} else if len(m.Warnings) != 0 {
+				t.Errorf("%s, %d workers: got warnings %v", s.name, workers, m.Warnings)
+			}
+		}
+	}
+}
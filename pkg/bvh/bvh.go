@@ -0,0 +1,231 @@
+// Package bvh builds bounding volume hierarchies over triangles or boxes
+// with the binned surface area heuristic, flattened into the node array the
+// compute shader traverses.
+//
+// The two children of a node are next to each other in Nodes, the root is
+// node 0. Leaves refer to a run of Indices, which are the primitives in
+// the order the leaves need them.
+package bvh
+
+import (
+	"sync/atomic"
+
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/supermuesli/computeshader/pkg/meshutil"
+	"github.com/supermuesli/computeshader/pkg/objparser"
+)
+
+// Node is a node of the hierarchy, laid out like the Node struct of the
+// compute shader (std430)
+type Node struct {
+	Min mgl32.Vec3
+	// LeftFirst is the index of the left child, the right child follows
+	// it, or the first index of a leaf in BVH.Indices
+	LeftFirst int32
+	Max       mgl32.Vec3
+	// Count is the number of primitives of a leaf, 0 for inner nodes
+	Count int32
+}
+
+func (n *Node) Leaf() bool {
+	return n.Count > 0
+}
+
+func (n *Node) Bounds() meshutil.Box {
+	return meshutil.Box{Min: n.Min, Max: n.Max}
+}
+
+// BVH is a flattened hierarchy
+type BVH struct {
+	Nodes []Node
+	// the primitives of the leaves, as indices into the slice it was built from
+	Indices []int32
+
+	// the triangles of Builder.Build, for Intersect
+	triangles []objparser.Triangle
+}
+
+// Builder configures how hierarchies are built. The zero value is ready to use.
+type Builder struct {
+	// LeafSize is the most primitives a leaf holds, 4 if 0. Smaller leaves
+	// are made where splitting does not pay off.
+	LeafSize int
+	// Bins is the number of candidate splits per axis, 16 if 0
+	Bins int
+	// Workers > 1 builds subtrees on up to Workers goroutines. The
+	// hierarchy is as good as a sequential one but the order of its nodes
+	// depends on the scheduling.
+	Workers int
+}
+
+// subtrees with fewer primitives are not worth a goroutine
+const minParallelSize = 1024
+
+// MaxDepth is the depth of the deepest leaves, nodes that deep are made
+// leaves whatever their size. Traversing a hierarchy takes a stack of
+// MaxDepth+1 nodes at most, the size of the one of the compute shader.
+const MaxDepth = 63
+
+// cost of visiting a node relative to intersecting one primitive
+const (
+	traversalCost    = 1
+	intersectionCost = 1
+)
+
+// Build builds a hierarchy over triangles with the default Builder
+func Build(triangles []objparser.Triangle) *BVH {
+	var b Builder
+	return b.Build(triangles)
+}
+
+// Build builds a hierarchy over triangles
+func (b *Builder) Build(triangles []objparser.Triangle) *BVH {
+	bvh := b.BuildBoxes(triangleBoxes(triangles))
+	bvh.triangles = triangles
+	return bvh
+}
+
+func triangleBoxes(triangles []objparser.Triangle) []meshutil.Box {
+	boxes := make([]meshutil.Box, len(triangles))
+	for i, t := range triangles {
+		boxes[i] = meshutil.EmptyBox()
+		boxes[i].Grow(t.A.Vec3())
+		boxes[i].Grow(t.B.Vec3())
+		boxes[i].Grow(t.C.Vec3())
+	}
+	return boxes
+}
+
+// BuildBoxes builds a hierarchy over the primitives with the bounds boxes
+func (b *Builder) BuildBoxes(boxes []meshutil.Box) *BVH {
+	bvh := &BVH{Nodes: []Node{}, Indices: make([]int32, len(boxes))}
+	if len(boxes) == 0 {
+		return bvh
+	}
+	for i := range bvh.Indices {
+		bvh.Indices[i] = int32(i)
+	}
+
+	s := &splitter{
+		leafSize:  b.LeafSize,
+		bins:      b.Bins,
+		boxes:     boxes,
+		centroids: make([]mgl32.Vec3, len(boxes)),
+	}
+	if s.leafSize <= 0 {
+		s.leafSize = 4
+	}
+	if s.bins <= 0 {
+		s.bins = 16
+	}
+	for i, box := range boxes {
+		s.centroids[i] = box.Center()
+	}
+	if b.Workers > 1 {
+		s.workers = make(chan struct{}, b.Workers-1)
+	}
+
+	// a binary tree with a leaf per primitive at most, the nodes are
+	// taken from it by the goroutines
+	bvh.Nodes = make([]Node, 2*len(boxes)-1)
+	s.nodes = 1
+	s.build(bvh, 0, 0, 0, len(boxes))
+	s.wg.Wait()
+	bvh.Nodes = bvh.Nodes[:s.nodes]
+	return bvh
+}
+
+// build makes node, at depth, the root of the subtree over
+// bvh.Indices[start:end]
+func (s *splitter) build(bvh *BVH, node, depth, start, end int) {
+	indices := bvh.Indices[start:end]
+	bounds := s.bounds(indices)
+	n := &bvh.Nodes[node]
+	n.Min, n.Max = bounds.Min, bounds.Max
+
+	mid, ok := 0, false
+	if depth < MaxDepth {
+		mid, ok = s.split(indices, bounds)
+	}
+	if !ok {
+		n.LeftFirst, n.Count = int32(start), int32(len(indices))
+		return
+	}
+
+	// children come after their parent, Refit relies on it
+	left := int(atomic.AddInt32(&s.nodes, 2)) - 2
+	n.LeftFirst = int32(left)
+	if mid >= minParallelSize && s.acquire() {
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer s.release()
+			s.build(bvh, left, depth+1, start, start+mid)
+		}()
+	} else {
+		s.build(bvh, left, depth+1, start, start+mid)
+	}
+	s.build(bvh, left+1, depth+1, start+mid, end)
+}
+
+// acquire takes a worker if one is free
+func (s *splitter) acquire() bool {
+	select {
+	case s.workers <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *splitter) release() {
+	<-s.workers
+}
+
+// Refit recomputes the bounds of all nodes from boxes, the bounds of the
+// primitives the hierarchy was built over, after they moved. The tree stays
+// as it is, so it gets slower to traverse the further the primitives move
+// from where they were; rebuild it then.
+func (b *BVH) Refit(boxes []meshutil.Box) {
+	for i := len(b.Nodes) - 1; i >= 0; i-- {
+		n := &b.Nodes[i]
+		bounds := meshutil.EmptyBox()
+		if n.Leaf() {
+			for _, p := range b.Indices[n.LeftFirst : n.LeftFirst+n.Count] {
+				bounds = bounds.Union(boxes[p])
+			}
+		} else {
+			bounds = b.Nodes[n.LeftFirst].Bounds().Union(b.Nodes[n.LeftFirst+1].Bounds())
+		}
+		n.Min, n.Max = bounds.Min, bounds.Max
+	}
+}
+
+// RefitTriangles is Refit for a hierarchy built over triangles, which
+// Intersect tests from then on
+func (b *BVH) RefitTriangles(triangles []objparser.Triangle) {
+	b.Refit(triangleBoxes(triangles))
+	b.triangles = triangles
+}
+
+// Concat appends src to dst, with the primitive indices of src moved by
+// first. It returns the index of the root of src in dst.Nodes, -1 if src
+// is empty.
+func Concat(dst, src *BVH, first int32) int32 {
+	if len(src.Nodes) == 0 {
+		return -1
+	}
+	nodeOffset, indexOffset := int32(len(dst.Nodes)), int32(len(dst.Indices))
+	for _, n := range src.Nodes {
+		if n.Leaf() {
+			n.LeftFirst += indexOffset
+		} else {
+			n.LeftFirst += nodeOffset
+		}
+		dst.Nodes = append(dst.Nodes, n)
+	}
+	for _, i := range src.Indices {
+		dst.Indices = append(dst.Indices, i+first)
+	}
+	return nodeOffset
+}
@@ -0,0 +1,212 @@
+package bvh
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/supermuesli/computeshader/pkg/accel"
+	"github.com/supermuesli/computeshader/pkg/meshutil"
+	"github.com/supermuesli/computeshader/pkg/objparser"
+)
+
+// depth returns the depth of the deepest leaf of b
+func depth(b *BVH) int {
+	max := 0
+	b.Walk(func(n accel.Node) {
+		if n.Depth > max {
+			max = n.Depth
+		}
+	})
+	return max
+}
+
+func TestMaxDepth(t *testing.T) {
+	// boxes at exponentially growing distances, with two bins every split
+	// separates the farthest one from the others
+	boxes := make([]meshutil.Box, 90)
+	x := float32(1)
+	for i := range boxes {
+		boxes[i] = meshutil.Box{Min: mgl32.Vec3{x, 0, 0}, Max: mgl32.Vec3{x, 1, 1}}
+		x *= 2.5
+	}
+	for _, workers := range []int{0, 4} {
+		b := (&Builder{LeafSize: 1, Bins: 2, Workers: workers}).BuildBoxes(boxes)
+		if d := depth(b); d != MaxDepth {
+			t.Errorf("workers=%d: got depth %d, want %d", workers, d, MaxDepth)
+		}
+
+		// every box is found, none is dropped by the traversal
+		for i, box := range boxes {
+			found := false
+			r := accel.Ray{Origin: box.Center().Sub(mgl32.Vec3{0, 0, 10}), Dir: mgl32.Vec3{0, 0, 1}}
+			b.Traverse(r, float32(1e38), 0, func(p int32, max float32) (float32, bool) {
+				found = found || p == int32(i)
+				return 0, false
+			})
+			if !found {
+				t.Errorf("workers=%d: box %d not visited", workers, i)
+			}
+		}
+	}
+}
+
+var models = []string{"CornellBox-Original.obj", "plant.obj", "testObj.obj"}
+
+// loadModels returns the triangles of the bundled models
+func loadModels(tb testing.TB) map[string][]objparser.Triangle {
+	tb.Helper()
+	triangles := map[string][]objparser.Triangle{}
+	for _, name := range models {
+		m, err := objparser.Load("../3dmodels/" + name)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		triangles[name] = m.Triangles()
+	}
+	return triangles
+}
+
+// sameTree reports whether the subtrees at na of a and nb of b are the
+// same, wherever their nodes are in Nodes
+func sameTree(a, b *BVH, na, nb int32) bool {
+	x, y := &a.Nodes[na], &b.Nodes[nb]
+	if x.Min != y.Min || x.Max != y.Max || x.Count != y.Count {
+		return false
+	}
+	if x.Leaf() {
+		return reflect.DeepEqual(a.Indices[x.LeftFirst:x.LeftFirst+x.Count], b.Indices[y.LeftFirst:y.LeftFirst+y.Count])
+	}
+	return sameTree(a, b, x.LeftFirst, y.LeftFirst) && sameTree(a, b, x.LeftFirst+1, y.LeftFirst+1)
+}
+
+func TestParallelBuild(t *testing.T) {
+	for name, triangles := range loadModels(t) {
+		want := (&Builder{}).Build(triangles)
+		for _, workers := range []int{2, 4, 8} {
+			got := (&Builder{Workers: workers}).Build(triangles)
+			if len(got.Nodes) != len(want.Nodes) || !sameTree(got, want, 0, 0) {
+				t.Errorf("%s: the build with %d workers differs from the sequential one", name, workers)
+			}
+		}
+	}
+}
+
+// rays returns n rays from a sphere around b towards points inside b
+func rays(b meshutil.Box, n int) []accel.Ray {
+	rng := rand.New(rand.NewSource(1))
+	point := func() mgl32.Vec3 {
+		var p mgl32.Vec3
+		for i := range p {
+			p[i] = b.Min[i] + rng.Float32()*(b.Max[i]-b.Min[i])
+		}
+		return p
+	}
+	radius := b.Size().Len()
+	out := make([]accel.Ray, n)
+	for i := range out {
+		dir := mgl32.Vec3{float32(rng.NormFloat64()), float32(rng.NormFloat64()), float32(rng.NormFloat64())}.Normalize()
+		origin := b.Center().Add(dir.Mul(radius))
+		out[i] = accel.Ray{Origin: origin, Dir: point().Sub(origin).Normalize()}
+	}
+	return out
+}
+
+func TestRefit(t *testing.T) {
+	transform := mgl32.Translate3D(5, -2, 3).Mul4(mgl32.HomogRotate3DY(0.7)).Mul4(mgl32.Scale3D(2, 0.5, 3))
+	for name, triangles := range loadModels(t) {
+		h := Build(triangles)
+		moved := make([]objparser.Triangle, len(triangles))
+		for i, tri := range triangles {
+			for _, v := range []*mgl32.Vec4{&tri.A, &tri.B, &tri.C} {
+				*v = transform.Mul4x1(v.Vec3().Vec4(1)).Vec3().Vec4(v[3])
+			}
+			moved[i] = tri
+		}
+		h.RefitTriangles(moved)
+		rebuilt := Build(moved)
+
+		if h.Nodes[0].Bounds() != rebuilt.Nodes[0].Bounds() {
+			t.Errorf("%s: got root bounds %v, rebuild has %v", name, h.Nodes[0].Bounds(), rebuilt.Nodes[0].Bounds())
+		}
+		// every node is tight around its children
+		for i := range h.Nodes {
+			n := &h.Nodes[i]
+			if n.Leaf() {
+				continue
+			}
+			if union := h.Nodes[n.LeftFirst].Bounds().Union(h.Nodes[n.LeftFirst+1].Bounds()); n.Bounds() != union {
+				t.Fatalf("%s: node %d has bounds %v, its children %v", name, i, n.Bounds(), union)
+			}
+		}
+
+		misses := 0
+		for _, r := range rays(rebuilt.Nodes[0].Bounds(), 2000) {
+			got, gotOK := h.Intersect(r, float32(math.Inf(1)))
+			want, wantOK := rebuilt.Intersect(r, float32(math.Inf(1)))
+			if !wantOK {
+				misses++
+			}
+			// ties between triangles sharing an edge may go either way
+			if gotOK != wantOK || got.Distance != want.Distance {
+				t.Errorf("%s: ray %v: got %+v, rebuild finds %+v", name, r, got, want)
+				break
+			}
+		}
+		if misses > 1900 {
+			t.Errorf("%s: %d of 2000 rays miss", name, misses)
+		}
+	}
+}
+
+// BenchmarkBuild measures the sequential build
+func BenchmarkBuild(b *testing.B) {
+	triangles := loadModels(b)
+	for _, name := range models {
+		triangles := triangles[name]
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			builder := Builder{}
+			for i := 0; i < b.N; i++ {
+				builder.Build(triangles)
+			}
+		})
+	}
+}
+
+// BenchmarkBuildParallel measures the build with several workers
+func BenchmarkBuildParallel(b *testing.B) {
+	loaded := loadModels(b)
+	for _, workers := range []int{2, 4, 8} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			for _, name := range models {
+				triangles := loaded[name]
+				b.Run(name, func(b *testing.B) {
+					b.ReportAllocs()
+					builder := Builder{Workers: workers}
+					for i := 0; i < b.N; i++ {
+						builder.Build(triangles)
+					}
+				})
+			}
+		})
+	}
+}
+
+// BenchmarkRefit measures refitting a hierarchy to its triangles
+func BenchmarkRefit(b *testing.B) {
+	triangles := loadModels(b)
+	for _, name := range models {
+		triangles := triangles[name]
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			h := Build(triangles)
+			for i := 0; i < b.N; i++ {
+				h.RefitTriangles(triangles)
+			}
+		})
+	}
+}
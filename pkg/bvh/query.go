@@ -0,0 +1,88 @@
+package bvh
+
+import (
+	"github.com/supermuesli/computeshader/pkg/accel"
+	"github.com/supermuesli/computeshader/pkg/meshutil"
+)
+
+// Intersect returns the closest triangle the ray hits closer than max, like
+// traverseMesh of the compute shader. It only finds triangles of
+// hierarchies made by Build.
+func (b *BVH) Intersect(r accel.Ray, max float32) (accel.Hit, bool) {
+	hit := accel.Hit{Triangle: -1, Distance: max}
+	if len(b.Nodes) == 0 || b.triangles == nil {
+		return hit, false
+	}
+	b.Traverse(r, max, 0, func(i int32, max float32) (float32, bool) {
+		d, ok := accel.IntersectTriangle(r, &b.triangles[i])
+		if !ok || d >= max {
+			return 0, false
+		}
+		hit = accel.Hit{Triangle: i, Distance: d}
+		return d, true
+	})
+	return hit, hit.Triangle >= 0
+}
+
+// Traverse visits the leaves of the subtree at root whose bounds the ray
+// hits closer than max and calls primitive for their primitives. primitive
+// returns the distance of a hit closer than max it found, which becomes
+// the new max. It returns the final max.
+func (b *BVH) Traverse(r accel.Ray, max float32, root int32, primitive func(i int32, max float32) (float32, bool)) float32 {
+	invDir := r.InvDir()
+	// deep enough for hierarchies of at most MaxDepth
+	var stack [MaxDepth + 1]int32
+	top := 0
+	stack[top] = root
+	top++
+	for top > 0 {
+		top--
+		n := &b.Nodes[stack[top]]
+		if _, _, ok := accel.IntersectBox(r, invDir, n.Bounds(), max); !ok {
+			continue
+		}
+		if !n.Leaf() {
+			stack[top], stack[top+1] = n.LeftFirst+1, n.LeftFirst
+			top += 2
+			continue
+		}
+		for _, i := range b.Indices[n.LeftFirst : n.LeftFirst+n.Count] {
+			if d, ok := primitive(i, max); ok {
+				max = d
+			}
+		}
+	}
+	return max
+}
+
+// Buffers returns the nodes and the leaf indices, bound to bvh_ssbo and
+// bvh_index_ssbo in the compute shader
+func (b *BVH) Buffers() []accel.Buffer {
+	return []accel.Buffer{
+		{Name: "bvh_ssbo", Data: accel.Encode(b.Nodes)},
+		{Name: "bvh_index_ssbo", Data: accel.Encode(b.Indices)},
+	}
+}
+
+func (b *BVH) NodeCount() int {
+	return len(b.Nodes)
+}
+
+// Walk visits the tree at node 0
+func (b *BVH) Walk(visit func(accel.Node)) {
+	if len(b.Nodes) > 0 {
+		b.walk(0, 0, visit)
+	}
+}
+
+func (b *BVH) walk(node int32, depth int, visit func(accel.Node)) {
+	n := &b.Nodes[node]
+	if n.Leaf() {
+		visit(accel.Node{Depth: depth, Bounds: n.Bounds(), Primitives: int(n.Count)})
+		return
+	}
+	left, right := &b.Nodes[n.LeftFirst], &b.Nodes[n.LeftFirst+1]
+	visit(accel.Node{Depth: depth, Bounds: n.Bounds(), Children: []meshutil.Box{left.Bounds(), right.Bounds()}})
+	b.walk(n.LeftFirst, depth+1, visit)
+	b.walk(n.LeftFirst+1, depth+1, visit)
+}
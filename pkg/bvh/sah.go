@@ -0,0 +1,139 @@
+package bvh
+
+import (
+	"math"
+	"sync"
+
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/supermuesli/computeshader/pkg/meshutil"
+)
+
+// splitter finds the splits of the primitives with the bounds boxes
+type splitter struct {
+	leafSize  int
+	bins      int
+	boxes     []meshutil.Box
+	centroids []mgl32.Vec3
+
+	// nodes is the number of nodes taken so far
+	nodes int32
+	// workers holds a token per goroutine building a subtree, nil if the
+	// build is sequential
+	workers chan struct{}
+	wg      sync.WaitGroup
+}
+
+type bin struct {
+	bounds meshutil.Box
+	count  int
+}
+
+func (s *splitter) bounds(indices []int32) meshutil.Box {
+	b := meshutil.EmptyBox()
+	for _, i := range indices {
+		b = b.Union(s.boxes[i])
+	}
+	return b
+}
+
+// split partitions indices into two halves at the split with the lowest
+// surface area heuristic cost and returns the size of the first half. It
+// returns false if the node is cheaper as a leaf.
+func (s *splitter) split(indices []int32, bounds meshutil.Box) (int, bool) {
+	count := len(indices)
+	if count <= 1 {
+		return 0, false
+	}
+
+	centroidBounds := meshutil.EmptyBox()
+	for _, i := range indices {
+		centroidBounds.Grow(s.centroids[i])
+	}
+
+	area := halfArea(bounds)
+	bestCost, bestAxis, bestBin := float32(math.Inf(1)), -1, 0
+	bins := make([]bin, s.bins)
+	rightArea := make([]float32, s.bins)
+	rightCount := make([]int, s.bins)
+	for axis := 0; axis < 3; axis++ {
+		lo, extent := centroidBounds.Min[axis], centroidBounds.Max[axis]-centroidBounds.Min[axis]
+		if extent <= 0 {
+			continue
+		}
+		for b := range bins {
+			bins[b] = bin{bounds: meshutil.EmptyBox()}
+		}
+		for _, i := range indices {
+			b := &bins[s.bin(s.centroids[i][axis], lo, extent)]
+			b.bounds = b.bounds.Union(s.boxes[i])
+			b.count++
+		}
+
+		// rightArea[b] and rightCount[b] are of the bins after b
+		right := bin{bounds: meshutil.EmptyBox()}
+		for b := s.bins - 1; b > 0; b-- {
+			right.bounds = right.bounds.Union(bins[b].bounds)
+			right.count += bins[b].count
+			rightArea[b-1], rightCount[b-1] = halfArea(right.bounds), right.count
+		}
+		left := bin{bounds: meshutil.EmptyBox()}
+		for b := 0; b < s.bins-1; b++ {
+			left.bounds = left.bounds.Union(bins[b].bounds)
+			left.count += bins[b].count
+			if left.count == 0 || rightCount[b] == 0 {
+				continue
+			}
+			cost := halfArea(left.bounds)*float32(left.count) + rightArea[b]*float32(rightCount[b])
+			if cost < bestCost {
+				bestCost, bestAxis, bestBin = cost, axis, b
+			}
+		}
+	}
+
+	if bestAxis < 0 {
+		// all centroids in one spot, no split separates them
+		if count <= s.leafSize {
+			return 0, false
+		}
+		return count / 2, true
+	}
+
+	if area > 0 {
+		bestCost = traversalCost + intersectionCost*bestCost/area
+		if bestCost >= intersectionCost*float32(count) && count <= s.leafSize {
+			return 0, false
+		}
+	}
+
+	lo, extent := centroidBounds.Min[bestAxis], centroidBounds.Max[bestAxis]-centroidBounds.Min[bestAxis]
+	mid := 0
+	for i := range indices {
+		if s.bin(s.centroids[indices[i]][bestAxis], lo, extent) <= bestBin {
+			indices[i], indices[mid] = indices[mid], indices[i]
+			mid++
+		}
+	}
+	return mid, true
+}
+
+// bin returns the bin of the centroid coordinate c
+func (s *splitter) bin(c, lo, extent float32) int {
+	b := int(float32(s.bins) * (c - lo) / extent)
+	if b >= s.bins {
+		b = s.bins - 1
+	}
+	if b < 0 {
+		b = 0
+	}
+	return b
+}
+
+// halfArea is half the surface area of b, which is all the heuristic
+// needs, and 0 for the empty box
+func halfArea(b meshutil.Box) float32 {
+	if b.Empty() {
+		return 0
+	}
+	d := b.Size()
+	return d[0]*d[1] + d[1]*d[2] + d[2]*d[0]
+}
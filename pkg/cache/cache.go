@@ -0,0 +1,442 @@
+// Package cache stores loaded meshes in a compact binary file that is
+// memory mapped on load, so that models do not have to be parsed again on
+// every start. A cache remembers the files the mesh was loaded from and
+// reports itself stale when one of them changes.
+//
+// The file is a header, a section table and 16 byte aligned sections,
+// all little endian:
+//
+//	magic "CSSC", version, section count, crc32c of the section table
+//	per section: id, crc32c of the section, offset, length
+//
+// Readers ignore sections with ids they do not know. A section is checked
+// against its checksum when it is first used, so that opening a cache to
+// see whether it is stale does not read the whole file.
+// The triangles section holds []objparser.Triangle exactly as the compute
+// shader reads it and the bvh sections hold the nodes and indices of the
+// hierarchy over them, so they can be handed to glBufferData without
+// copying.
+package cache
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"unsafe"
+
+	"github.com/supermuesli/computeshader/pkg/bvh"
+	"github.com/supermuesli/computeshader/pkg/objparser"
+)
+
+// Version is incremented whenever the layout changes, caches of other
+// versions fail to open with ErrVersion
+const Version = 4
+
+const (
+	magic      = "CSSC"
+	headerSize = 16
+	entrySize  = 24
+	alignment  = 16
+)
+
+// section ids
+const (
+	sectionDependencies = 1 + iota
+	sectionMesh
+	sectionTriangles
+	sectionNodes
+	sectionIndices
+	sectionWarnings
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// Dependency is a file the cached mesh was loaded from
+type Dependency struct {
+	// a path on disk
+	Path string
+	// Size is -1 for a file the loader looked for and did not find, the
+	// cache is stale once it exists
+	Size    int64
+	ModTime int64 // unix nanoseconds
+}
+
+// Missing returns the Dependency on the file at path not existing
+func Missing(path string) Dependency {
+	return Dependency{Path: path, Size: -1}
+}
+
+// Stat returns the current Dependency of the file at path
+func Stat(path string) (Dependency, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return Dependency{}, err
+	}
+	return Dependency{Path: path, Size: info.Size(), ModTime: info.ModTime().UnixNano()}, nil
+}
+
+// Entry is what a cache file holds
+type Entry struct {
+	Mesh *objparser.Mesh
+	// Triangles are the triangles of Mesh the way the renderer uploads
+	// them, BVH is the hierarchy over them
+	Triangles []objparser.Triangle
+	BVH       *bvh.BVH
+	// Dependencies are the files Mesh was loaded from
+	Dependencies []Dependency
+}
+
+// Write writes entry as a cache file
+func Write(w io.Writer, entry *Entry) error {
+	var sections [6]encoder
+
+	e := &sections[0]
+	e.u32(uint32(len(entry.Dependencies)))
+	for _, d := range entry.Dependencies {
+		e.str(d.Path)
+		e.u64(uint64(d.Size))
+		e.u64(uint64(d.ModTime))
+	}
+
+	if err := encodeMesh(&sections[1], entry.Mesh); err != nil {
+		return err
+	}
+
+	e = &sections[2]
+	for _, t := range entry.Triangles {
+		for _, v := range [...][4]float32{t.A, t.B, t.C, t.Color, t.Intensity} {
+			for _, f := range v {
+				e.f32(f)
+			}
+		}
+	}
+
+	e = &sections[3]
+	for _, n := range entry.BVH.Nodes {
+		e.vec3(n.Min)
+		e.u32(uint32(n.LeftFirst))
+		e.vec3(n.Max)
+		e.u32(uint32(n.Count))
+	}
+	e = &sections[4]
+	for _, i := range entry.BVH.Indices {
+		e.u32(uint32(i))
+	}
+
+	encodeWarnings(&sections[5], entry.Mesh.Warnings)
+
+	// section table and sections
+	var body encoder
+	offset := headerSize + len(sections)*entrySize
+	for i := range sections {
+		offset = align(offset)
+		body.u32(uint32(sectionDependencies + i))
+		body.u32(crc32.Checksum(sections[i].buf, castagnoli))
+		body.u64(uint64(offset))
+		body.u64(uint64(len(sections[i].buf)))
+		offset += len(sections[i].buf)
+	}
+	for i := range sections {
+		body.buf = append(body.buf, make([]byte, align(headerSize+len(body.buf))-headerSize-len(body.buf))...)
+		body.buf = append(body.buf, sections[i].buf...)
+	}
+
+	var header encoder
+	header.buf = append(header.buf, magic...)
+	header.u32(Version)
+	header.u32(uint32(len(sections)))
+	header.u32(crc32.Checksum(body.buf[:len(sections)*entrySize], castagnoli))
+
+	if _, err := w.Write(header.buf); err != nil {
+		return err
+	}
+	_, err := w.Write(body.buf)
+	return err
+}
+
+func align(offset int) int {
+	return (offset + alignment - 1) / alignment * alignment
+}
+
+// Save writes the cache file name. It is written next to name first and
+// renamed, so that readers never see a partial file.
+func Save(name string, entry *Entry) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(name), filepath.Base(name)+".*")
+	if err != nil {
+		return err
+	}
+	if err := Write(tmp, entry); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), name)
+}
+
+// Cache is an opened cache file. Its memory stays mapped until Close.
+type Cache struct {
+	data     []byte
+	sections map[uint32]*section
+	deps     []Dependency
+}
+
+type section struct {
+	data    []byte
+	crc     uint32
+	checked bool
+}
+
+// Open maps the cache file name and checks its version and the checksums
+// of the section table and the dependencies
+func Open(name string) (*Cache, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	data, err := mmap(file, int(info.Size()))
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Cache{data: data, sections: map[uint32]*section{}}
+	if err := c.parse(); err != nil {
+		munmap(data)
+		return nil, &objparser.ParseError{File: name, Err: err}
+	}
+	return c, nil
+}
+
+func (c *Cache) parse() error {
+	data := c.data
+	if len(data) < headerSize || string(data[:4]) != magic {
+		return ErrFormat
+	}
+	le := binary.LittleEndian
+	if le.Uint32(data[4:]) != Version {
+		return ErrVersion
+	}
+	n := int(le.Uint32(data[8:]))
+	if n > (len(data)-headerSize)/entrySize {
+		return ErrCorrupt
+	}
+	table := data[headerSize : headerSize+n*entrySize]
+	if le.Uint32(data[12:]) != crc32.Checksum(table, castagnoli) {
+		return ErrChecksum
+	}
+	d := &decoder{data: table}
+	for i := 0; i < n; i++ {
+		id, crc := d.u32(), d.u32()
+		offset, length := d.u64(), d.u64()
+		if offset%alignment != 0 || offset > uint64(len(data)) || length > uint64(len(data))-offset {
+			return ErrCorrupt
+		}
+		c.sections[id] = &section{data: data[offset : offset+length], crc: crc}
+	}
+
+	deps, err := c.section(sectionDependencies)
+	if err != nil {
+		return err
+	}
+	d = &decoder{data: deps}
+	c.deps = make([]Dependency, d.count(20))
+	for i := range c.deps {
+		c.deps[i] = Dependency{Path: d.str(), Size: int64(d.u64()), ModTime: int64(d.u64())}
+	}
+	return d.err
+}
+
+// section returns the section id, checked against its checksum on first
+// use. Missing sections are empty.
+func (c *Cache) section(id uint32) ([]byte, error) {
+	s := c.sections[id]
+	if s == nil {
+		return nil, nil
+	}
+	if !s.checked {
+		if crc32.Checksum(s.data, castagnoli) != s.crc {
+			return nil, ErrChecksum
+		}
+		s.checked = true
+	}
+	return s.data, nil
+}
+
+// Dependencies returns the files the cached mesh was loaded from
+func (c *Cache) Dependencies() []Dependency {
+	return c.deps
+}
+
+// Stale reports whether one of the dependencies changed, is gone or, for
+// missing ones, exists now since the cache was written
+func (c *Cache) Stale() bool {
+	for _, d := range c.deps {
+		now, err := Stat(d.Path)
+		if d.Size < 0 {
+			if !os.IsNotExist(err) {
+				return true
+			}
+			continue
+		}
+		if err != nil || now != d {
+			return true
+		}
+	}
+	return false
+}
+
+// Mesh decodes the cached mesh with the warnings of its load. Mesh.Atlas
+// is not cached, use Mesh.LoadTextures to build it again.
+func (c *Cache) Mesh() (*objparser.Mesh, error) {
+	data, err := c.section(sectionMesh)
+	if err != nil {
+		return nil, err
+	}
+	m, err := decodeMesh(&decoder{data: data})
+	if err != nil {
+		return nil, err
+	}
+	if m.Warnings, err = c.Warnings(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Warnings decodes the warnings of the load of the cached mesh. Their
+// errors only keep the message, errors.Is does not match them anymore.
+func (c *Cache) Warnings() ([]*objparser.ParseError, error) {
+	data, err := c.section(sectionWarnings)
+	if err != nil {
+		return nil, err
+	}
+	return decodeWarnings(&decoder{data: data})
+}
+
+// Triangles returns the triangles of the mesh the way the renderer
+// uploads them. On little endian hosts the slice points into the mapped
+// file and is only valid until Close.
+func (c *Cache) Triangles() ([]objparser.Triangle, error) {
+	data, err := c.section(sectionTriangles)
+	if err != nil {
+		return nil, err
+	}
+	const size = int(unsafe.Sizeof(objparser.Triangle{}))
+	n := len(data) / size
+	if n == 0 {
+		return []objparser.Triangle{}, nil
+	}
+	if littleEndian() {
+		return (*[math.MaxInt32 / size]objparser.Triangle)(unsafe.Pointer(&data[0]))[:n:n], nil
+	}
+
+	triangles := make([]objparser.Triangle, n)
+	d := &decoder{data: data}
+	for i := range triangles {
+		t := &triangles[i]
+		for _, v := range []*[4]float32{(*[4]float32)(&t.A), (*[4]float32)(&t.B), (*[4]float32)(&t.C), (*[4]float32)(&t.Color), (*[4]float32)(&t.Intensity)} {
+			for j := range v {
+				v[j] = d.f32()
+			}
+		}
+	}
+	return triangles, nil
+}
+
+// BVH returns the hierarchy over Triangles. On little endian hosts its
+// nodes and indices point into the mapped file and are only valid until
+// Close. Its Intersect finds nothing, the triangles are not part of it.
+func (c *Cache) BVH() (*bvh.BVH, error) {
+	h := &bvh.BVH{}
+	nodes, err := c.section(sectionNodes)
+	if err != nil {
+		return nil, err
+	}
+	indices, err := c.section(sectionIndices)
+	if err != nil {
+		return nil, err
+	}
+	const nodeSize = int(unsafe.Sizeof(bvh.Node{}))
+	n, m := len(nodes)/nodeSize, len(indices)/4
+	switch {
+	case n == 0:
+		h.Nodes = []bvh.Node{}
+	case littleEndian():
+		h.Nodes = (*[math.MaxInt32 / nodeSize]bvh.Node)(unsafe.Pointer(&nodes[0]))[:n:n]
+	default:
+		h.Nodes = make([]bvh.Node, n)
+		d := &decoder{data: nodes}
+		for i := range h.Nodes {
+			h.Nodes[i] = bvh.Node{Min: d.vec3(), LeftFirst: int32(d.u32()), Max: d.vec3(), Count: int32(d.u32())}
+		}
+	}
+	switch {
+	case m == 0:
+		h.Indices = []int32{}
+	case littleEndian():
+		h.Indices = (*[math.MaxInt32 / 4]int32)(unsafe.Pointer(&indices[0]))[:m:m]
+	default:
+		h.Indices = make([]int32, m)
+		d := &decoder{data: indices}
+		for i := range h.Indices {
+			h.Indices[i] = int32(d.u32())
+		}
+	}
+
+	// the shader trusts the hierarchy, a cache that passed the checksum
+	// but does not fit together must not reach it
+	var triangles int32
+	if s := c.sections[sectionTriangles]; s != nil {
+		triangles = int32(len(s.data) / int(unsafe.Sizeof(objparser.Triangle{})))
+	}
+	// children come after their parents, so the depths are known in order
+	depths := make([]int, n)
+	for i := range h.Nodes {
+		node := &h.Nodes[i]
+		if node.Count < 0 || node.LeftFirst < 0 {
+			return nil, ErrCorrupt
+		}
+		if node.Leaf() {
+			if int(node.LeftFirst)+int(node.Count) > m {
+				return nil, ErrCorrupt
+			}
+			continue
+		}
+		left := int(node.LeftFirst)
+		if left <= i || left+1 >= n || depths[i] >= bvh.MaxDepth {
+			return nil, ErrCorrupt
+		}
+		depths[left], depths[left+1] = depths[i]+1, depths[i]+1
+	}
+	for _, i := range h.Indices {
+		if i < 0 || i >= triangles {
+			return nil, ErrCorrupt
+		}
+	}
+	return h, nil
+}
+
+func littleEndian() bool {
+	x := uint16(1)
+	return *(*byte)(unsafe.Pointer(&x)) == 1
+}
+
+// Close unmaps the file, slices returned by Triangles and BVH must not be
+// used after
+func (c *Cache) Close() error {
+	data := c.data
+	c.data, c.sections = nil, nil
+	return munmap(data)
+}
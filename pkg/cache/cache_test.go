@@ -0,0 +1,319 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/supermuesli/computeshader/pkg/bvh"
+	"github.com/supermuesli/computeshader/pkg/objparser"
+)
+
+func tempDir(t *testing.T) (string, func()) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+// testEntry is a quad with a material, a group and a warning
+func testEntry() *Entry {
+	m := &objparser.Mesh{
+		Vertices: []objparser.Vertex{
+			{Position: mgl32.Vec3{0, 0, 0}, Normal: mgl32.Vec3{0, 0, 1}, Flags: objparser.HasNormals},
+			{Position: mgl32.Vec3{1, 0, 0}, UV: mgl32.Vec2{1, 0}, Flags: objparser.HasUVs},
+			{Position: mgl32.Vec3{1, 1, 0}, Color: mgl32.Vec3{1, 0, 0}, Flags: objparser.HasColors},
+			{Position: mgl32.Vec3{0, 1, 0}},
+		},
+		Indices:       []uint32{0, 1, 2, 0, 2, 3},
+		FaceMaterials: []int32{0, -1},
+		FaceSmoothing: []uint32{1, 1},
+		Materials:     []objparser.Material{objparser.NewMaterial("red")},
+		Objects: []objparser.Object{
+			{Name: "quad", Groups: []objparser.Group{{Names: []string{"a", "b"}, Smoothing: 1, Start: 0, Count: 2}}},
+		},
+		Warnings: []*objparser.ParseError{{File: "quad.obj", Line: 3, Column: 1, Token: "l", Err: objparser.ErrUnsupported}},
+	}
+	m.Materials[0].Diffuse = mgl32.Vec3{1, 0, 0}
+	triangles := m.Triangles()
+	return &Entry{Mesh: m, Triangles: triangles, BVH: bvh.Build(triangles)}
+}
+
+func write(t *testing.T, entry *Entry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := Write(&buf, entry); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// open writes data to a file in dir and opens it
+func open(t *testing.T, dir string, data []byte) (*Cache, error) {
+	t.Helper()
+	name := filepath.Join(dir, "test.cssc")
+	if err := ioutil.WriteFile(name, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return Open(name)
+}
+
+// sectionOffset returns the offset of the section id in the file data
+func sectionOffset(t *testing.T, data []byte, id uint32) int {
+	t.Helper()
+	n := int(binary.LittleEndian.Uint32(data[8:]))
+	for i := 0; i < n; i++ {
+		entry := data[headerSize+i*entrySize:]
+		if binary.LittleEndian.Uint32(entry) == id {
+			return int(binary.LittleEndian.Uint64(entry[8:]))
+		}
+	}
+	t.Fatalf("no section %d", id)
+	return 0
+}
+
+func TestRoundTrip(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+
+	entry := testEntry()
+	entry.Dependencies = []Dependency{{Path: "/models/quad.obj", Size: 42, ModTime: 7}, Missing("/models/quad.mtl")}
+	c, err := open(t, dir, write(t, entry))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if !reflect.DeepEqual(c.Dependencies(), entry.Dependencies) {
+		t.Errorf("got dependencies %+v, want %+v", c.Dependencies(), entry.Dependencies)
+	}
+	m, err := c.Mesh()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := *entry.Mesh
+	want.Warnings = nil
+	got := *m
+	got.Warnings = nil
+	if !reflect.DeepEqual(&got, &want) {
+		t.Errorf("got mesh %+v, want %+v", got, want)
+	}
+	// warnings keep their message only
+	if len(m.Warnings) != 1 || m.Warnings[0].Error() != entry.Mesh.Warnings[0].Error() {
+		t.Errorf("got warnings %v, want %v", m.Warnings, entry.Mesh.Warnings)
+	}
+
+	triangles, err := c.Triangles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(triangles, entry.Triangles) {
+		t.Errorf("got triangles %v, want %v", triangles, entry.Triangles)
+	}
+	h, err := c.BVH()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(h.Nodes, entry.BVH.Nodes) || !reflect.DeepEqual(h.Indices, entry.BVH.Indices) {
+		t.Errorf("got hierarchy %+v, want %+v", h, entry.BVH)
+	}
+}
+
+func TestCorrupt(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	data := write(t, testEntry())
+
+	// damage returns a copy of data changed by f
+	damage := func(f func(d []byte) []byte) []byte {
+		return f(append([]byte{}, data...))
+	}
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"empty", nil, ErrFormat},
+		{"magic", damage(func(d []byte) []byte { d[0] = 'X'; return d }), ErrFormat},
+		{"version", damage(func(d []byte) []byte { d[4]++; return d }), ErrVersion},
+		{"section table", damage(func(d []byte) []byte { d[headerSize+8]++; return d }), ErrChecksum},
+		{"dependencies", damage(func(d []byte) []byte { d[sectionOffset(t, d, sectionDependencies)]++; return d }), ErrChecksum},
+		{"truncated section table", data[:headerSize+entrySize], ErrCorrupt},
+		{"too many sections", damage(func(d []byte) []byte { d[8] = 0xff; return d }), ErrCorrupt},
+		{"truncated sections", data[:sectionOffset(t, data, sectionIndices)], ErrCorrupt},
+	}
+	for _, tt := range tests {
+		c, err := open(t, dir, tt.data)
+		if err == nil {
+			c.Close()
+		}
+		if !errors.Is(err, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.want)
+		}
+	}
+
+	// the big sections are checked when they are used
+	for _, id := range []uint32{sectionMesh, sectionTriangles, sectionNodes, sectionIndices, sectionWarnings} {
+		c, err := open(t, dir, damage(func(d []byte) []byte { d[sectionOffset(t, d, id)]++; return d }))
+		if err != nil {
+			t.Errorf("section %d: got %v opening the cache, want an error on use", id, err)
+			continue
+		}
+		_, merr := c.Mesh()
+		_, terr := c.Triangles()
+		_, berr := c.BVH()
+		c.Close()
+		failed := map[uint32]error{sectionMesh: merr, sectionWarnings: merr, sectionTriangles: terr, sectionNodes: berr, sectionIndices: berr}[id]
+		if !errors.Is(failed, ErrChecksum) {
+			t.Errorf("section %d: got %v, want ErrChecksum", id, failed)
+		}
+	}
+}
+
+func TestCorruptMesh(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+
+	// meshes that pass the checksum but do not fit together
+	tests := []struct {
+		name   string
+		change func(m *objparser.Mesh)
+	}{
+		{"index", func(m *objparser.Mesh) { m.Indices[4] = 4 }},
+		{"material", func(m *objparser.Mesh) { m.FaceMaterials[1] = 1 }},
+		{"negative material", func(m *objparser.Mesh) { m.FaceMaterials[1] = -2 }},
+		{"face count", func(m *objparser.Mesh) { m.FaceSmoothing = m.FaceSmoothing[:1] }},
+		{"group end", func(m *objparser.Mesh) { m.Objects[0].Groups[0].Count = 3 }},
+		{"group start", func(m *objparser.Mesh) { m.Objects[0].Groups[0].Start = 2 }},
+	}
+	for _, tt := range tests {
+		entry := testEntry()
+		tt.change(entry.Mesh)
+		c, err := open(t, dir, write(t, entry))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := c.Mesh(); err != ErrCorrupt {
+			t.Errorf("%s: got %v, want ErrCorrupt", tt.name, err)
+		}
+		c.Close()
+	}
+}
+
+// chain returns a hierarchy whose left children form a chain of depth
+// internal nodes, the right children and the last left one are leaves
+func chain(depth int) *bvh.BVH {
+	h := &bvh.BVH{Nodes: []bvh.Node{{}}, Indices: []int32{0}}
+	cur := 0
+	for i := 0; i < depth; i++ {
+		left := len(h.Nodes)
+		h.Nodes[cur].LeftFirst = int32(left)
+		h.Nodes = append(h.Nodes, bvh.Node{}, bvh.Node{Count: 1})
+		cur = left
+	}
+	h.Nodes[cur].Count = 1
+	return h
+}
+
+func TestCorruptBVH(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+
+	good := testEntry().BVH
+	tests := []struct {
+		name string
+		bvh  *bvh.BVH
+		want error
+	}{
+		{"built", good, nil},
+		{"deepest", chain(bvh.MaxDepth), nil},
+		{"too deep", chain(bvh.MaxDepth + 1), ErrCorrupt},
+		{"child before parent", &bvh.BVH{Nodes: []bvh.Node{{LeftFirst: 1}, {LeftFirst: 0}, {Count: 1}}, Indices: []int32{0}}, ErrCorrupt},
+		{"child out of range", &bvh.BVH{Nodes: []bvh.Node{{LeftFirst: 2}, {Count: 1}, {Count: 1}}, Indices: []int32{0}}, ErrCorrupt},
+		{"leaf out of range", &bvh.BVH{Nodes: []bvh.Node{{LeftFirst: 0, Count: 2}}, Indices: []int32{0}}, ErrCorrupt},
+		{"triangle out of range", &bvh.BVH{Nodes: []bvh.Node{{Count: 1}}, Indices: []int32{2}}, ErrCorrupt},
+	}
+	for _, tt := range tests {
+		entry := testEntry()
+		entry.BVH = tt.bvh
+		c, err := open(t, dir, write(t, entry))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := c.BVH(); err != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.want)
+		}
+		c.Close()
+	}
+}
+
+func TestStale(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	model := filepath.Join(dir, "quad.obj")
+	mtl := filepath.Join(dir, "quad.mtl")
+	if err := ioutil.WriteFile(model, []byte("v 0 0 0\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	dep, err := Stat(model)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entry := testEntry()
+	entry.Dependencies = []Dependency{dep, Missing(mtl)}
+	name := filepath.Join(dir, "quad.cssc")
+	if err := Save(name, entry); err != nil {
+		t.Fatal(err)
+	}
+	stale := func() bool {
+		t.Helper()
+		c, err := Open(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+		return c.Stale()
+	}
+	if stale() {
+		t.Fatal("fresh cache is stale")
+	}
+
+	// a missing file that shows up
+	if err := ioutil.WriteFile(mtl, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if !stale() {
+		t.Error("cache is not stale after a missing dependency was created")
+	}
+	os.Remove(mtl)
+	if stale() {
+		t.Error("cache is stale after the new dependency was removed again")
+	}
+
+	// a changed file, with the same size and a new time
+	if err := ioutil.WriteFile(model, []byte("v 1 0 0\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Unix(0, dep.ModTime).Add(time.Second)
+	if err := os.Chtimes(model, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if !stale() {
+		t.Error("cache is not stale after a dependency changed")
+	}
+
+	os.Remove(model)
+	if !stale() {
+		t.Error("cache is not stale after a dependency was removed")
+	}
+}
@@ -0,0 +1,364 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image/png"
+	"math"
+
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/supermuesli/computeshader/pkg/objparser"
+)
+
+// encoder appends little endian values to buf
+type encoder struct {
+	buf []byte
+}
+
+func (e *encoder) u32(v uint32) {
+	e.buf = append(e.buf, byte(v), byte(v>>8), byte(v>>16), byte(v>>24))
+}
+
+func (e *encoder) u64(v uint64) {
+	e.u32(uint32(v))
+	e.u32(uint32(v >> 32))
+}
+
+func (e *encoder) f32(v float32) {
+	e.u32(math.Float32bits(v))
+}
+
+func (e *encoder) vec2(v mgl32.Vec2) {
+	e.f32(v[0])
+	e.f32(v[1])
+}
+
+func (e *encoder) vec3(v mgl32.Vec3) {
+	e.f32(v[0])
+	e.f32(v[1])
+	e.f32(v[2])
+}
+
+func (e *encoder) bytes(b []byte) {
+	e.u32(uint32(len(b)))
+	e.buf = append(e.buf, b...)
+}
+
+func (e *encoder) str(s string) {
+	e.u32(uint32(len(s)))
+	e.buf = append(e.buf, s...)
+}
+
+// decoder reads what encoder wrote, the first error sticks and all
+// further reads return zero values
+type decoder struct {
+	data []byte
+	err  error
+}
+
+func (d *decoder) next(n int) []byte {
+	if d.err != nil || n < 0 || n > len(d.data) {
+		d.err = ErrCorrupt
+		return nil
+	}
+	b := d.data[:n]
+	d.data = d.data[n:]
+	return b
+}
+
+func (d *decoder) u32() uint32 {
+	if b := d.next(4); b != nil {
+		return binary.LittleEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (d *decoder) u64() uint64 {
+	if b := d.next(8); b != nil {
+		return binary.LittleEndian.Uint64(b)
+	}
+	return 0
+}
+
+func (d *decoder) f32() float32 {
+	return math.Float32frombits(d.u32())
+}
+
+func (d *decoder) vec2() mgl32.Vec2 {
+	return mgl32.Vec2{d.f32(), d.f32()}
+}
+
+func (d *decoder) vec3() mgl32.Vec3 {
+	return mgl32.Vec3{d.f32(), d.f32(), d.f32()}
+}
+
+func (d *decoder) bytes() []byte {
+	return d.next(int(d.u32()))
+}
+
+func (d *decoder) str() string {
+	return string(d.bytes())
+}
+
+// count reads a length prefix of elements that take at least size bytes
+// each, so that corrupt lengths fail before anything is allocated
+func (d *decoder) count(size int) int {
+	n := int(d.u32())
+	if d.err == nil && n*size > len(d.data) {
+		d.err = ErrCorrupt
+	}
+	if d.err != nil {
+		return 0
+	}
+	return n
+}
+
+func encodeMesh(e *encoder, m *objparser.Mesh) error {
+	e.u32(uint32(len(m.Vertices)))
+	for _, v := range m.Vertices {
+		e.vec3(v.Position)
+		e.vec3(v.Normal)
+		e.vec2(v.UV)
+		e.vec3(v.Color)
+		e.u32(uint32(v.Flags))
+	}
+	e.u32(uint32(len(m.Indices)))
+	for _, idx := range m.Indices {
+		e.u32(idx)
+	}
+	e.u32(uint32(len(m.FaceMaterials)))
+	for _, mat := range m.FaceMaterials {
+		e.u32(uint32(mat))
+	}
+	e.u32(uint32(len(m.FaceSmoothing)))
+	for _, s := range m.FaceSmoothing {
+		e.u32(s)
+	}
+
+	e.u32(uint32(len(m.Materials)))
+	for i := range m.Materials {
+		if err := encodeMaterial(e, &m.Materials[i]); err != nil {
+			return err
+		}
+	}
+
+	e.u32(uint32(len(m.Objects)))
+	for _, obj := range m.Objects {
+		e.str(obj.Name)
+		e.u32(uint32(len(obj.Groups)))
+		for _, g := range obj.Groups {
+			e.u32(uint32(len(g.Names)))
+			for _, name := range g.Names {
+				e.str(name)
+			}
+			e.u32(g.Smoothing)
+			e.u32(uint32(g.Start))
+			e.u32(uint32(g.Count))
+		}
+	}
+	return nil
+}
+
+func decodeMesh(d *decoder) (*objparser.Mesh, error) {
+	m := &objparser.Mesh{}
+	m.Vertices = make([]objparser.Vertex, d.count(52))
+	for i := range m.Vertices {
+		v := &m.Vertices[i]
+		v.Position = d.vec3()
+		v.Normal = d.vec3()
+		v.UV = d.vec2()
+		v.Color = d.vec3()
+		v.Flags = objparser.AttributeFlags(d.u32())
+	}
+	m.Indices = make([]uint32, d.count(4))
+	for i := range m.Indices {
+		m.Indices[i] = d.u32()
+	}
+	m.FaceMaterials = make([]int32, d.count(4))
+	for i := range m.FaceMaterials {
+		m.FaceMaterials[i] = int32(d.u32())
+	}
+	m.FaceSmoothing = make([]uint32, d.count(4))
+	for i := range m.FaceSmoothing {
+		m.FaceSmoothing[i] = d.u32()
+	}
+
+	// nil like the loaders leave it for models without materials
+	if n := d.count(4); n > 0 {
+		m.Materials = make([]objparser.Material, n)
+	}
+	for i := range m.Materials {
+		m.Materials[i] = decodeMaterial(d)
+	}
+
+	m.Objects = make([]objparser.Object, d.count(8))
+	for i := range m.Objects {
+		obj := &m.Objects[i]
+		obj.Name = d.str()
+		obj.Groups = make([]objparser.Group, d.count(16))
+		for j := range obj.Groups {
+			g := &obj.Groups[j]
+			g.Names = make([]string, d.count(4))
+			for k := range g.Names {
+				g.Names[k] = d.str()
+			}
+			g.Smoothing = d.u32()
+			g.Start = int(d.u32())
+			g.Count = int(d.u32())
+		}
+	}
+
+	if d.err != nil {
+		return nil, d.err
+	}
+	// a cache that passed the checksum but does not fit together
+	if len(m.Indices) != 3*len(m.FaceMaterials) || len(m.FaceMaterials) != len(m.FaceSmoothing) {
+		return nil, ErrCorrupt
+	}
+	for _, idx := range m.Indices {
+		if int(idx) >= len(m.Vertices) {
+			return nil, ErrCorrupt
+		}
+	}
+	for _, mat := range m.FaceMaterials {
+		if mat < -1 || int(mat) >= len(m.Materials) {
+			return nil, ErrCorrupt
+		}
+	}
+	for _, obj := range m.Objects {
+		for _, g := range obj.Groups {
+			if g.Start < 0 || g.Count < 0 || g.Start+g.Count > len(m.FaceMaterials) {
+				return nil, ErrCorrupt
+			}
+		}
+	}
+	return m, nil
+}
+
+func encodeMaterial(e *encoder, m *objparser.Material) error {
+	e.str(m.Name)
+	e.vec3(m.Ambient)
+	e.vec3(m.Diffuse)
+	e.vec3(m.Specular)
+	e.vec3(m.Emissive)
+	e.f32(m.SpecularExponent)
+	e.f32(m.OpticalDensity)
+	e.f32(m.Dissolve)
+	e.vec3(m.TransmissionFilter)
+	e.u32(uint32(m.Illum))
+	e.f32(m.Roughness)
+	e.f32(m.Metallic)
+	for _, tm := range materialMaps(m) {
+		if err := encodeTextureMap(e, *tm); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func decodeMaterial(d *decoder) objparser.Material {
+	var m objparser.Material
+	m.Name = d.str()
+	m.Ambient = d.vec3()
+	m.Diffuse = d.vec3()
+	m.Specular = d.vec3()
+	m.Emissive = d.vec3()
+	m.SpecularExponent = d.f32()
+	m.OpticalDensity = d.f32()
+	m.Dissolve = d.f32()
+	m.TransmissionFilter = d.vec3()
+	m.Illum = int(int32(d.u32()))
+	m.Roughness = d.f32()
+	m.Metallic = d.f32()
+	for _, tm := range materialMaps(&m) {
+		*tm = decodeTextureMap(d)
+	}
+	return m
+}
+
+// materialMaps returns pointers to all texture map fields of m in a fixed order
+func materialMaps(m *objparser.Material) []**objparser.TextureMap {
+	return []**objparser.TextureMap{
+		&m.AmbientMap, &m.DiffuseMap, &m.SpecularMap, &m.EmissiveMap,
+		&m.SpecularExponentMap, &m.DissolveMap, &m.BumpMap, &m.DisplacementMap,
+		&m.RoughnessMap, &m.MetallicMap,
+	}
+}
+
+// encodeTextureMap writes a presence flag and tm, embedded images are
+// stored as png
+func encodeTextureMap(e *encoder, tm *objparser.TextureMap) error {
+	if tm == nil {
+		e.u32(0)
+		return nil
+	}
+	e.u32(1)
+	e.str(tm.Path)
+	e.vec3(tm.Scale)
+	e.vec3(tm.Offset)
+	e.f32(tm.BumpMultiplier)
+	clamp := uint32(0)
+	if tm.Clamp {
+		clamp = 1
+	}
+	e.u32(clamp)
+
+	var img bytes.Buffer
+	if tm.Image != nil {
+		if err := png.Encode(&img, tm.Image); err != nil {
+			return err
+		}
+	}
+	e.bytes(img.Bytes())
+	return nil
+}
+
+func decodeTextureMap(d *decoder) *objparser.TextureMap {
+	if d.u32() == 0 {
+		return nil
+	}
+	tm := &objparser.TextureMap{}
+	tm.Path = d.str()
+	tm.Scale = d.vec3()
+	tm.Offset = d.vec3()
+	tm.BumpMultiplier = d.f32()
+	tm.Clamp = d.u32() != 0
+	if img := d.bytes(); len(img) > 0 && d.err == nil {
+		var err error
+		if tm.Image, err = png.Decode(bytes.NewReader(img)); err != nil {
+			d.err = ErrCorrupt
+		}
+	}
+	return tm
+}
+
+func encodeWarnings(e *encoder, warnings []*objparser.ParseError) {
+	e.u32(uint32(len(warnings)))
+	for _, w := range warnings {
+		e.str(w.File)
+		e.u32(uint32(w.Line))
+		e.u32(uint32(w.Column))
+		e.str(w.Token)
+		msg := ""
+		if w.Err != nil {
+			msg = w.Err.Error()
+		}
+		e.str(msg)
+	}
+}
+
+func decodeWarnings(d *decoder) ([]*objparser.ParseError, error) {
+	warnings := make([]*objparser.ParseError, d.count(20))
+	for i := range warnings {
+		w := &objparser.ParseError{File: d.str(), Line: int(d.u32()), Column: int(d.u32()), Token: d.str()}
+		if msg := d.str(); msg != "" {
+			w.Err = errors.New(msg)
+		}
+		warnings[i] = w
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	return warnings, nil
+}
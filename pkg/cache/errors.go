@@ -0,0 +1,12 @@
+package cache
+
+import (
+	"errors"
+)
+
+var (
+	ErrFormat   = errors.New("not a scene cache file")
+	ErrVersion  = errors.New("unsupported scene cache version")
+	ErrChecksum = errors.New("scene cache checksum mismatch")
+	ErrCorrupt  = errors.New("corrupt scene cache")
+)
@@ -0,0 +1,20 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
+
+package cache
+
+import (
+	"io"
+	"os"
+)
+
+// mmap reads the first size bytes of f, there is no mapping on this platform
+func mmap(f *os.File, size int) ([]byte, error) {
+	data := make([]byte, size)
+	_, err := io.ReadFull(f, data)
+	return data, err
+}
+
+func munmap(data []byte) error {
+	return nil
+}
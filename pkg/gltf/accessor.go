@@ -0,0 +1,235 @@
+package gltf
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/url"
+	s "strings"
+
+	"github.com/supermuesli/computeshader/pkg/objparser"
+)
+
+// buffer returns the contents of buffers[i], reading it on first use
+func (d *decoder) buffer(i int) ([]byte, error) {
+	path := fmt.Sprintf("buffers[%d]", i)
+	if i < 0 || i >= len(d.doc.Buffers) {
+		return nil, d.errorAt(path, ErrIndex)
+	}
+	if d.buffers[i] != nil {
+		return d.buffers[i], nil
+	}
+
+	b := d.doc.Buffers[i]
+	var data []byte
+	switch {
+	case b.URI == "":
+		// the binary chunk of a .glb file
+		if i != 0 || d.bin == nil {
+			return nil, d.errorAt(path+".uri", ErrMissing)
+		}
+		data = d.bin
+	case s.HasPrefix(b.URI, "data:"):
+		var err error
+		if data, err = decodeDataURI(b.URI); err != nil {
+			return nil, d.errorAt(path+".uri", err)
+		}
+	default:
+		var err error
+		if data, err = d.readFile(b.URI); err != nil {
+			return nil, d.errorAt(path+".uri", err)
+		}
+	}
+
+	if len(data) < b.ByteLength {
+		return nil, d.errorAt(path+".byteLength", ErrIndex)
+	}
+	d.buffers[i] = data[:b.ByteLength]
+	return d.buffers[i], nil
+}
+
+// readFile reads the file uri refers to relative to the glTF file
+func (d *decoder) readFile(uri string) ([]byte, error) {
+	name, err := d.resolve(uri)
+	if err != nil {
+		return nil, err
+	}
+	file, err := d.resolver.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ioutil.ReadAll(file)
+}
+
+// resolve returns the Resolver name of a relative uri, uris are percent
+// encoded
+func (d *decoder) resolve(uri string) (string, error) {
+	ref, err := url.PathUnescape(uri)
+	if err != nil {
+		return "", err
+	}
+	return objparser.Resolve(d.name, ref), nil
+}
+
+// decodeDataURI returns the payload of a base64 "data:" uri
+func decodeDataURI(uri string) ([]byte, error) {
+	comma := s.IndexByte(uri, ',')
+	if comma < 0 || !s.HasSuffix(uri[:comma], ";base64") {
+		return nil, fmt.Errorf("%w: data uri without base64 payload", ErrUnsupported)
+	}
+	return base64.StdEncoding.DecodeString(uri[comma+1:])
+}
+
+// bufferView returns the bytes of bufferViews[i] and its stride, which is 0
+// if the elements are tightly packed
+func (d *decoder) bufferView(i int) ([]byte, int, error) {
+	path := fmt.Sprintf("bufferViews[%d]", i)
+	if i < 0 || i >= len(d.doc.BufferViews) {
+		return nil, 0, d.errorAt(path, ErrIndex)
+	}
+	v := d.doc.BufferViews[i]
+	data, err := d.buffer(v.Buffer)
+	if err != nil {
+		return nil, 0, err
+	}
+	if v.ByteOffset < 0 || v.ByteLength < 0 || v.ByteOffset+v.ByteLength > len(data) {
+		return nil, 0, d.errorAt(path, ErrIndex)
+	}
+	return data[v.ByteOffset : v.ByteOffset+v.ByteLength], v.ByteStride, nil
+}
+
+var componentCount = map[string]int{
+	"SCALAR": 1,
+	"VEC2":   2,
+	"VEC3":   3,
+	"VEC4":   4,
+	"MAT2":   4,
+	"MAT3":   9,
+	"MAT4":   16,
+}
+
+var componentSize = map[int]int{
+	typeByte:          1,
+	typeUnsignedByte:  1,
+	typeShort:         2,
+	typeUnsignedShort: 2,
+	typeUnsignedInt:   4,
+	typeFloat:         4,
+}
+
+// elements checks that accessors[i] is of type typ and returns it with its
+// data, element e starts at data[e*stride:]. data is nil for accessors
+// without buffer view, which are all zeros.
+func (d *decoder) elements(i int, typ string) (a *accessor, data []byte, stride int, err error) {
+	path := fmt.Sprintf("accessors[%d]", i)
+	if i < 0 || i >= len(d.doc.Accessors) {
+		return nil, nil, 0, d.errorAt(path, ErrIndex)
+	}
+	a = &d.doc.Accessors[i]
+
+	size := componentSize[a.ComponentType] * componentCount[a.Type]
+	if a.Type != typ || size == 0 || a.Count < 0 {
+		return nil, nil, 0, d.errorAt(path, ErrAccessor)
+	}
+	if a.Sparse != nil {
+		return nil, nil, 0, d.errorAt(path+".sparse", ErrUnsupported)
+	}
+	if a.BufferView == nil || a.Count == 0 {
+		return a, nil, size, nil
+	}
+
+	view, stride, err := d.bufferView(*a.BufferView)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	if stride == 0 {
+		stride = size
+	}
+	if a.ByteOffset < 0 || stride < size || a.ByteOffset+(a.Count-1)*stride+size > len(view) {
+		return nil, nil, 0, d.errorAt(path, ErrAccessor)
+	}
+	return a, view[a.ByteOffset:], stride, nil
+}
+
+// floats reads accessors[i] of the given type as float32, normalized
+// integers are mapped to 0 to 1 or -1 to 1
+func (d *decoder) floats(i int, typ string) ([]float32, error) {
+	a, data, stride, err := d.elements(i, typ)
+	if err != nil {
+		return nil, err
+	}
+	n := componentCount[typ]
+	out := make([]float32, a.Count*n)
+	if data == nil {
+		return out, nil
+	}
+
+	le := binary.LittleEndian
+	size := componentSize[a.ComponentType]
+	for e := 0; e < a.Count; e++ {
+		elem := data[e*stride:]
+		for c := 0; c < n; c++ {
+			b := elem[c*size:]
+			var f float32
+			switch a.ComponentType {
+			case typeFloat:
+				f = math.Float32frombits(le.Uint32(b))
+			case typeUnsignedByte:
+				f = float32(b[0])
+				if a.Normalized {
+					f /= math.MaxUint8
+				}
+			case typeByte:
+				f = float32(int8(b[0]))
+				if a.Normalized {
+					f = float32(math.Max(float64(f)/math.MaxInt8, -1))
+				}
+			case typeUnsignedShort:
+				f = float32(le.Uint16(b))
+				if a.Normalized {
+					f /= math.MaxUint16
+				}
+			case typeShort:
+				f = float32(int16(le.Uint16(b)))
+				if a.Normalized {
+					f = float32(math.Max(float64(f)/math.MaxInt16, -1))
+				}
+			case typeUnsignedInt:
+				f = float32(le.Uint32(b))
+			}
+			out[e*n+c] = f
+		}
+	}
+	return out, nil
+}
+
+// indices reads the scalar unsigned accessors[i] of a primitive
+func (d *decoder) indices(i int) ([]uint32, error) {
+	a, data, stride, err := d.elements(i, "SCALAR")
+	if err != nil {
+		return nil, err
+	}
+	out := make([]uint32, a.Count)
+	if data == nil {
+		return out, nil
+	}
+
+	le := binary.LittleEndian
+	for e := range out {
+		b := data[e*stride:]
+		switch a.ComponentType {
+		case typeUnsignedByte:
+			out[e] = uint32(b[0])
+		case typeUnsignedShort:
+			out[e] = uint32(le.Uint16(b))
+		case typeUnsignedInt:
+			out[e] = le.Uint32(b)
+		default:
+			return nil, d.errorAt(fmt.Sprintf("accessors[%d].componentType", i), ErrAccessor)
+		}
+	}
+	return out, nil
+}
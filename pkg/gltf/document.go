@@ -0,0 +1,147 @@
+package gltf
+
+// the parts of the glTF 2.0 json schema the importer uses, see
+// https://registry.khronos.org/glTF/specs/2.0/glTF-2.0.html
+
+type document struct {
+	Asset struct {
+		Version    string `json:"version"`
+		MinVersion string `json:"minVersion"`
+	} `json:"asset"`
+	ExtensionsRequired []string `json:"extensionsRequired"`
+
+	Scene       *int         `json:"scene"`
+	Scenes      []scene      `json:"scenes"`
+	Nodes       []node       `json:"nodes"`
+	Meshes      []mesh       `json:"meshes"`
+	Accessors   []accessor   `json:"accessors"`
+	BufferViews []bufferView `json:"bufferViews"`
+	Buffers     []buffer     `json:"buffers"`
+	Materials   []material   `json:"materials"`
+	Textures    []texture    `json:"textures"`
+	Images      []imageRef   `json:"images"`
+	Samplers    []sampler    `json:"samplers"`
+}
+
+type scene struct {
+	Name  string `json:"name"`
+	Nodes []int  `json:"nodes"`
+}
+
+type node struct {
+	Name     string `json:"name"`
+	Children []int  `json:"children"`
+	Mesh     *int   `json:"mesh"`
+	// either Matrix or translation, rotation and scale
+	Matrix      *[16]float32 `json:"matrix"`
+	Translation *[3]float32  `json:"translation"`
+	Rotation    *[4]float32  `json:"rotation"`
+	Scale       *[3]float32  `json:"scale"`
+}
+
+type mesh struct {
+	Name       string      `json:"name"`
+	Primitives []primitive `json:"primitives"`
+}
+
+type primitive struct {
+	Attributes map[string]int `json:"attributes"`
+	Indices    *int           `json:"indices"`
+	Material   *int           `json:"material"`
+	Mode       *int           `json:"mode"`
+}
+
+// primitive modes
+const (
+	modePoints = iota
+	modeLines
+	modeLineLoop
+	modeLineStrip
+	modeTriangles
+	modeTriangleStrip
+	modeTriangleFan
+)
+
+type accessor struct {
+	BufferView    *int        `json:"bufferView"`
+	ByteOffset    int         `json:"byteOffset"`
+	ComponentType int         `json:"componentType"`
+	Normalized    bool        `json:"normalized"`
+	Count         int         `json:"count"`
+	Type          string      `json:"type"`
+	Sparse        interface{} `json:"sparse"`
+}
+
+// component types
+const (
+	typeByte          = 5120
+	typeUnsignedByte  = 5121
+	typeShort         = 5122
+	typeUnsignedShort = 5123
+	typeUnsignedInt   = 5125
+	typeFloat         = 5126
+)
+
+type bufferView struct {
+	Buffer     int `json:"buffer"`
+	ByteOffset int `json:"byteOffset"`
+	ByteLength int `json:"byteLength"`
+	ByteStride int `json:"byteStride"`
+}
+
+type buffer struct {
+	URI        string `json:"uri"`
+	ByteLength int    `json:"byteLength"`
+}
+
+type material struct {
+	Name                 string `json:"name"`
+	PbrMetallicRoughness struct {
+		BaseColorFactor          *[4]float32  `json:"baseColorFactor"`
+		BaseColorTexture         *textureInfo `json:"baseColorTexture"`
+		MetallicFactor           *float32     `json:"metallicFactor"`
+		RoughnessFactor          *float32     `json:"roughnessFactor"`
+		MetallicRoughnessTexture *textureInfo `json:"metallicRoughnessTexture"`
+	} `json:"pbrMetallicRoughness"`
+	NormalTexture   *textureInfo `json:"normalTexture"`
+	EmissiveTexture *textureInfo `json:"emissiveTexture"`
+	EmissiveFactor  [3]float32   `json:"emissiveFactor"`
+	AlphaMode       string       `json:"alphaMode"`
+	Extensions      struct {
+		IOR *struct {
+			IOR *float32 `json:"ior"`
+		} `json:"KHR_materials_ior"`
+		Transmission *struct {
+			TransmissionFactor float32 `json:"transmissionFactor"`
+		} `json:"KHR_materials_transmission"`
+		EmissiveStrength *struct {
+			EmissiveStrength *float32 `json:"emissiveStrength"`
+		} `json:"KHR_materials_emissive_strength"`
+	} `json:"extensions"`
+}
+
+type textureInfo struct {
+	Index    int `json:"index"`
+	TexCoord int `json:"texCoord"`
+	// only set for normal textures
+	Scale *float32 `json:"scale"`
+}
+
+type texture struct {
+	Sampler *int `json:"sampler"`
+	Source  *int `json:"source"`
+}
+
+type imageRef struct {
+	Name       string `json:"name"`
+	URI        string `json:"uri"`
+	MimeType   string `json:"mimeType"`
+	BufferView *int   `json:"bufferView"`
+}
+
+type sampler struct {
+	WrapS *int `json:"wrapS"`
+	WrapT *int `json:"wrapT"`
+}
+
+const clampToEdge = 33071
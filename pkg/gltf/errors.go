@@ -0,0 +1,15 @@
+package gltf
+
+import (
+	"errors"
+)
+
+var (
+	ErrFormat      = errors.New("not a glTF 2.0 file")
+	ErrVersion     = errors.New("unsupported glTF version")
+	ErrIndex       = errors.New("index out of range")
+	ErrAccessor    = errors.New("malformed accessor")
+	ErrMissing     = errors.New("missing required property")
+	ErrCycle       = errors.New("node hierarchy is not a tree")
+	ErrUnsupported = errors.New("unsupported feature")
+)
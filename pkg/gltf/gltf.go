@@ -0,0 +1,200 @@
+// Package gltf imports glTF 2.0 scenes, both .gltf json files with external
+// or embedded buffers and binary .glb containers, into the mesh and
+// material types of objparser.
+package gltf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/supermuesli/computeshader/pkg/objparser"
+)
+
+// Loader configures how glTF files are imported. The zero value is ready to use.
+type Loader struct {
+	// Lenient skips primitives and textures that cannot be imported and
+	// reports them as warnings instead of failing the whole file.
+	Lenient bool
+	// LoadTextures decodes the texture maps of all materials into Mesh.Atlas
+	LoadTextures bool
+	// Resolver opens the glTF file and the buffers and images it refers
+	// to, like objparser.Loader.Resolver. Files are read from disk if it is nil.
+	Resolver objparser.Resolver
+}
+
+// Load imports the .gltf or .glb file at path with the default Loader
+func Load(path string) (*objparser.Mesh, error) {
+	var l Loader
+	return l.Load(path)
+}
+
+// Load imports the .gltf or .glb file name, which is a path on disk or a
+// name for l.Resolver
+func (l *Loader) Load(name string) (*objparser.Mesh, error) {
+	res := l.resolver()
+	if l.Resolver == nil {
+		name = filepath.ToSlash(name)
+	}
+
+	file, err := res.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return l.Parse(file, name)
+}
+
+// Parse reads a .gltf or .glb file from in, the format is detected from
+// the content. name is used in errors and to resolve external buffers and
+// images.
+func (l *Loader) Parse(in io.Reader, name string) (*objparser.Mesh, error) {
+	data, err := ioutil.ReadAll(in)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &decoder{lenient: l.Lenient, resolver: l.resolver(), name: name, mesh: &objparser.Mesh{}}
+	if bytes.HasPrefix(data, []byte(glbMagic)) {
+		if data, d.bin, err = splitGLB(data); err != nil {
+			return nil, d.errorAt("", err)
+		}
+	}
+	if err := json.Unmarshal(data, &d.doc); err != nil {
+		return nil, d.errorAt("", fmt.Errorf("%w: %v", ErrFormat, err))
+	}
+
+	if err := d.decode(); err != nil {
+		return nil, err
+	}
+	if l.LoadTextures {
+		d.mesh.LoadTextures(d.resolver)
+	}
+	return d.mesh, nil
+}
+
+func (l *Loader) resolver() objparser.Resolver {
+	if l.Resolver == nil {
+		return objparser.DiskResolver
+	}
+	return l.Resolver
+}
+
+const (
+	glbMagic   = "glTF"
+	glbVersion = 2
+	chunkJSON  = 0x4E4F534A
+	chunkBIN   = 0x004E4942
+)
+
+// splitGLB returns the json and the binary chunk of a .glb container, bin
+// is nil if the file has none
+func splitGLB(data []byte) (js, bin []byte, err error) {
+	le := binary.LittleEndian
+	if len(data) < 12 {
+		return nil, nil, ErrFormat
+	}
+	if le.Uint32(data[4:]) != glbVersion {
+		return nil, nil, ErrVersion
+	}
+	length := le.Uint32(data[8:])
+	if length < 12 || uint64(length) > uint64(len(data)) {
+		return nil, nil, ErrFormat
+	}
+	data = data[12:length]
+
+	for i := 0; len(data) > 0; i++ {
+		if len(data) < 8 {
+			return nil, nil, ErrFormat
+		}
+		size, kind := le.Uint32(data), le.Uint32(data[4:])
+		if uint64(size) > uint64(len(data)-8) {
+			return nil, nil, ErrFormat
+		}
+		chunk := data[8 : 8+size]
+		data = data[8+size:]
+
+		switch {
+		case i == 0 && kind == chunkJSON:
+			js = chunk
+		case i == 0:
+			// the json chunk has to come first
+			return nil, nil, ErrFormat
+		case i == 1 && kind == chunkBIN:
+			bin = chunk
+		}
+		// chunks of unknown type are skipped as the spec asks
+	}
+	return js, bin, nil
+}
+
+// decoder turns a parsed document into a Mesh
+type decoder struct {
+	lenient  bool
+	resolver objparser.Resolver
+	name     string
+	doc      document
+	// the binary chunk of a .glb file
+	bin []byte
+	// loaded lazily, nil until first use
+	buffers [][]byte
+	// decoded embedded images, nil until first use
+	images map[int]*objparser.TextureMap
+	mesh   *objparser.Mesh
+}
+
+// errorAt returns an error for the json property at path, e.g.
+// "meshes[0].primitives[1].indices"
+func (d *decoder) errorAt(path string, err error) *objparser.ParseError {
+	return &objparser.ParseError{File: d.name, Token: path, Err: err}
+}
+
+func (d *decoder) warn(path string, err error) {
+	d.mesh.Warnings = append(d.mesh.Warnings, d.errorAt(path, err))
+}
+
+// unsupported fails in strict mode and records a warning in lenient mode
+func (d *decoder) unsupported(path string) error {
+	if !d.lenient {
+		return d.errorAt(path, ErrUnsupported)
+	}
+	d.warn(path, ErrUnsupported)
+	return nil
+}
+
+// supportedExtensions are the extensions the importer understands, files
+// that require any other one are rejected
+var supportedExtensions = map[string]bool{
+	"KHR_materials_ior":               true,
+	"KHR_materials_transmission":      true,
+	"KHR_materials_emissive_strength": true,
+}
+
+func (d *decoder) decode() error {
+	asset := d.doc.Asset
+	if asset.Version == "" {
+		return d.errorAt("asset.version", ErrMissing)
+	}
+	if asset.MinVersion != "" && asset.MinVersion != "2.0" {
+		return d.errorAt("asset.minVersion", ErrVersion)
+	}
+	if asset.Version[0] != '2' || (len(asset.Version) > 1 && asset.Version[1] != '.') {
+		return d.errorAt("asset.version", ErrVersion)
+	}
+	for _, ext := range d.doc.ExtensionsRequired {
+		if !supportedExtensions[ext] {
+			return d.errorAt("extensionsRequired", fmt.Errorf("%w: %s", ErrUnsupported, ext))
+		}
+	}
+
+	d.buffers = make([][]byte, len(d.doc.Buffers))
+	if err := d.materials(); err != nil {
+		return err
+	}
+	return d.scene()
+}
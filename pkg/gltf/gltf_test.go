@@ -0,0 +1,383 @@
+package gltf
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/supermuesli/computeshader/pkg/objparser"
+)
+
+// fixture builds the binary buffer of a test file, with a buffer view and
+// an accessor per array
+type fixture struct {
+	bin       bytes.Buffer
+	views     []string
+	accessors []string
+}
+
+// add appends data, a slice of float32, uint16 or uint32, as count
+// elements of type typ and returns the index of its accessor
+func (f *fixture) add(data interface{}, typ string, count int) int {
+	componentType := typeFloat
+	switch data.(type) {
+	case []uint16:
+		componentType = typeUnsignedShort
+	case []uint32:
+		componentType = typeUnsignedInt
+	}
+	start := f.bin.Len()
+	binary.Write(&f.bin, binary.LittleEndian, data)
+	for f.bin.Len()%4 != 0 {
+		f.bin.WriteByte(0)
+	}
+	f.views = append(f.views, fmt.Sprintf(`{"buffer": 0, "byteOffset": %d, "byteLength": %d}`, start, f.bin.Len()-start))
+	f.accessors = append(f.accessors, fmt.Sprintf(`{"bufferView": %d, "componentType": %d, "count": %d, "type": %q}`,
+		len(f.views)-1, componentType, count, typ))
+	return len(f.accessors) - 1
+}
+
+// json returns the document with the buffer at uri, rest are the other
+// top level properties
+func (f *fixture) json(uri, rest string) string {
+	if uri != "" {
+		uri = fmt.Sprintf(`, "uri": %q`, uri)
+	}
+	return fmt.Sprintf(`{
+		"asset": {"version": "2.0"},
+		"buffers": [{"byteLength": %d%s}],
+		"bufferViews": [%s],
+		"accessors": [%s],
+		%s
+	}`, f.bin.Len(), uri, strings.Join(f.views, ", "), strings.Join(f.accessors, ", "), rest)
+}
+
+// gltf returns a .gltf file with the buffer embedded as a base64 data uri
+func (f *fixture) gltf(rest string) []byte {
+	return []byte(f.json("data:application/octet-stream;base64,"+base64.StdEncoding.EncodeToString(f.bin.Bytes()), rest))
+}
+
+// glb returns a .glb container with the json and the buffer as chunks
+func (f *fixture) glb(rest string) []byte {
+	js := []byte(f.json("", rest))
+	for len(js)%4 != 0 {
+		js = append(js, ' ')
+	}
+	var out bytes.Buffer
+	le := binary.LittleEndian
+	out.WriteString(glbMagic)
+	binary.Write(&out, le, []uint32{glbVersion, uint32(12 + 8 + len(js) + 8 + f.bin.Len())})
+	binary.Write(&out, le, []uint32{uint32(len(js)), chunkJSON})
+	out.Write(js)
+	binary.Write(&out, le, []uint32{uint32(f.bin.Len()), chunkBIN})
+	out.Write(f.bin.Bytes())
+	return out.Bytes()
+}
+
+// triangle is a fixture with a triangle in the xy plane, accessor 0 are
+// its positions and 1 its indices
+func triangle() *fixture {
+	f := &fixture{}
+	f.add([]float32{0, 0, 0, 1, 0, 0, 0, 1, 0}, "VEC3", 3)
+	f.add([]uint16{0, 1, 2}, "SCALAR", 3)
+	return f
+}
+
+const triangleMesh = `"meshes": [{"name": "tri", "primitives": [{"attributes": {"POSITION": 0}, "indices": 1}]}]`
+
+func parse(t *testing.T, data []byte) *objparser.Mesh {
+	t.Helper()
+	var l Loader
+	m, err := l.Parse(bytes.NewReader(data), "test.gltf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+// corners returns the positions of the corners of all triangles
+func corners(m *objparser.Mesh) []mgl32.Vec3 {
+	out := []mgl32.Vec3{}
+	for _, idx := range m.Indices {
+		out = append(out, m.Vertices[idx].Position)
+	}
+	return out
+}
+
+func approxEqual(a, b []mgl32.Vec3) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Sub(b[i]).Len() > 1e-5 {
+			return false
+		}
+	}
+	return true
+}
+
+func TestNodeTransforms(t *testing.T) {
+	s := float32(math.Sqrt2 / 2)
+	tests := []struct {
+		name  string
+		nodes string
+		want  []mgl32.Vec3
+	}{
+		{
+			"no transform",
+			`"nodes": [{"mesh": 0}]`,
+			[]mgl32.Vec3{{0, 0, 0}, {1, 0, 0}, {0, 1, 0}},
+		},
+		{
+			// translate, then scale, then rotate by 90 degrees about z
+			"chain",
+			fmt.Sprintf(`"nodes": [
+				{"translation": [1, 0, 0], "children": [1]},
+				{"scale": [2, 2, 2], "children": [2]},
+				{"rotation": [0, 0, %g, %g], "mesh": 0}
+			], "scenes": [{"nodes": [0]}]`, s, s),
+			[]mgl32.Vec3{{1, 0, 0}, {1, 2, 0}, {-1, 0, 0}},
+		},
+		{
+			"trs in one node",
+			fmt.Sprintf(`"nodes": [{"translation": [0, 0, 5], "rotation": [0, 0, %g, %g], "scale": [3, 1, 1], "mesh": 0}]`, s, s),
+			[]mgl32.Vec3{{0, 0, 5}, {0, 3, 5}, {-1, 0, 5}},
+		},
+		{
+			"matrix under translation",
+			`"nodes": [
+				{"translation": [0, 1, 0], "children": [1]},
+				{"matrix": [2, 0, 0, 0, 0, 2, 0, 0, 0, 0, 2, 0, 10, 0, 0, 1], "mesh": 0}
+			]`,
+			[]mgl32.Vec3{{10, 1, 0}, {12, 1, 0}, {10, 3, 0}},
+		},
+		{
+			"default scene",
+			`"nodes": [{"mesh": 0}, {"translation": [0, 0, 1], "mesh": 0}],
+			"scenes": [{"nodes": [0]}, {"nodes": [1]}], "scene": 1`,
+			[]mgl32.Vec3{{0, 0, 1}, {1, 0, 1}, {0, 1, 1}},
+		},
+		{
+			// the winding is turned around so that the triangle keeps facing +z
+			"mirrored",
+			`"nodes": [{"scale": [-1, 1, 1], "mesh": 0}]`,
+			[]mgl32.Vec3{{0, 0, 0}, {0, 1, 0}, {-1, 0, 0}},
+		},
+	}
+
+	for _, tt := range tests {
+		m := parse(t, triangle().gltf(triangleMesh+", "+tt.nodes))
+		if got := corners(m); !approxEqual(got, tt.want) {
+			t.Errorf("%s: got corners %v, want %v", tt.name, got, tt.want)
+		}
+		// the generated normals face +z in all cases
+		for _, idx := range m.Indices {
+			if n := m.Vertices[idx].Normal; !n.ApproxEqual(mgl32.Vec3{0, 0, 1}) {
+				t.Errorf("%s: got normal %v", tt.name, n)
+				break
+			}
+		}
+	}
+}
+
+func TestNodeCycle(t *testing.T) {
+	var l Loader
+	data := triangle().gltf(triangleMesh + `, "nodes": [{"children": [1]}, {"children": [0], "mesh": 0}], "scenes": [{"nodes": [0]}]`)
+	_, err := l.Parse(bytes.NewReader(data), "cycle.gltf")
+	if !errors.Is(err, ErrCycle) {
+		t.Errorf("got %v, want ErrCycle", err)
+	}
+}
+
+func TestDataURI(t *testing.T) {
+	f := triangle()
+	m := parse(t, f.gltf(triangleMesh+`, "nodes": [{"mesh": 0}]`))
+	if got, want := corners(m), []mgl32.Vec3{{0, 0, 0}, {1, 0, 0}, {0, 1, 0}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got corners %v, want %v", got, want)
+	}
+
+	// the same buffer in an external file, referred to by a percent
+	// encoded uri relative to the .gltf file
+	files := map[string][]byte{
+		"models/ext.gltf":       []byte(f.json("the%20buffer.bin", triangleMesh+`, "nodes": [{"mesh": 0}]`)),
+		"models/the buffer.bin": f.bin.Bytes(),
+	}
+	l := Loader{Resolver: objparser.ResolverFunc(func(name string) (io.ReadCloser, error) {
+		data, ok := files[name]
+		if !ok {
+			return nil, os.ErrNotExist
+		}
+		return ioutil.NopCloser(bytes.NewReader(data)), nil
+	})}
+	ext, err := l.Load("models/ext.gltf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(ext, m) {
+		t.Errorf("external buffer gives %+v, data uri %+v", ext, m)
+	}
+
+	for _, uri := range []string{"data:application/octet-stream,plain", "data:application/octet-stream;base64,!!"} {
+		_, err := (&Loader{}).Parse(strings.NewReader(f.json(uri, triangleMesh+`, "nodes": [{"mesh": 0}]`)), "bad.gltf")
+		var perr *objparser.ParseError
+		if !errors.As(err, &perr) || perr.Token != "buffers[0].uri" {
+			t.Errorf("%s: got %v, want an error for buffers[0].uri", uri, err)
+		}
+	}
+}
+
+func TestGLB(t *testing.T) {
+	f := triangle()
+	// uvs and normals in the binary chunk too
+	f.add([]float32{0, 0, 1, 0, 0, 1}, "VEC2", 3)
+	f.add([]float32{0, 0, 1, 0, 0, 1, 0, 0, 1}, "VEC3", 3)
+	rest := `"meshes": [{"primitives": [{"attributes": {"POSITION": 0, "TEXCOORD_0": 2, "NORMAL": 3}, "indices": 1}]}],
+		"nodes": [{"name": "glb", "mesh": 0}]`
+
+	glb := parse(t, f.glb(rest))
+	if want := parse(t, f.gltf(rest)); !reflect.DeepEqual(glb, want) {
+		t.Errorf("got %+v from the .glb, %+v from the .gltf", glb, want)
+	}
+	if len(glb.Vertices) != 3 || glb.Vertices[1].Flags != objparser.HasNormals|objparser.HasUVs {
+		t.Fatalf("got vertices %+v", glb.Vertices)
+	}
+	// glTF has the origin of uvs at the top
+	if uv := glb.Vertices[1].UV; uv != (mgl32.Vec2{1, 1}) {
+		t.Errorf("got uv %v, want [1 1]", uv)
+	}
+	if len(glb.Objects) != 1 || glb.Objects[0].Name != "glb" {
+		t.Errorf("got objects %+v", glb.Objects)
+	}
+
+	data := f.glb(rest)
+	broken := []struct {
+		name string
+		data []byte
+		err  error
+	}{
+		{"truncated", data[:len(data)-4], ErrFormat},
+		{"header only", data[:10], ErrFormat},
+		{"version 1", append(append([]byte(glbMagic), 1, 0, 0, 0), data[8:]...), ErrVersion},
+		{"bin before json", swapChunks(data), ErrFormat},
+	}
+	for _, tt := range broken {
+		_, err := (&Loader{}).Parse(bytes.NewReader(tt.data), "broken.glb")
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.err)
+		}
+	}
+}
+
+// swapChunks puts the binary chunk of a .glb container before the json one
+func swapChunks(glb []byte) []byte {
+	le := binary.LittleEndian
+	jsEnd := 20 + int(le.Uint32(glb[12:]))
+	out := append([]byte{}, glb[:12]...)
+	out = append(out, glb[jsEnd:]...)
+	return append(out, glb[12:jsEnd]...)
+}
+
+func TestStripsAndFans(t *testing.T) {
+	f := &fixture{}
+	// a row of points along x, alternating between y 0 and 1
+	points := []mgl32.Vec3{{0, 0, 0}, {0, 1, 0}, {1, 0, 0}, {1, 1, 0}, {2, 0, 0}}
+	f.add([]float32{0, 0, 0, 0, 1, 0, 1, 0, 0, 1, 1, 0, 2, 0, 0}, "VEC3", 5)
+	f.add([]uint16{0, 2, 1, 3, 4}, "SCALAR", 5)
+	f.add([]uint16{0, 1, 1, 2, 3}, "SCALAR", 5)
+
+	tests := []struct {
+		name      string
+		primitive string
+		want      [][3]int
+	}{
+		{"triangles", `"indices": 1`, [][3]int{{0, 2, 1}}},
+		{"strip", `"indices": 1, "mode": 5`, [][3]int{{0, 2, 1}, {1, 2, 3}, {1, 3, 4}}},
+		{"fan", `"indices": 1, "mode": 6`, [][3]int{{0, 2, 1}, {0, 1, 3}, {0, 3, 4}}},
+		{"strip without indices", `"mode": 5`, [][3]int{{0, 1, 2}, {2, 1, 3}, {2, 3, 4}}},
+		{"fan without indices", `"mode": 6`, [][3]int{{0, 1, 2}, {0, 2, 3}, {0, 3, 4}}},
+		// triangles that reuse a corner are dropped
+		{"degenerate strip", `"indices": 2, "mode": 5`, [][3]int{{1, 2, 3}}},
+	}
+	for _, tt := range tests {
+		m := parse(t, f.gltf(fmt.Sprintf(`"meshes": [{"primitives": [{"attributes": {"POSITION": 0}, %s}]}], "nodes": [{"mesh": 0}]`, tt.primitive)))
+		// the vertices are not shared without normals, compare the corners
+		want := []mgl32.Vec3{}
+		for _, tri := range tt.want {
+			want = append(want, points[tri[0]], points[tri[1]], points[tri[2]])
+		}
+		if got := corners(m); !approxEqual(got, want) {
+			t.Errorf("%s: got corners %v, want %v", tt.name, got, want)
+		}
+		if n := m.TriangleCount(); len(m.FaceMaterials) != n || len(m.FaceSmoothing) != n {
+			t.Errorf("%s: got %d face materials and %d smoothing groups for %d triangles", tt.name, len(m.FaceMaterials), len(m.FaceSmoothing), n)
+		}
+	}
+
+	// points and lines have no triangles
+	var l Loader
+	_, err := l.Parse(bytes.NewReader(f.gltf(`"meshes": [{"primitives": [{"attributes": {"POSITION": 0}, "mode": 1}]}], "nodes": [{"mesh": 0}]`)), "lines.gltf")
+	if !errors.Is(err, ErrUnsupported) {
+		t.Errorf("lines: got %v, want ErrUnsupported", err)
+	}
+}
+
+// cube is a fixture with a unit cube of 8 shared corners without normals,
+// the corner at x, y, z is x + 2y + 4z
+func cube() *fixture {
+	f := &fixture{}
+	f.add([]float32{0, 0, 0, 1, 0, 0, 0, 1, 0, 1, 1, 0, 0, 0, 1, 1, 0, 1, 0, 1, 1, 1, 1, 1}, "VEC3", 8)
+	f.add([]uint16{
+		0, 2, 3, 0, 3, 1, // -z
+		4, 5, 7, 4, 7, 6, // +z
+		0, 4, 6, 0, 6, 2, // -x
+		1, 3, 7, 1, 7, 5, // +x
+		0, 1, 5, 0, 5, 4, // -y
+		2, 6, 7, 2, 7, 3, // +y
+	}, "SCALAR", 36)
+	return f
+}
+
+func TestFlatNormals(t *testing.T) {
+	const mesh = `"meshes": [{"primitives": [{"attributes": {"POSITION": 0}, "indices": 1}]}]`
+	tests := []struct {
+		name   string
+		nodes  string
+		corner mgl32.Vec3
+		want   []mgl32.Vec3
+	}{
+		{"plain", `"nodes": [{"mesh": 0}]`, mgl32.Vec3{1, 1, 1}, []mgl32.Vec3{{0, 0, 1}, {1, 0, 0}, {0, 1, 0}}},
+		// the mirror flips the winding, the normals still point outwards
+		{"mirrored", `"nodes": [{"mesh": 0, "scale": [-1, 1, 1]}]`, mgl32.Vec3{-1, 1, 1}, []mgl32.Vec3{{0, 0, 1}, {-1, 0, 0}, {0, 1, 0}}},
+	}
+	for _, tt := range tests {
+		m := parse(t, cube().gltf(mesh+", "+tt.nodes))
+		if len(m.Vertices) != 24 || m.TriangleCount() != 12 {
+			t.Errorf("%s: got %d vertices and %d triangles, want 4 vertices per face", tt.name, len(m.Vertices), m.TriangleCount())
+		}
+
+		// every corner has the normal of its face, the faces of a corner
+		// are shaded apart
+		got := []mgl32.Vec3{}
+		for _, v := range m.Vertices {
+			if v.Flags&objparser.HasNormals != 0 {
+				t.Errorf("%s: generated normal %v is flagged as read from the file", tt.name, v.Normal)
+			}
+			if v.Position.Sub(tt.corner).Len() < 1e-5 {
+				got = append(got, v.Normal)
+			}
+		}
+		if !approxEqual(got, tt.want) {
+			t.Errorf("%s: got normals %v at %v, want %v", tt.name, got, tt.corner, tt.want)
+		}
+	}
+}
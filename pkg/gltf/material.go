@@ -0,0 +1,198 @@
+package gltf
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"math"
+	s "strings"
+
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/supermuesli/computeshader/pkg/objparser"
+)
+
+// materials converts all materials of the document into d.mesh.Materials,
+// in the same order so that primitives can refer to them by index
+func (d *decoder) materials() error {
+	names := map[string]bool{}
+	for i := range d.doc.Materials {
+		m, err := d.material(i)
+		if err != nil {
+			return err
+		}
+		// .mtl files refer to materials by name
+		if m.Name == "" || names[m.Name] {
+			m.Name = fmt.Sprintf("%smaterial%d", m.Name, i)
+		}
+		names[m.Name] = true
+		d.mesh.Materials = append(d.mesh.Materials, m)
+	}
+	return nil
+}
+
+// material maps the metallic-roughness model of materials[i] onto the
+// .mtl parameters. Ks and Ns are approximated so that the material also
+// looks right where only the phong parameters are used.
+func (d *decoder) material(i int) (objparser.Material, error) {
+	src := &d.doc.Materials[i]
+	path := fmt.Sprintf("materials[%d]", i)
+	pbr := &src.PbrMetallicRoughness
+	m := objparser.NewMaterial(src.Name)
+
+	baseColor := [4]float32{1, 1, 1, 1}
+	if pbr.BaseColorFactor != nil {
+		baseColor = *pbr.BaseColorFactor
+	}
+	m.Diffuse = mgl32.Vec3{baseColor[0], baseColor[1], baseColor[2]}
+	if src.AlphaMode == "BLEND" {
+		m.Dissolve = baseColor[3]
+	}
+
+	m.Metallic, m.Roughness = 1, 1
+	if pbr.MetallicFactor != nil {
+		m.Metallic = *pbr.MetallicFactor
+	}
+	if pbr.RoughnessFactor != nil {
+		m.Roughness = *pbr.RoughnessFactor
+	}
+	// dielectrics reflect about 4%, metals reflect their base color
+	m.Specular = mgl32.Vec3{0.04, 0.04, 0.04}.Mul(1 - m.Metallic).Add(m.Diffuse.Mul(m.Metallic))
+	// inverse of the exponent to roughness mapping of Material.Render
+	if m.Roughness > 0 {
+		m.SpecularExponent = float32(math.Min(2/float64(m.Roughness*m.Roughness)-2, 1000))
+	} else {
+		m.SpecularExponent = 1000
+	}
+
+	strength := float32(1)
+	if ext := src.Extensions.EmissiveStrength; ext != nil && ext.EmissiveStrength != nil {
+		strength = *ext.EmissiveStrength
+	}
+	m.Emissive = mgl32.Vec3(src.EmissiveFactor).Mul(strength)
+
+	m.OpticalDensity = 1.5
+	if ext := src.Extensions.IOR; ext != nil && ext.IOR != nil {
+		m.OpticalDensity = *ext.IOR
+	}
+	if ext := src.Extensions.Transmission; ext != nil && ext.TransmissionFactor > 0 {
+		// refraction and fresnel, see Material.Render
+		m.Illum = 6
+		m.TransmissionFilter = m.Diffuse
+	}
+
+	var err error
+	if m.DiffuseMap, err = d.textureMap(pbr.BaseColorTexture, path+".pbrMetallicRoughness.baseColorTexture"); err != nil {
+		return m, err
+	}
+	// one texture holds roughness in green and metalness in blue, both maps
+	// refer to it
+	if m.RoughnessMap, err = d.textureMap(pbr.MetallicRoughnessTexture, path+".pbrMetallicRoughness.metallicRoughnessTexture"); err != nil {
+		return m, err
+	}
+	if m.RoughnessMap != nil {
+		metallic := *m.RoughnessMap
+		m.MetallicMap = &metallic
+	}
+	if m.BumpMap, err = d.textureMap(src.NormalTexture, path+".normalTexture"); err != nil {
+		return m, err
+	}
+	if m.BumpMap != nil && src.NormalTexture.Scale != nil {
+		m.BumpMap.BumpMultiplier = *src.NormalTexture.Scale
+	}
+	if m.EmissiveMap, err = d.textureMap(src.EmissiveTexture, path+".emissiveTexture"); err != nil {
+		return m, err
+	}
+	return m, nil
+}
+
+// textureMap returns the TextureMap info refers to, nil if info is nil or
+// the texture was skipped in lenient mode
+func (d *decoder) textureMap(info *textureInfo, path string) (*objparser.TextureMap, error) {
+	if info == nil {
+		return nil, nil
+	}
+	if info.TexCoord != 0 {
+		// only TEXCOORD_0 is imported
+		return nil, d.unsupported(path + ".texCoord")
+	}
+	if info.Index < 0 || info.Index >= len(d.doc.Textures) {
+		return nil, d.errorAt(path+".index", ErrIndex)
+	}
+	tex := &d.doc.Textures[info.Index]
+	texPath := fmt.Sprintf("textures[%d]", info.Index)
+	if tex.Source == nil {
+		// the image comes from an extension like KHR_texture_basisu
+		return nil, d.unsupported(texPath + ".source")
+	}
+
+	tm, err := d.image(*tex.Source, texPath+".source")
+	if tm == nil || err != nil {
+		return nil, err
+	}
+	out := *tm
+	if tex.Sampler != nil {
+		if *tex.Sampler < 0 || *tex.Sampler >= len(d.doc.Samplers) {
+			return nil, d.errorAt(texPath+".sampler", ErrIndex)
+		}
+		smp := d.doc.Samplers[*tex.Sampler]
+		out.Clamp = smp.WrapS != nil && *smp.WrapS == clampToEdge && smp.WrapT != nil && *smp.WrapT == clampToEdge
+	}
+	return &out, nil
+}
+
+// image returns a TextureMap template for images[i]. External images are
+// referenced by path and loaded like the ones of .mtl files, embedded images
+// are decoded right away and named after the glTF file.
+func (d *decoder) image(i int, from string) (*objparser.TextureMap, error) {
+	if i < 0 || i >= len(d.doc.Images) {
+		return nil, d.errorAt(from, ErrIndex)
+	}
+	if tm, ok := d.images[i]; ok {
+		return tm, nil
+	}
+	if d.images == nil {
+		d.images = map[int]*objparser.TextureMap{}
+	}
+
+	img := d.doc.Images[i]
+	path := fmt.Sprintf("images[%d]", i)
+	tm := &objparser.TextureMap{Scale: mgl32.Vec3{1, 1, 1}, BumpMultiplier: 1}
+
+	var data []byte
+	switch {
+	case img.BufferView != nil:
+		var err error
+		if data, _, err = d.bufferView(*img.BufferView); err != nil {
+			return nil, err
+		}
+	case s.HasPrefix(img.URI, "data:"):
+		var err error
+		if data, err = decodeDataURI(img.URI); err != nil {
+			return nil, d.errorAt(path+".uri", err)
+		}
+	case img.URI != "":
+		var err error
+		if tm.Path, err = d.resolve(img.URI); err != nil {
+			return nil, d.errorAt(path+".uri", err)
+		}
+		d.images[i] = tm
+		return tm, nil
+	default:
+		return nil, d.errorAt(path+".uri", ErrMissing)
+	}
+
+	decoded, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		// remember the failure so that it is only reported once
+		d.images[i] = nil
+		if !d.lenient {
+			return nil, d.errorAt(path, err)
+		}
+		d.warn(path, err)
+		return nil, nil
+	}
+	tm.Path = d.name + "#" + path
+	tm.Image = decoded
+	d.images[i] = tm
+	return tm, nil
+}
@@ -0,0 +1,295 @@
+package gltf
+
+import (
+	"fmt"
+
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/supermuesli/computeshader/pkg/objparser"
+)
+
+// scene adds the meshes of the default scene to d.mesh with the node
+// transforms applied. Files without scenes contribute all root nodes.
+func (d *decoder) scene() error {
+	var roots []int
+	path := "scenes"
+	switch {
+	case d.doc.Scene != nil:
+		i := *d.doc.Scene
+		if i < 0 || i >= len(d.doc.Scenes) {
+			return d.errorAt("scene", ErrIndex)
+		}
+		roots, path = d.doc.Scenes[i].Nodes, fmt.Sprintf("scenes[%d].nodes", i)
+	case len(d.doc.Scenes) > 0:
+		roots, path = d.doc.Scenes[0].Nodes, "scenes[0].nodes"
+	default:
+		isChild := make([]bool, len(d.doc.Nodes))
+		for _, n := range d.doc.Nodes {
+			for _, c := range n.Children {
+				if c >= 0 && c < len(isChild) {
+					isChild[c] = true
+				}
+			}
+		}
+		for i, child := range isChild {
+			if !child {
+				roots = append(roots, i)
+			}
+		}
+	}
+
+	visited := make([]bool, len(d.doc.Nodes))
+	for _, i := range roots {
+		if err := d.node(i, path, mgl32.Ident4(), visited); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// node adds the mesh of nodes[i] and its children, parent is the world
+// transform of the parent node
+func (d *decoder) node(i int, from string, parent mgl32.Mat4, visited []bool) error {
+	if i < 0 || i >= len(d.doc.Nodes) {
+		return d.errorAt(from, ErrIndex)
+	}
+	path := fmt.Sprintf("nodes[%d]", i)
+	if visited[i] {
+		return d.errorAt(path, ErrCycle)
+	}
+	visited[i] = true
+
+	n := &d.doc.Nodes[i]
+	world := parent.Mul4(n.transform())
+
+	if n.Mesh != nil {
+		name := n.Name
+		if name == "" {
+			name = path
+		}
+		if err := d.addMesh(*n.Mesh, path+".mesh", name, world); err != nil {
+			return err
+		}
+	}
+
+	for _, c := range n.Children {
+		if err := d.node(c, path+".children", world, visited); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// transform returns the local transform of n, which is its matrix or the
+// product of translation, rotation and scale
+func (n *node) transform() mgl32.Mat4 {
+	if n.Matrix != nil {
+		// both are column major
+		return mgl32.Mat4(*n.Matrix)
+	}
+	m := mgl32.Ident4()
+	if t := n.Translation; t != nil {
+		m = mgl32.Translate3D(t[0], t[1], t[2])
+	}
+	if r := n.Rotation; r != nil {
+		q := mgl32.Quat{W: r[3], V: mgl32.Vec3{r[0], r[1], r[2]}}
+		m = m.Mul4(q.Normalize().Mat4())
+	}
+	if sc := n.Scale; sc != nil {
+		m = m.Mul4(mgl32.Scale3D(sc[0], sc[1], sc[2]))
+	}
+	return m
+}
+
+// addMesh adds meshes[i] as an Object with one Group per primitive
+func (d *decoder) addMesh(i int, from, name string, world mgl32.Mat4) error {
+	if i < 0 || i >= len(d.doc.Meshes) {
+		return d.errorAt(from, ErrIndex)
+	}
+	m := &d.doc.Meshes[i]
+	groupName := m.Name
+	if groupName == "" {
+		groupName = "default"
+	}
+
+	obj := objparser.Object{Name: name}
+	for j := range m.Primitives {
+		start := d.mesh.TriangleCount()
+		path := fmt.Sprintf("meshes[%d].primitives[%d]", i, j)
+		if err := d.primitive(&m.Primitives[j], path, world); err != nil {
+			return err
+		}
+		if count := d.mesh.TriangleCount() - start; count > 0 {
+			obj.Groups = append(obj.Groups, objparser.Group{
+				Names: []string{groupName},
+				Start: start,
+				Count: count,
+			})
+		}
+	}
+	if len(obj.Groups) > 0 {
+		d.mesh.Objects = append(d.mesh.Objects, obj)
+	}
+	return nil
+}
+
+// primitive adds the triangles of p transformed by world to d.mesh
+func (d *decoder) primitive(p *primitive, path string, world mgl32.Mat4) error {
+	mode := modeTriangles
+	if p.Mode != nil {
+		mode = *p.Mode
+	}
+	if mode != modeTriangles && mode != modeTriangleStrip && mode != modeTriangleFan {
+		// points and lines have no area to render
+		return d.unsupported(path + ".mode")
+	}
+
+	posAccessor, ok := p.Attributes["POSITION"]
+	if !ok {
+		return d.errorAt(path+".attributes.POSITION", ErrMissing)
+	}
+	positions, err := d.floats(posAccessor, "VEC3")
+	if err != nil {
+		return err
+	}
+	count := len(positions) / 3
+
+	var normals, uvs []float32
+	if i, ok := p.Attributes["NORMAL"]; ok {
+		if normals, err = d.floats(i, "VEC3"); err != nil {
+			return err
+		}
+	}
+	if i, ok := p.Attributes["TEXCOORD_0"]; ok {
+		if uvs, err = d.floats(i, "VEC2"); err != nil {
+			return err
+		}
+	}
+	if len(normals) != 0 && len(normals) != 3*count || len(uvs) != 0 && len(uvs) != 2*count {
+		return d.errorAt(path+".attributes", ErrAccessor)
+	}
+
+	var indices []uint32
+	if p.Indices != nil {
+		if indices, err = d.indices(*p.Indices); err != nil {
+			return err
+		}
+		for _, idx := range indices {
+			if int(idx) >= count {
+				return d.errorAt(path+".indices", ErrIndex)
+			}
+		}
+	} else {
+		indices = make([]uint32, count)
+		for k := range indices {
+			indices[k] = uint32(k)
+		}
+	}
+
+	material := int32(-1)
+	if p.Material != nil {
+		if *p.Material < 0 || *p.Material >= len(d.doc.Materials) {
+			return d.errorAt(path+".material", ErrIndex)
+		}
+		material = int32(*p.Material)
+	}
+
+	normalMatrix := world.Mat3().Inv().Transpose()
+	if normalMatrix == (mgl32.Mat3{}) {
+		// degenerate transforms flatten the mesh, keep the normals usable
+		normalMatrix = world.Mat3()
+	}
+	vertex := func(k uint32) objparser.Vertex {
+		pos := mgl32.Vec3{positions[3*k], positions[3*k+1], positions[3*k+2]}
+		v := objparser.Vertex{Position: world.Mul4x1(pos.Vec4(1)).Vec3()}
+		if normals != nil {
+			n := normalMatrix.Mul3x1(mgl32.Vec3{normals[3*k], normals[3*k+1], normals[3*k+2]})
+			if n.Len() > 0 {
+				n = n.Normalize()
+			}
+			v.Normal = n
+			v.Flags |= objparser.HasNormals
+		}
+		if uvs != nil {
+			// glTF puts the origin at the top left, .obj at the bottom left
+			v.UV = mgl32.Vec2{uvs[2*k], 1 - uvs[2*k+1]}
+			v.Flags |= objparser.HasUVs
+		}
+		return v
+	}
+
+	base := uint32(len(d.mesh.Vertices))
+	if normals != nil {
+		for k := 0; k < count; k++ {
+			d.mesh.Vertices = append(d.mesh.Vertices, vertex(uint32(k)))
+		}
+	}
+	// without normals the spec asks for flat shading, a vertex is shared
+	// only by the triangles with the same face normal
+	type flatVertex struct {
+		index  uint32
+		normal mgl32.Vec3
+	}
+	flat := map[flatVertex]uint32{}
+
+	// mirroring transforms turn the winding order around
+	flip := world.Mat3().Det() < 0
+	for _, t := range triangleList(mode, indices) {
+		if flip {
+			t[1], t[2] = t[2], t[1]
+		}
+		if normals != nil {
+			d.mesh.Indices = append(d.mesh.Indices, base+t[0], base+t[1], base+t[2])
+		} else {
+			corners := [3]objparser.Vertex{vertex(t[0]), vertex(t[1]), vertex(t[2])}
+			n := corners[1].Position.Sub(corners[0].Position).Cross(corners[2].Position.Sub(corners[0].Position))
+			if n.Len() > 0 {
+				n = n.Normalize()
+			}
+			for c, idx := range t {
+				key := flatVertex{idx, n}
+				k, ok := flat[key]
+				if !ok {
+					k = uint32(len(d.mesh.Vertices))
+					corners[c].Normal = n
+					d.mesh.Vertices = append(d.mesh.Vertices, corners[c])
+					flat[key] = k
+				}
+				d.mesh.Indices = append(d.mesh.Indices, k)
+			}
+		}
+		d.mesh.FaceMaterials = append(d.mesh.FaceMaterials, material)
+		d.mesh.FaceSmoothing = append(d.mesh.FaceSmoothing, 0)
+	}
+	return nil
+}
+
+// triangleList expands strips and fans into separate triangles, triangles
+// that reuse a corner are dropped
+func triangleList(mode int, indices []uint32) [][3]uint32 {
+	tris := [][3]uint32{}
+	add := func(a, b, c uint32) {
+		if a != b && b != c && a != c {
+			tris = append(tris, [3]uint32{a, b, c})
+		}
+	}
+
+	switch mode {
+	case modeTriangles:
+		for k := 0; k+2 < len(indices); k += 3 {
+			add(indices[k], indices[k+1], indices[k+2])
+		}
+	case modeTriangleStrip:
+		for k := 0; k+2 < len(indices); k++ {
+			if k%2 == 0 {
+				add(indices[k], indices[k+1], indices[k+2])
+			} else {
+				add(indices[k+1], indices[k], indices[k+2])
+			}
+		}
+	case modeTriangleFan:
+		for k := 1; k+1 < len(indices); k++ {
+			add(indices[0], indices[k], indices[k+1])
+		}
+	}
+	return tris
+}
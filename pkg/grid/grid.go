@@ -0,0 +1,275 @@
+// Package grid builds uniform grids over triangles. Every cell lists the
+// triangles whose bounds overlap it, rays walk the cells they pass in
+// order and stop at the first cell with a hit.
+package grid
+
+import (
+	"math"
+
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/supermuesli/computeshader/pkg/accel"
+	"github.com/supermuesli/computeshader/pkg/meshutil"
+	"github.com/supermuesli/computeshader/pkg/objparser"
+)
+
+// Header describes the grid, laid out like a std430 struct
+type Header struct {
+	Min mgl32.Vec3
+	// cells along x
+	X   int32
+	Max mgl32.Vec3
+	// cells along y
+	Y        int32
+	CellSize mgl32.Vec3
+	// cells along z
+	Z int32
+}
+
+// Cell is a run of Grid.Indices
+type Cell struct {
+	First, Count int32
+}
+
+// Grid is a uniform grid over a triangle soup
+type Grid struct {
+	Header Header
+	// x varies fastest, then y, then z
+	Cells []Cell
+	// the triangles of the cells, as indices into the slice it was built from
+	Indices []int32
+
+	triangles []objparser.Triangle
+}
+
+// Builder configures how grids are built. The zero value is ready to use.
+type Builder struct {
+	// Density is the number of cells per triangle, 2 if 0
+	Density float32
+	// MaxResolution is the most cells along one axis, 128 if 0
+	MaxResolution int
+}
+
+// Build builds a grid over triangles with the default Builder
+func Build(triangles []objparser.Triangle) *Grid {
+	var b Builder
+	return b.Build(triangles)
+}
+
+// Build builds a grid over triangles
+func (b *Builder) Build(triangles []objparser.Triangle) *Grid {
+	g := &Grid{Cells: []Cell{}, Indices: []int32{}, triangles: triangles}
+	if len(triangles) == 0 {
+		return g
+	}
+	density, maxResolution := b.Density, b.MaxResolution
+	if density <= 0 {
+		density = 2
+	}
+	if maxResolution <= 0 {
+		maxResolution = 128
+	}
+
+	boxes := make([]meshutil.Box, len(triangles))
+	bounds := meshutil.EmptyBox()
+	for i, t := range triangles {
+		boxes[i] = meshutil.EmptyBox()
+		for _, p := range [...]mgl32.Vec4{t.A, t.B, t.C} {
+			boxes[i].Grow(p.Vec3())
+		}
+		bounds = bounds.Union(boxes[i])
+	}
+
+	// cubic cells, flat sides of the bounds get one cell
+	size := bounds.Size()
+	volume, dims := 1.0, 0
+	for _, s := range size {
+		if s > 0 {
+			volume *= float64(s)
+			dims++
+		}
+	}
+	perUnit := 0.0
+	if dims > 0 {
+		perUnit = math.Pow(float64(density)*float64(len(triangles))/volume, 1/float64(dims))
+	}
+	var res [3]int32
+	for i, s := range size {
+		r := int(math.Ceil(float64(s) * perUnit))
+		if r < 1 {
+			r = 1
+		}
+		if r > maxResolution {
+			r = maxResolution
+		}
+		res[i] = int32(r)
+	}
+	g.Header = Header{
+		Min:      bounds.Min,
+		Max:      bounds.Max,
+		X:        res[0],
+		Y:        res[1],
+		Z:        res[2],
+		CellSize: mgl32.Vec3{size[0] / float32(res[0]), size[1] / float32(res[1]), size[2] / float32(res[2])},
+	}
+
+	// count the triangles per cell, then fill them in
+	g.Cells = make([]Cell, res[0]*res[1]*res[2])
+	for pass := 0; pass < 2; pass++ {
+		for i := range boxes {
+			lo, hi := g.cellOf(boxes[i].Min), g.cellOf(boxes[i].Max)
+			for z := lo[2]; z <= hi[2]; z++ {
+				for y := lo[1]; y <= hi[1]; y++ {
+					for x := lo[0]; x <= hi[0]; x++ {
+						c := &g.Cells[g.index([3]int32{x, y, z})]
+						if pass == 1 {
+							g.Indices[c.First+c.Count] = int32(i)
+						}
+						c.Count++
+					}
+				}
+			}
+		}
+		if pass == 0 {
+			first := int32(0)
+			for i := range g.Cells {
+				g.Cells[i].First = first
+				first += g.Cells[i].Count
+				g.Cells[i].Count = 0
+			}
+			g.Indices = make([]int32, first)
+		}
+	}
+	return g
+}
+
+func (g *Grid) resolution() [3]int32 {
+	return [3]int32{g.Header.X, g.Header.Y, g.Header.Z}
+}
+
+// cellOf returns the cell p is in, clamped to the grid
+func (g *Grid) cellOf(p mgl32.Vec3) [3]int32 {
+	res := g.resolution()
+	var c [3]int32
+	for i := range c {
+		if g.Header.CellSize[i] > 0 {
+			c[i] = int32((p[i] - g.Header.Min[i]) / g.Header.CellSize[i])
+		}
+		if c[i] < 0 {
+			c[i] = 0
+		}
+		if c[i] >= res[i] {
+			c[i] = res[i] - 1
+		}
+	}
+	return c
+}
+
+func (g *Grid) index(c [3]int32) int32 {
+	return (c[2]*g.Header.Y+c[1])*g.Header.X + c[0]
+}
+
+func (g *Grid) Bounds() meshutil.Box {
+	return meshutil.Box{Min: g.Header.Min, Max: g.Header.Max}
+}
+
+// Intersect returns the closest triangle the ray hits closer than max. It
+// walks the cells along the ray with a 3d dda.
+func (g *Grid) Intersect(r accel.Ray, max float32) (accel.Hit, bool) {
+	hit := accel.Hit{Triangle: -1, Distance: max}
+	if len(g.Cells) == 0 {
+		return hit, false
+	}
+	invDir := r.InvDir()
+	near, far, ok := accel.IntersectBox(r, invDir, g.Bounds(), max)
+	if !ok {
+		return hit, false
+	}
+
+	res := g.resolution()
+	cell := g.cellOf(r.At(near))
+	var step [3]int32
+	var next, delta mgl32.Vec3
+	for i := range cell {
+		switch {
+		case r.Dir[i] > 0:
+			step[i] = 1
+			next[i] = (g.Header.Min[i] + float32(cell[i]+1)*g.Header.CellSize[i] - r.Origin[i]) * invDir[i]
+			delta[i] = g.Header.CellSize[i] * invDir[i]
+		case r.Dir[i] < 0:
+			step[i] = -1
+			next[i] = (g.Header.Min[i] + float32(cell[i])*g.Header.CellSize[i] - r.Origin[i]) * invDir[i]
+			delta[i] = -g.Header.CellSize[i] * invDir[i]
+		default:
+			next[i], delta[i] = accel.Inf, accel.Inf
+		}
+	}
+
+	for {
+		c := g.Cells[g.index(cell)]
+		for _, i := range g.Indices[c.First : c.First+c.Count] {
+			if d, ok := accel.IntersectTriangle(r, &g.triangles[i]); ok && d < hit.Distance {
+				hit = accel.Hit{Triangle: i, Distance: d}
+			}
+		}
+
+		// the axis whose cell boundary comes first
+		axis := 0
+		if next[1] < next[axis] {
+			axis = 1
+		}
+		if next[2] < next[axis] {
+			axis = 2
+		}
+		// triangles reach into other cells, a hit is only the closest one
+		// once the ray left the cells in front of it
+		if hit.Triangle >= 0 && hit.Distance <= next[axis] {
+			break
+		}
+		if next[axis] > far {
+			break
+		}
+		cell[axis] += step[axis]
+		if cell[axis] < 0 || cell[axis] >= res[axis] {
+			break
+		}
+		next[axis] += delta[axis]
+	}
+	return hit, hit.Triangle >= 0
+}
+
+// Buffers returns the header, the cells and the cell indices
+func (g *Grid) Buffers() []accel.Buffer {
+	return []accel.Buffer{
+		{Name: "grid_header", Data: accel.Encode([]Header{g.Header})},
+		{Name: "grid_cells", Data: accel.Encode(g.Cells)},
+		{Name: "grid_indices", Data: accel.Encode(g.Indices)},
+	}
+}
+
+func (g *Grid) NodeCount() int {
+	return len(g.Cells)
+}
+
+// Walk visits the bounds of the grid as the root and the cells as its
+// children
+func (g *Grid) Walk(visit func(accel.Node)) {
+	if len(g.Cells) == 0 {
+		return
+	}
+	visit(accel.Node{Bounds: g.Bounds(), Cells: len(g.Cells)})
+	res := g.resolution()
+	i := 0
+	for z := int32(0); z < res[2]; z++ {
+		for y := int32(0); y < res[1]; y++ {
+			for x := int32(0); x < res[0]; x++ {
+				var b meshutil.Box
+				for k, c := range [3]int32{x, y, z} {
+					b.Min[k] = g.Header.Min[k] + float32(c)*g.Header.CellSize[k]
+					b.Max[k] = g.Header.Min[k] + float32(c+1)*g.Header.CellSize[k]
+				}
+				visit(accel.Node{Depth: 1, Bounds: b, Primitives: int(g.Cells[i].Count)})
+				i++
+			}
+		}
+	}
+}
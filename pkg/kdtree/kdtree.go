@@ -0,0 +1,220 @@
+// Package kdtree builds kd-trees over triangles with the surface area
+// heuristic, after pbrt. Triangles that straddle a splitting plane are in
+// both children.
+package kdtree
+
+import (
+	"math"
+	"sort"
+
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/supermuesli/computeshader/pkg/meshutil"
+	"github.com/supermuesli/computeshader/pkg/objparser"
+)
+
+// leaf marks leaves in Node.Axis
+const leaf = 3
+
+// MaxDepth is the deepest a tree gets, Builder.MaxDepth is clamped to it
+// so that the traversal stack of Intersect never overflows
+const MaxDepth = 60
+
+// Node is a node of the tree, laid out like a std430 struct
+type Node struct {
+	// Split is the position of the splitting plane of inner nodes
+	Split float32
+	// Axis is the axis the plane of inner nodes is perpendicular to, 3
+	// for leaves
+	Axis int32
+	// Child is the child above the plane of inner nodes, the child below
+	// follows its parent. The first index in Tree.Indices of leaves.
+	Child int32
+	// Count is the number of triangles of leaves
+	Count int32
+}
+
+func (n *Node) Leaf() bool {
+	return n.Axis == leaf
+}
+
+// Tree is a flattened kd-tree, the root is node 0
+type Tree struct {
+	Bounds meshutil.Box
+	Nodes  []Node
+	// the triangles of the leaves, as indices into the slice it was built from
+	Indices []int32
+
+	triangles []objparser.Triangle
+}
+
+// Builder configures how trees are built. The zero value is ready to use.
+type Builder struct {
+	// LeafSize is the number of triangles below which nodes are not split, 1 if 0
+	LeafSize int
+	// MaxDepth limits the depth of the tree, 8 + 1.3 log2(triangles) if 0
+	// and at most the package MaxDepth
+	MaxDepth int
+}
+
+// costs of the heuristic as in pbrt
+const (
+	traversalCost    = 1
+	intersectionCost = 80
+	// emptyBonus favors splits that cut off empty space
+	emptyBonus = 0.5
+	// maxBadRefines is how many splits deeper than leaves would be cheaper
+	// are tried before a leaf is made
+	maxBadRefines = 3
+)
+
+// Build builds a tree over triangles with the default Builder
+func Build(triangles []objparser.Triangle) *Tree {
+	var b Builder
+	return b.Build(triangles)
+}
+
+type edge struct {
+	t     float32
+	prim  int32
+	start bool
+}
+
+type builder struct {
+	tree     *Tree
+	leafSize int
+	boxes    []meshutil.Box
+	// one buffer of edges per axis, reused by all nodes
+	edges [3][]edge
+}
+
+// Build builds a tree over triangles
+func (b *Builder) Build(triangles []objparser.Triangle) *Tree {
+	t := &Tree{Bounds: meshutil.EmptyBox(), Nodes: []Node{}, Indices: []int32{}, triangles: triangles}
+	if len(triangles) == 0 {
+		return t
+	}
+
+	bd := &builder{tree: t, leafSize: b.LeafSize, boxes: make([]meshutil.Box, len(triangles))}
+	if bd.leafSize <= 0 {
+		bd.leafSize = 1
+	}
+	maxDepth := b.MaxDepth
+	if maxDepth <= 0 {
+		maxDepth = int(8 + 1.3*math.Log2(float64(len(triangles))))
+	}
+	if maxDepth > MaxDepth {
+		maxDepth = MaxDepth
+	}
+
+	prims := make([]int32, len(triangles))
+	for i, tri := range triangles {
+		bd.boxes[i] = meshutil.EmptyBox()
+		for _, p := range [...]mgl32.Vec4{tri.A, tri.B, tri.C} {
+			bd.boxes[i].Grow(p.Vec3())
+		}
+		t.Bounds = t.Bounds.Union(bd.boxes[i])
+		prims[i] = int32(i)
+	}
+	for axis := range bd.edges {
+		bd.edges[axis] = make([]edge, 2*len(triangles))
+	}
+
+	bd.build(t.Bounds, prims, maxDepth, 0)
+	return t
+}
+
+// build appends the subtree over prims within bounds
+func (b *builder) build(bounds meshutil.Box, prims []int32, depth, badRefines int) {
+	node := len(b.tree.Nodes)
+	b.tree.Nodes = append(b.tree.Nodes, Node{})
+	makeLeaf := func() {
+		b.tree.Nodes[node] = Node{Axis: leaf, Child: int32(len(b.tree.Indices)), Count: int32(len(prims))}
+		b.tree.Indices = append(b.tree.Indices, prims...)
+	}
+	if len(prims) <= b.leafSize || depth == 0 {
+		makeLeaf()
+		return
+	}
+
+	// the split with the lowest cost, trying the longest axis first
+	size := bounds.Size()
+	invArea := 1 / (2 * (size[0]*size[1] + size[1]*size[2] + size[2]*size[0]))
+	leafCost := float32(intersectionCost * len(prims))
+	bestAxis, bestOffset, bestCost := -1, -1, float32(math.Inf(1))
+	axis := 0
+	if size[1] > size[axis] {
+		axis = 1
+	}
+	if size[2] > size[axis] {
+		axis = 2
+	}
+	for retries := 0; bestAxis == -1 && retries < 3; retries++ {
+		edges := b.edges[axis][:2*len(prims)]
+		for i, p := range prims {
+			edges[2*i] = edge{t: b.boxes[p].Min[axis], prim: p, start: true}
+			edges[2*i+1] = edge{t: b.boxes[p].Max[axis], prim: p}
+		}
+		sort.Slice(edges, func(i, j int) bool {
+			if edges[i].t == edges[j].t {
+				return edges[i].start && !edges[j].start
+			}
+			return edges[i].t < edges[j].t
+		})
+
+		o0, o1 := (axis+1)%3, (axis+2)%3
+		below, above := 0, len(prims)
+		for i, e := range edges {
+			if !e.start {
+				above--
+			}
+			if e.t > bounds.Min[axis] && e.t < bounds.Max[axis] {
+				belowArea := 2 * (size[o0]*size[o1] + (e.t-bounds.Min[axis])*(size[o0]+size[o1]))
+				aboveArea := 2 * (size[o0]*size[o1] + (bounds.Max[axis]-e.t)*(size[o0]+size[o1]))
+				bonus := float32(0)
+				if above == 0 || below == 0 {
+					bonus = emptyBonus
+				}
+				cost := traversalCost + intersectionCost*(1-bonus)*
+					(belowArea*invArea*float32(below)+aboveArea*invArea*float32(above))
+				if cost < bestCost {
+					bestAxis, bestOffset, bestCost = axis, i, cost
+				}
+			}
+			if e.start {
+				below++
+			}
+		}
+		axis = (axis + 1) % 3
+	}
+
+	if bestCost > leafCost {
+		badRefines++
+	}
+	if bestAxis == -1 || badRefines == maxBadRefines || (bestCost > 4*leafCost && len(prims) < 16) {
+		makeLeaf()
+		return
+	}
+
+	// the edges of bestAxis are still sorted, the other axes were only
+	// tried after it
+	edges := b.edges[bestAxis][:2*len(prims)]
+	split := edges[bestOffset].t
+	var belowPrims, abovePrims []int32
+	for _, e := range edges[:bestOffset] {
+		if e.start {
+			belowPrims = append(belowPrims, e.prim)
+		}
+	}
+	for _, e := range edges[bestOffset+1:] {
+		if !e.start {
+			abovePrims = append(abovePrims, e.prim)
+		}
+	}
+
+	belowBounds, aboveBounds := bounds, bounds
+	belowBounds.Max[bestAxis], aboveBounds.Min[bestAxis] = split, split
+	b.build(belowBounds, belowPrims, depth-1, badRefines)
+	child := int32(len(b.tree.Nodes))
+	b.build(aboveBounds, abovePrims, depth-1, badRefines)
+	b.tree.Nodes[node] = Node{Split: split, Axis: int32(bestAxis), Child: child}
+}
@@ -0,0 +1,111 @@
+package kdtree
+
+import (
+	"github.com/supermuesli/computeshader/pkg/accel"
+	"github.com/supermuesli/computeshader/pkg/meshutil"
+)
+
+// Intersect returns the closest triangle the ray hits closer than max. The
+// children are visited front to back and the walk stops at the first node
+// behind a hit.
+func (t *Tree) Intersect(r accel.Ray, max float32) (accel.Hit, bool) {
+	hit := accel.Hit{Triangle: -1, Distance: max}
+	if len(t.Nodes) == 0 {
+		return hit, false
+	}
+	invDir := r.InvDir()
+	tMin, tMax, ok := accel.IntersectBox(r, invDir, t.Bounds, max)
+	if !ok {
+		return hit, false
+	}
+
+	type todo struct {
+		node       int32
+		tMin, tMax float32
+	}
+	// every inner node on the way down pushes at most one child
+	var stack [MaxDepth]todo
+	top := 0
+	node := int32(0)
+	for hit.Distance >= tMin {
+		n := &t.Nodes[node]
+		if !n.Leaf() {
+			axis := n.Axis
+			below := r.Origin[axis] < n.Split || (r.Origin[axis] == n.Split && r.Dir[axis] <= 0)
+			first, second := node+1, n.Child
+			if !below {
+				first, second = second, first
+			}
+			if r.Dir[axis] == 0 {
+				// parallel to the plane, 0 * Inf would be NaN in the
+				// plane. Rays in it may hit triangles on both sides.
+				if r.Origin[axis] == n.Split {
+					stack[top] = todo{second, tMin, tMax}
+					top++
+				}
+				node = first
+				continue
+			}
+			tPlane := (n.Split - r.Origin[axis]) * invDir[axis]
+			switch {
+			case tPlane > tMax || tPlane <= 0:
+				node = first
+			case tPlane < tMin:
+				node = second
+			default:
+				stack[top] = todo{second, tPlane, tMax}
+				top++
+				node, tMax = first, tPlane
+			}
+			continue
+		}
+
+		for _, i := range t.Indices[n.Child : n.Child+n.Count] {
+			if d, ok := accel.IntersectTriangle(r, &t.triangles[i]); ok && d < hit.Distance {
+				hit = accel.Hit{Triangle: i, Distance: d}
+			}
+		}
+		if top == 0 {
+			break
+		}
+		top--
+		node, tMin, tMax = stack[top].node, stack[top].tMin, stack[top].tMax
+	}
+	return hit, hit.Triangle >= 0
+}
+
+// Buffers returns the bounds, the nodes and the leaf indices
+func (t *Tree) Buffers() []accel.Buffer {
+	return []accel.Buffer{
+		{Name: "kdtree_bounds", Data: accel.Encode([]float32{
+			t.Bounds.Min[0], t.Bounds.Min[1], t.Bounds.Min[2], 0,
+			t.Bounds.Max[0], t.Bounds.Max[1], t.Bounds.Max[2], 0,
+		})},
+		{Name: "kdtree_nodes", Data: accel.Encode(t.Nodes)},
+		{Name: "kdtree_indices", Data: accel.Encode(t.Indices)},
+	}
+}
+
+func (t *Tree) NodeCount() int {
+	return len(t.Nodes)
+}
+
+// Walk visits the tree with the bounds of the nodes cut by the planes above them
+func (t *Tree) Walk(visit func(accel.Node)) {
+	if len(t.Nodes) > 0 {
+		t.walk(0, 0, t.Bounds, visit)
+	}
+}
+
+func (t *Tree) walk(node int32, depth int, bounds meshutil.Box, visit func(accel.Node)) {
+	n := &t.Nodes[node]
+	if n.Leaf() {
+		visit(accel.Node{Depth: depth, Bounds: bounds, Primitives: int(n.Count)})
+		return
+	}
+	below, above := bounds, bounds
+	below.Max[n.Axis], above.Min[n.Axis] = n.Split, n.Split
+	visit(accel.Node{Depth: depth, Bounds: bounds, Children: []meshutil.Box{below, above}})
+	t.walk(node+1, depth+1, below, visit)
+	t.walk(n.Child, depth+1, above, visit)
+}
@@ -0,0 +1,163 @@
+// Package meshutil prepares loaded meshes once on the CPU, so that the
+// renderer does not have to: bounding boxes, centering and scaling, normal
+// generation, removal of degenerate triangles and vertex welding.
+//
+// All functions change the mesh in place and keep FaceMaterials,
+// FaceSmoothing and the o/g/s structure of Mesh.Objects consistent with the
+// triangles.
+package meshutil
+
+import (
+	"math"
+
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/supermuesli/computeshader/pkg/objparser"
+)
+
+// Box is an axis aligned bounding box. The empty box has Min > Max.
+type Box struct {
+	Min, Max mgl32.Vec3
+}
+
+// EmptyBox returns a box that contains nothing and grows to the first point
+func EmptyBox() Box {
+	inf := float32(math.Inf(1))
+	return Box{Min: mgl32.Vec3{inf, inf, inf}, Max: mgl32.Vec3{-inf, -inf, -inf}}
+}
+
+func (b Box) Empty() bool {
+	return b.Min[0] > b.Max[0] || b.Min[1] > b.Max[1] || b.Min[2] > b.Max[2]
+}
+
+// Grow extends b to contain p
+func (b *Box) Grow(p mgl32.Vec3) {
+	for i := range p {
+		if p[i] < b.Min[i] {
+			b.Min[i] = p[i]
+		}
+		if p[i] > b.Max[i] {
+			b.Max[i] = p[i]
+		}
+	}
+}
+
+// Union returns the box that contains b and o
+func (b Box) Union(o Box) Box {
+	if o.Empty() {
+		return b
+	}
+	b.Grow(o.Min)
+	b.Grow(o.Max)
+	return b
+}
+
+func (b Box) Center() mgl32.Vec3 {
+	return b.Min.Add(b.Max).Mul(0.5)
+}
+
+func (b Box) Size() mgl32.Vec3 {
+	return b.Max.Sub(b.Min)
+}
+
+// Transform returns the bounding box of b after m
+func (b Box) Transform(m mgl32.Mat4) Box {
+	out := EmptyBox()
+	if b.Empty() {
+		return out
+	}
+	for i := 0; i < 8; i++ {
+		corner := b.Min
+		for axis := uint(0); axis < 3; axis++ {
+			if i&(1<<axis) != 0 {
+				corner[axis] = b.Max[axis]
+			}
+		}
+		out.Grow(m.Mul4x1(corner.Vec4(1)).Vec3())
+	}
+	return out
+}
+
+// Bounds returns the bounding box of the vertices the triangles of m use
+func Bounds(m *objparser.Mesh) Box {
+	b := EmptyBox()
+	for _, idx := range m.Indices {
+		b.Grow(m.Vertices[idx].Position)
+	}
+	return b
+}
+
+// Transform applies t to the positions and normals of m. Triangles are
+// flipped if t mirrors, so that they keep facing the same way. A singular
+// t, like a zero scale, has no normal matrix, the normals are computed from
+// the flattened triangles then.
+func Transform(m *objparser.Mesh, t mgl32.Mat4) {
+	det := t.Mat3().Det()
+	normalMatrix := t.Mat3().Inv().Transpose()
+	// Inv returns zero for nearly singular ones, or they overflow
+	singular := det == 0 || normalMatrix == (mgl32.Mat3{})
+	for _, x := range normalMatrix {
+		if math.IsInf(float64(x), 0) || math.IsNaN(float64(x)) {
+			singular = true
+		}
+	}
+	for i := range m.Vertices {
+		v := &m.Vertices[i]
+		v.Position = t.Mul4x1(v.Position.Vec4(1)).Vec3()
+		if !singular && v.Normal.Len() > 0 {
+			n := normalMatrix.Mul3x1(v.Normal)
+			// or only the normals do
+			if l := float64(n.Len()); l == 0 || math.IsInf(l, 0) || math.IsNaN(l) {
+				singular = true
+				continue
+			}
+			v.Normal = n.Normalize()
+		}
+	}
+	if det < 0 {
+		for i := 0; i+2 < len(m.Indices); i += 3 {
+			m.Indices[i+1], m.Indices[i+2] = m.Indices[i+2], m.Indices[i+1]
+		}
+	}
+	if singular {
+		vertexNormals(m)
+	}
+}
+
+// CenterTransform returns the translation that moves the center of the
+// bounds of m to the origin
+func CenterTransform(m *objparser.Mesh) mgl32.Mat4 {
+	b := Bounds(m)
+	if b.Empty() {
+		return mgl32.Ident4()
+	}
+	c := b.Center()
+	return mgl32.Translate3D(-c[0], -c[1], -c[2])
+}
+
+// Center moves m so that the center of its bounds is the origin
+func Center(m *objparser.Mesh) {
+	Transform(m, CenterTransform(m))
+}
+
+// NormalizeTransform returns the transform that centers m and scales it
+// uniformly so that it fits the cube [-1, 1], the longest side spanning it
+func NormalizeTransform(m *objparser.Mesh) mgl32.Mat4 {
+	b := Bounds(m)
+	if b.Empty() {
+		return mgl32.Ident4()
+	}
+	size := b.Size()
+	longest := float32(math.Max(float64(size[0]), math.Max(float64(size[1]), float64(size[2]))))
+	scale := float32(1)
+	if longest > 0 {
+		scale = 2 / longest
+	}
+	c := b.Center()
+	return mgl32.Scale3D(scale, scale, scale).Mul4(mgl32.Translate3D(-c[0], -c[1], -c[2]))
+}
+
+// Normalize centers m and scales it to fit the cube [-1, 1], see
+// NormalizeTransform
+func Normalize(m *objparser.Mesh) {
+	Transform(m, NormalizeTransform(m))
+}
@@ -0,0 +1,163 @@
+package meshutil
+
+import (
+	"math"
+
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/supermuesli/computeshader/pkg/objparser"
+)
+
+// RemoveDegenerate removes the triangles with two identical corners or an
+// area of at most minArea and returns how many were removed. Groups that
+// end up empty are removed, and so are objects without groups.
+func RemoveDegenerate(m *objparser.Mesh, minArea float32) int {
+	normals := faceNormals(m)
+	keep := make([]bool, len(normals))
+	for f := range keep {
+		a, b, c := m.Indices[3*f], m.Indices[3*f+1], m.Indices[3*f+2]
+		keep[f] = a != b && b != c && a != c && normals[f].Len()/2 > minArea
+	}
+	return removeTriangles(m, keep)
+}
+
+// removeTriangles drops the triangles f with !keep[f] and fixes up
+// FaceMaterials, FaceSmoothing and the groups
+func removeTriangles(m *objparser.Mesh, keep []bool) int {
+	// kept[f] is the number of kept triangles before f
+	kept := make([]int, len(keep)+1)
+	indices, materials, smoothing := m.Indices[:0], m.FaceMaterials[:0], m.FaceSmoothing[:0]
+	for f, k := range keep {
+		kept[f+1] = kept[f]
+		if !k {
+			continue
+		}
+		kept[f+1]++
+		indices = append(indices, m.Indices[3*f:3*f+3]...)
+		materials = append(materials, m.FaceMaterials[f])
+		smoothing = append(smoothing, m.FaceSmoothing[f])
+	}
+	removed := len(keep) - kept[len(keep)]
+	m.Indices, m.FaceMaterials, m.FaceSmoothing = indices, materials, smoothing
+	if removed == 0 {
+		return 0
+	}
+
+	objects := m.Objects[:0]
+	for _, obj := range m.Objects {
+		groups := obj.Groups[:0]
+		for _, g := range obj.Groups {
+			start, end := kept[g.Start], kept[g.Start+g.Count]
+			if end > start {
+				g.Start, g.Count = start, end-start
+				groups = append(groups, g)
+			}
+		}
+		if len(groups) > 0 {
+			obj.Groups = groups
+			objects = append(objects, obj)
+		}
+	}
+	m.Objects = objects
+	RemoveUnused(m)
+	return removed
+}
+
+// RemoveUnused removes the vertices no triangle uses and returns how many
+// were removed
+func RemoveUnused(m *objparser.Mesh) int {
+	remap := make([]int64, len(m.Vertices))
+	for i := range remap {
+		remap[i] = -1
+	}
+	vertices := make([]objparser.Vertex, 0, len(m.Vertices))
+	for i, idx := range m.Indices {
+		if remap[idx] < 0 {
+			remap[idx] = int64(len(vertices))
+			vertices = append(vertices, m.Vertices[idx])
+		}
+		m.Indices[i] = uint32(remap[idx])
+	}
+	removed := len(m.Vertices) - len(vertices)
+	m.Vertices = vertices
+	return removed
+}
+
+// Weld merges vertices whose positions, normals, uvs and colors are each at
+// most tolerance apart and returns how many vertices were removed. A
+// tolerance of 0 only merges exact duplicates. Triangles that collapse are
+// not removed, see RemoveDegenerate.
+func Weld(m *objparser.Mesh, tolerance float32) int {
+	// vertices are bucketed by position into cells of the size of the
+	// tolerance, candidates are in the same or a neighbouring cell
+	cell := func(p mgl32.Vec3) [3]int64 {
+		if tolerance == 0 {
+			return [3]int64{int64(math.Float32bits(p[0])), int64(math.Float32bits(p[1])), int64(math.Float32bits(p[2]))}
+		}
+		return [3]int64{
+			int64(math.Floor(float64(p[0] / tolerance))),
+			int64(math.Floor(float64(p[1] / tolerance))),
+			int64(math.Floor(float64(p[2] / tolerance))),
+		}
+	}
+	neighbours := [][3]int64{{0, 0, 0}}
+	if tolerance > 0 {
+		neighbours = neighbours[:0]
+		for x := int64(-1); x <= 1; x++ {
+			for y := int64(-1); y <= 1; y++ {
+				for z := int64(-1); z <= 1; z++ {
+					neighbours = append(neighbours, [3]int64{x, y, z})
+				}
+			}
+		}
+	}
+
+	cells := map[[3]int64][]uint32{}
+	remap := make([]uint32, len(m.Vertices))
+	vertices := make([]objparser.Vertex, 0, len(m.Vertices))
+	for i := range m.Vertices {
+		v := &m.Vertices[i]
+		c := cell(v.Position)
+		found := false
+	search:
+		for _, d := range neighbours {
+			for _, j := range cells[[3]int64{c[0] + d[0], c[1] + d[1], c[2] + d[2]}] {
+				if sameVertex(v, &vertices[j], tolerance) {
+					remap[i], found = j, true
+					break search
+				}
+			}
+		}
+		if !found {
+			remap[i] = uint32(len(vertices))
+			vertices = append(vertices, *v)
+			cells[c] = append(cells[c], remap[i])
+		}
+	}
+
+	for i, idx := range m.Indices {
+		m.Indices[i] = remap[idx]
+	}
+	removed := len(m.Vertices) - len(vertices)
+	m.Vertices = vertices
+	return removed
+}
+
+// sameVertex reports whether a and b are the same vertex up to tolerance
+func sameVertex(a, b *objparser.Vertex, tolerance float32) bool {
+	if a.Flags != b.Flags {
+		return false
+	}
+	return within(a.Position[:], b.Position[:], tolerance) &&
+		within(a.Normal[:], b.Normal[:], tolerance) &&
+		within(a.UV[:], b.UV[:], tolerance) &&
+		within(a.Color[:], b.Color[:], tolerance)
+}
+
+func within(a, b []float32, tolerance float32) bool {
+	for i := range a {
+		if float32(math.Abs(float64(a[i]-b[i]))) > tolerance {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,201 @@
+package meshutil
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/supermuesli/computeshader/pkg/objparser"
+)
+
+// newMesh returns a mesh of the triangles over positions, with face i
+// in material i and smoothing group 1, all in one group
+func newMesh(positions []mgl32.Vec3, indices ...uint32) *objparser.Mesh {
+	m := &objparser.Mesh{Indices: indices}
+	for _, p := range positions {
+		m.Vertices = append(m.Vertices, objparser.Vertex{Position: p})
+	}
+	for f := 0; f < m.TriangleCount(); f++ {
+		m.FaceMaterials = append(m.FaceMaterials, int32(f))
+		m.FaceSmoothing = append(m.FaceSmoothing, 1)
+	}
+	m.Objects = []objparser.Object{{Groups: []objparser.Group{{Names: []string{"default"}, Count: m.TriangleCount()}}}}
+	return m
+}
+
+func approxEqual(a, b mgl32.Vec3) bool {
+	return a.Sub(b).Len() <= 1e-6
+}
+
+func TestBounds(t *testing.T) {
+	// the last vertex is not used
+	m := newMesh([]mgl32.Vec3{{1, 2, 3}, {3, 2, 3}, {1, 6, 4}, {100, 100, 100}}, 0, 1, 2)
+	if b := Bounds(m); b.Min != (mgl32.Vec3{1, 2, 3}) || b.Max != (mgl32.Vec3{3, 6, 4}) {
+		t.Errorf("got bounds %+v, want 1 2 3 to 3 6 4", b)
+	}
+	if b := Bounds(&objparser.Mesh{}); !b.Empty() {
+		t.Errorf("got bounds %+v of an empty mesh, want an empty box", b)
+	}
+
+	Normalize(m)
+	b := Bounds(m)
+	if !approxEqual(b.Min, mgl32.Vec3{-0.5, -1, -0.25}) || !approxEqual(b.Max, mgl32.Vec3{0.5, 1, 0.25}) {
+		t.Errorf("got bounds %+v after Normalize, want the longest side from -1 to 1", b)
+	}
+}
+
+func TestRemoveDegenerate(t *testing.T) {
+	m := newMesh([]mgl32.Vec3{{0, 0, 0}, {1, 0, 0}, {0, 1, 0}, {2, 0, 0}, {1, 1, 0}},
+		0, 1, 2, // kept
+		0, 1, 1, // two identical corners
+		0, 1, 3, // no area
+		1, 4, 2, // kept
+		0, 1, 2, // kept
+		2, 2, 2, // all the same
+	)
+	m.Objects = []objparser.Object{
+		{Name: "a", Groups: []objparser.Group{
+			{Names: []string{"first"}, Start: 0, Count: 2},
+			{Names: []string{"empty"}, Start: 2, Count: 1},
+			{Names: []string{"second"}, Start: 3, Count: 2},
+		}},
+		{Name: "gone", Groups: []objparser.Group{{Names: []string{"last"}, Start: 5, Count: 1}}},
+	}
+
+	if n := RemoveDegenerate(m, 0); n != 3 {
+		t.Errorf("removed %d triangles, want 3", n)
+	}
+	want := []objparser.Object{
+		{Name: "a", Groups: []objparser.Group{
+			{Names: []string{"first"}, Start: 0, Count: 1},
+			{Names: []string{"second"}, Start: 1, Count: 2},
+		}},
+	}
+	if !reflect.DeepEqual(m.Objects, want) {
+		t.Errorf("got objects %+v, want %+v", m.Objects, want)
+	}
+	if !reflect.DeepEqual(m.FaceMaterials, []int32{0, 3, 4}) || len(m.FaceSmoothing) != 3 {
+		t.Errorf("got face materials %v and %d smoothing groups, want [0 3 4] and 3", m.FaceMaterials, len(m.FaceSmoothing))
+	}
+	// vertex 3 was only used by the flat triangle
+	if len(m.Vertices) != 4 || !reflect.DeepEqual(m.Indices, []uint32{0, 1, 2, 1, 3, 2, 0, 1, 2}) {
+		t.Errorf("got %d vertices and indices %v", len(m.Vertices), m.Indices)
+	}
+
+	// triangles with at most minArea
+	m = newMesh([]mgl32.Vec3{{0, 0, 0}, {1, 0, 0}, {0, 1, 0}, {0, 0.1, 0}}, 0, 1, 2, 0, 1, 3)
+	if n := RemoveDegenerate(m, 0.05); n != 1 || m.TriangleCount() != 1 || m.Objects[0].Groups[0].Count != 1 {
+		t.Errorf("removed %d triangles with an area of at most 0.05, want 1", n)
+	}
+}
+
+func TestWeld(t *testing.T) {
+	tests := []struct {
+		name      string
+		tolerance float32
+		positions []mgl32.Vec3
+		// the vertex every one is merged into
+		want []uint32
+	}{
+		{"exact", 0, []mgl32.Vec3{{1, 2, 3}, {1, 2, 3}, {1, 2, 3.0000002}}, []uint32{0, 0, 1}},
+		{"negative zero", 0, []mgl32.Vec3{{0, 0, 0}, {1, 0, 0}}, []uint32{0, 1}},
+		{"within", 0.01, []mgl32.Vec3{{0.001, 0, 0}, {0.009, 0, 0}, {0.02, 0, 0}}, []uint32{0, 0, 1}},
+		{"across a cell", 0.01, []mgl32.Vec3{{0.0099, 0, 0}, {0.0101, 0, 0}}, []uint32{0, 0}},
+		{"across zero", 0.01, []mgl32.Vec3{{-0.0001, 0.005, -0.0001}, {0.0001, 0.005, 0.0001}}, []uint32{0, 0}},
+		{"too far", 0.01, []mgl32.Vec3{{0, 0, 0}, {0.0101, 0, 0}, {0, 0, 0.0101}}, []uint32{0, 1, 2}},
+	}
+	for _, tt := range tests {
+		m := newMesh(tt.positions)
+		for i := range m.Vertices {
+			m.Indices = append(m.Indices, uint32(i))
+		}
+		removed := Weld(m, tt.tolerance)
+		if !reflect.DeepEqual(m.Indices, tt.want) || removed != len(tt.positions)-len(m.Vertices) {
+			t.Errorf("%s: got indices %v with %d removed, want %v", tt.name, m.Indices, removed, tt.want)
+		}
+	}
+
+	// the other attributes have to match as well
+	m := newMesh([]mgl32.Vec3{{0, 0, 0}, {0, 0, 0}, {0, 0, 0}, {0, 0, 0}}, 0, 1, 2, 0, 1, 3)
+	m.Vertices[1].Normal = mgl32.Vec3{0, 0, 1}
+	m.Vertices[2].Flags = objparser.HasUVs
+	m.Vertices[3].UV = mgl32.Vec2{0.001, 0}
+	if n := Weld(m, 0.01); n != 1 || !reflect.DeepEqual(m.Indices, []uint32{0, 1, 2, 0, 1, 0}) {
+		t.Errorf("got indices %v with %d removed, want only the uvs within the tolerance merged", m.Indices, n)
+	}
+}
+
+func TestSmoothNormals(t *testing.T) {
+	// two triangles folded by 90 degrees along the x axis, with separate
+	// vertices on the shared edge
+	fold := func() *objparser.Mesh {
+		return newMesh([]mgl32.Vec3{{0, 0, 0}, {1, 0, 0}, {0, 1, 0}, {1, 0, 0}, {0, 0, 0}, {0, 0, 1}}, 0, 1, 2, 3, 4, 5)
+	}
+	s := float32(math.Sqrt2 / 2)
+	tests := []struct {
+		angle float64
+		// the normals of the corners of the first triangle
+		want [3]mgl32.Vec3
+	}{
+		{math.Pi / 3, [3]mgl32.Vec3{{0, 0, 1}, {0, 0, 1}, {0, 0, 1}}},
+		{math.Pi/2 - 0.01, [3]mgl32.Vec3{{0, 0, 1}, {0, 0, 1}, {0, 0, 1}}},
+		{math.Pi/2 + 0.01, [3]mgl32.Vec3{{0, s, s}, {0, s, s}, {0, 0, 1}}},
+		{math.Pi, [3]mgl32.Vec3{{0, s, s}, {0, s, s}, {0, 0, 1}}},
+	}
+	for _, tt := range tests {
+		m := fold()
+		SmoothNormals(m, tt.angle)
+		for c, want := range tt.want {
+			v := m.Vertices[m.Indices[c]]
+			if !approxEqual(v.Normal, want) || v.Flags&objparser.HasNormals == 0 {
+				t.Errorf("angle %.2f: corner %d has normal %v with flags %d, want %v", tt.angle, c, v.Normal, v.Flags, want)
+			}
+		}
+	}
+
+	// flat normals split the shared vertices
+	m := newMesh([]mgl32.Vec3{{0, 0, 0}, {1, 0, 0}, {0, 1, 0}, {0, 0, 1}}, 0, 1, 2, 1, 0, 3)
+	FlatNormals(m)
+	if len(m.Vertices) != 6 || m.Vertices[m.Indices[3]].Normal != (mgl32.Vec3{0, 1, 0}) {
+		t.Errorf("got %d vertices and normal %v, want 6 and 0 1 0", len(m.Vertices), m.Vertices[m.Indices[3]].Normal)
+	}
+}
+
+func TestTransform(t *testing.T) {
+	triangle := func() *objparser.Mesh {
+		m := newMesh([]mgl32.Vec3{{0, 0, 0}, {1, 0, 1}, {0, 1, 1}}, 0, 1, 2)
+		for i := range m.Vertices {
+			m.Vertices[i].Normal = mgl32.Vec3{-1, -1, 1}.Normalize()
+			m.Vertices[i].Flags = objparser.HasNormals
+		}
+		return m
+	}
+
+	// a mirror flips the triangles and the normals with them
+	m := triangle()
+	Transform(m, mgl32.Scale3D(-1, 1, 1))
+	if !reflect.DeepEqual(m.Indices, []uint32{0, 2, 1}) || !approxEqual(m.Vertices[0].Normal, mgl32.Vec3{1, -1, 1}.Normalize()) {
+		t.Errorf("mirrored: got indices %v and normal %v", m.Indices, m.Vertices[0].Normal)
+	}
+
+	// a non-uniform scale keeps the normals perpendicular
+	m = triangle()
+	Transform(m, mgl32.Scale3D(2, 1, 1))
+	edge := m.Vertices[1].Position.Sub(m.Vertices[0].Position)
+	if n := m.Vertices[0].Normal; math.Abs(float64(n.Dot(edge))) > 1e-6 || math.Abs(float64(n.Len())-1) > 1e-6 {
+		t.Errorf("scaled: got normal %v, not a unit normal of the edge %v", n, edge)
+	}
+
+	// a zero scale flattens the triangle onto the xy plane, the normals
+	// come from the flattened triangle
+	for _, s := range []mgl32.Mat4{mgl32.Scale3D(1, 1, 0), mgl32.Scale3D(1, 1, 1e-30)} {
+		m = triangle()
+		Transform(m, s)
+		for i, v := range m.Vertices {
+			if !approxEqual(v.Normal, mgl32.Vec3{0, 0, 1}) || v.Flags&objparser.HasNormals == 0 {
+				t.Errorf("flattened by %v: vertex %d has normal %v with flags %d, want 0 0 1", s.Diag(), i, v.Normal, v.Flags)
+			}
+		}
+	}
+}
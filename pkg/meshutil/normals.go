@@ -0,0 +1,117 @@
+package meshutil
+
+import (
+	"math"
+
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/supermuesli/computeshader/pkg/objparser"
+)
+
+// FlatNormals gives every triangle the normal of its plane. Vertices
+// shared by triangles with different normals are split.
+func FlatNormals(m *objparser.Mesh) {
+	normals := faceNormals(m)
+	setNormals(m, func(f, corner int) mgl32.Vec3 {
+		return normalize(normals[f])
+	})
+}
+
+// SmoothNormals sets the normal of every corner to the area weighted average
+// of the normals of the triangles around its position that are at most
+// angle radians apart from the triangle of the corner. Edges with a larger
+// angle stay sharp, angle >= Pi smooths everything. The normals from the
+// file are replaced.
+func SmoothNormals(m *objparser.Mesh, angle float64) {
+	normals := faceNormals(m)
+	cos := float32(math.Cos(angle))
+	if angle >= math.Pi {
+		cos = -2
+	}
+
+	// the triangles around every position, vertices that only differ in
+	// their other attributes are smoothed together
+	around := map[mgl32.Vec3][]int{}
+	for i, idx := range m.Indices {
+		p := m.Vertices[idx].Position
+		around[p] = append(around[p], i/3)
+	}
+
+	setNormals(m, func(f, corner int) mgl32.Vec3 {
+		own := normalize(normals[f])
+		var sum mgl32.Vec3
+		for _, g := range around[m.Vertices[m.Indices[3*f+corner]].Position] {
+			if g == f || own.Dot(normalize(normals[g])) >= cos {
+				sum = sum.Add(normals[g])
+			}
+		}
+		if sum.Len() == 0 {
+			return own
+		}
+		return sum.Normalize()
+	})
+}
+
+// faceNormals returns the normals of the triangles of m, their length is
+// twice the area of the triangle
+func faceNormals(m *objparser.Mesh) []mgl32.Vec3 {
+	normals := make([]mgl32.Vec3, m.TriangleCount())
+	for f := range normals {
+		a := m.Vertices[m.Indices[3*f]].Position
+		b := m.Vertices[m.Indices[3*f+1]].Position
+		c := m.Vertices[m.Indices[3*f+2]].Position
+		normals[f] = b.Sub(a).Cross(c.Sub(a))
+	}
+	return normals
+}
+
+// setNormals gives every corner of m the normal returned by normal. Vertices
+// are split where corners that shared one get different normals and merged
+// where they end up the same.
+func setNormals(m *objparser.Mesh, normal func(f, corner int) mgl32.Vec3) {
+	normals := make([]mgl32.Vec3, len(m.Indices))
+	for i := range normals {
+		normals[i] = normal(i/3, i%3)
+	}
+
+	index := map[objparser.Vertex]uint32{}
+	vertices := make([]objparser.Vertex, 0, len(m.Vertices))
+	for i, idx := range m.Indices {
+		v := m.Vertices[idx]
+		v.Normal = normals[i]
+		// so that writers keep them
+		v.Flags |= objparser.HasNormals
+		nidx, ok := index[v]
+		if !ok {
+			nidx = uint32(len(vertices))
+			vertices = append(vertices, v)
+			index[v] = nidx
+		}
+		m.Indices[i] = nidx
+	}
+	m.Vertices = vertices
+}
+
+// vertexNormals sets the normal of every vertex to the area weighted
+// average of the normals of the triangles that use it. Unlike setNormals
+// it keeps the vertices as they are.
+func vertexNormals(m *objparser.Mesh) {
+	sums := make([]mgl32.Vec3, len(m.Vertices))
+	for f, n := range faceNormals(m) {
+		for _, idx := range m.Indices[3*f : 3*f+3] {
+			sums[idx] = sums[idx].Add(n)
+		}
+	}
+	for i := range m.Vertices {
+		m.Vertices[i].Normal = normalize(sums[i])
+		m.Vertices[i].Flags |= objparser.HasNormals
+	}
+}
+
+// normalize is Normalize that leaves the zero vector of degenerate
+// triangles alone
+func normalize(n mgl32.Vec3) mgl32.Vec3 {
+	if n.Len() == 0 {
+		return n
+	}
+	return n.Normalize()
+}
@@ -0,0 +1,65 @@
+package objparser
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"testing"
+)
+
+// benchModels runs bench on the data of every bundled model
+func benchModels(b *testing.B, bench func(b *testing.B, name string, data []byte)) {
+	for _, m := range bundled {
+		name := "../3dmodels/" + m.file
+		data, err := ioutil.ReadFile(name)
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.Run(m.file, func(b *testing.B) {
+			// parse from memory so that disk speed does not matter
+			b.SetBytes(int64(len(data)))
+			b.ReportAllocs()
+			bench(b, name, data)
+		})
+	}
+}
+
+// BenchmarkParseTokenize measures the Parser without building a mesh
+func BenchmarkParseTokenize(b *testing.B) {
+	benchModels(b, func(b *testing.B, name string, data []byte) {
+		for i := 0; i < b.N; i++ {
+			p := Parser{OnUnknown: func(string) error { return nil }}
+			if err := p.Parse(bytes.NewReader(data), name); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// BenchmarkParseLoad measures the sequential Loader
+func BenchmarkParseLoad(b *testing.B) {
+	benchModels(b, func(b *testing.B, name string, data []byte) {
+		l := Loader{Lenient: true}
+		for i := 0; i < b.N; i++ {
+			if _, err := l.Parse(bytes.NewReader(data), name); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// BenchmarkParseParallel measures the Loader with several workers
+func BenchmarkParseParallel(b *testing.B) {
+	for _, workers := range []int{2, 4, 8} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			benchModels(b, func(b *testing.B, name string, data []byte) {
+				l := Loader{Lenient: true, Workers: workers}
+				for i := 0; i < b.N; i++ {
+					if _, err := l.Parse(bytes.NewReader(data), name); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		})
+	}
+}
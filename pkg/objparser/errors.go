@@ -0,0 +1,45 @@
+package objparser
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+var (
+	ErrNumber          = errors.New("malformed number")
+	ErrArguments       = errors.New("wrong number of arguments")
+	ErrIndex           = errors.New("index out of range")
+	ErrUnsupported     = errors.New("unsupported directive")
+	ErrNoMaterial      = errors.New("material statement before newmtl")
+	ErrUnknownMaterial = errors.New("unknown material")
+)
+
+// ParseError points at the offending token of an .obj or .mtl file.
+// Line and Column are 1-based, Column counts bytes. Column is 0 if it is
+// not known, both are 0 for files that are not line based.
+type ParseError struct {
+	File   string
+	Line   int
+	Column int
+	Token  string
+	Err    error
+}
+
+func (e *ParseError) Error() string {
+	pos := e.File
+	if e.Line > 0 {
+		pos += ":" + strconv.Itoa(e.Line)
+		if e.Column > 0 {
+			pos += ":" + strconv.Itoa(e.Column)
+		}
+	}
+	if e.Token == "" {
+		return fmt.Sprintf("%s: %v", pos, e.Err)
+	}
+	return fmt.Sprintf("%s: %v: %q", pos, e.Err, e.Token)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
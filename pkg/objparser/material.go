@@ -0,0 +1,175 @@
+package objparser
+
+import (
+	"image"
+	"math"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// Material is a Wavefront .mtl material
+type Material struct {
+	Name     string
+	Ambient  mgl32.Vec3 // Ka
+	Diffuse  mgl32.Vec3 // Kd
+	Specular mgl32.Vec3 // Ks
+	Emissive mgl32.Vec3 // Ke
+	// Ns, 0 to 1000
+	SpecularExponent float32
+	// Ni, index of refraction
+	OpticalDensity float32
+	// d, or 1 - Tr. 1 is fully opaque
+	Dissolve float32
+	// Tf, the color that passes through transparent materials
+	TransmissionFilter mgl32.Vec3
+	// illum, the illumination model 0 to 10
+	Illum int
+	// Pr and Pm of the PBR extension, negative if the material has none
+	Roughness float32
+	Metallic  float32
+
+	// texture maps, nil if the material has none
+	AmbientMap          *TextureMap // map_Ka
+	DiffuseMap          *TextureMap // map_Kd
+	SpecularMap         *TextureMap // map_Ks
+	EmissiveMap         *TextureMap // map_Ke
+	SpecularExponentMap *TextureMap // map_Ns
+	DissolveMap         *TextureMap // map_d
+	BumpMap             *TextureMap // map_Bump, bump
+	DisplacementMap     *TextureMap // disp
+	RoughnessMap        *TextureMap // map_Pr
+	MetallicMap         *TextureMap // map_Pm
+}
+
+// TextureMap is an image referenced by a material
+type TextureMap struct {
+	// Path is resolved relative to the .mtl file, see Loader.Resolver
+	Path string
+	// -s and -o, scale and offset of the texture coordinates
+	Scale  mgl32.Vec3
+	Offset mgl32.Vec3
+	// -bm, only used by bump maps
+	BumpMultiplier float32
+	// -clamp on, restricts texture coordinates to 0 to 1 instead of repeating
+	Clamp bool
+	// the decoded image if it is embedded in the model file, Path is only
+	// a name for it then
+	Image image.Image
+
+	// where the map was declared, for warnings
+	file  string
+	line  int
+	token token
+}
+
+// Maps returns the texture maps of m that are set
+func (m *Material) Maps() []*TextureMap {
+	maps := []*TextureMap{}
+	for _, tm := range []*TextureMap{
+		m.AmbientMap, m.DiffuseMap, m.SpecularMap, m.EmissiveMap,
+		m.SpecularExponentMap, m.DissolveMap, m.BumpMap, m.DisplacementMap,
+		m.RoughnessMap, m.MetallicMap,
+	} {
+		if tm != nil {
+			maps = append(maps, tm)
+		}
+	}
+	return maps
+}
+
+// NewMaterial returns a material with the defaults used for every newmtl
+func NewMaterial(name string) Material {
+	return Material{
+		Name:               name,
+		Diffuse:            mgl32.Vec3{0.8, 0.8, 0.8},
+		OpticalDensity:     1,
+		Dissolve:           1,
+		TransmissionFilter: mgl32.Vec3{1, 1, 1},
+		Illum:              2,
+		Roughness:          -1,
+		Metallic:           -1,
+	}
+}
+
+type MaterialKind int32
+
+const (
+	Diffuse MaterialKind = iota
+	Glossy
+	Dielectric
+	Emissive
+)
+
+func (k MaterialKind) String() string {
+	switch k {
+	case Diffuse:
+		return "diffuse"
+	case Glossy:
+		return "glossy"
+	case Dielectric:
+		return "dielectric"
+	case Emissive:
+		return "emissive"
+	}
+	return "unknown"
+}
+
+// RenderMaterial is the reduced material description the renderer works with
+type RenderMaterial struct {
+	Kind     MaterialKind
+	Albedo   mgl32.Vec3
+	Emission mgl32.Vec3
+	// 0 is a perfect mirror, 1 is fully rough
+	Roughness float32
+	IOR       float32
+	Opacity   float32
+}
+
+// Render maps the phong style .mtl parameters onto a RenderMaterial
+func (m Material) Render() RenderMaterial {
+	rm := RenderMaterial{
+		Kind:     Diffuse,
+		Albedo:   m.Diffuse,
+		Emission: m.Emissive,
+		// blinn-phong exponent to beckmann roughness
+		Roughness: float32(math.Sqrt(2 / (float64(m.SpecularExponent) + 2))),
+		IOR:       m.OpticalDensity,
+		Opacity:   m.Dissolve,
+	}
+
+	if m.Roughness >= 0 {
+		rm.Roughness = m.Roughness
+	}
+
+	switch {
+	case maxComponent(m.Emissive) > 0:
+		rm.Kind = Emissive
+	case m.Dissolve < 1 || m.Illum == 4 || m.Illum == 6 || m.Illum == 7 || m.Illum == 9:
+		// transparent illumination models
+		rm.Kind = Dielectric
+		rm.Albedo = m.TransmissionFilter
+	case m.Metallic >= 0.5:
+		// metals tint their reflections with the base color
+		rm.Kind = Glossy
+	case m.Illum == 3 || m.Illum == 5 || m.Illum == 8:
+		// reflective illumination models
+		rm.Kind = Glossy
+		rm.Albedo = m.Diffuse.Add(m.Specular)
+	case m.Illum >= 2 && maxComponent(m.Specular) > maxComponent(m.Diffuse):
+		rm.Kind = Glossy
+		rm.Albedo = m.Specular
+	}
+
+	return rm
+}
+
+func maxComponent(v mgl32.Vec3) float32 {
+	m := v[0]
+	if v[1] > m {
+		m = v[1]
+	}
+	if v[2] > m {
+		m = v[2]
+	}
+	return m
+}
@@ -0,0 +1,142 @@
+package objparser
+
+import (
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+type AttributeFlags uint8
+
+const (
+	HasNormals AttributeFlags = 1 << iota
+	HasUVs
+	HasColors
+)
+
+// Vertex is one unique position/normal/uv combination of a Mesh
+type Vertex struct {
+	Position mgl32.Vec3
+	Normal   mgl32.Vec3
+	UV       mgl32.Vec2
+	// 0 to 1, only formats with per-vertex colors like PLY set it
+	Color mgl32.Vec3
+	// tells which attributes came from the file or were set with package
+	// meshutil, the others are synthesized:
+	// normals are the averaged normals of the adjacent faces, in .obj files
+	// only of those in the same smoothing group and the normal of the
+	// triangle if smoothing is off. uvs and colors are zero.
+	Flags AttributeFlags
+}
+
+// Object is an "o" statement. Faces before the first one belong to an
+// object without a name.
+type Object struct {
+	Name   string
+	Groups []Group
+}
+
+// Group is a run of consecutive triangles with the same "g" names and
+// smoothing group. A group that is interrupted by another one shows up once
+// per run.
+type Group struct {
+	// a face can be in several groups at once, "default" if none was given
+	Names []string
+	// 0 if smoothing is off
+	Smoothing uint32
+	// the triangles [Start, Start+Count) of the mesh
+	Start, Count int
+}
+
+// Mesh is an indexed triangle mesh together with its materials
+type Mesh struct {
+	Vertices []Vertex
+	// three indices into Vertices per triangle
+	Indices []uint32
+	// one index into Materials per triangle, -1 if it has none
+	FaceMaterials []int32
+	// the smoothing group of every triangle, the Smoothing of its Group. 0
+	// if smoothing is off or the format has no smoothing groups.
+	FaceSmoothing []uint32
+	Materials     []Material
+	// the o/g/s structure of the triangles, every triangle is in exactly one Group
+	Objects []Object
+	// the decoded texture maps of Materials, nil unless Loader.LoadTextures is set
+	Atlas *TextureAtlas
+	// problems that did not stop the parser, see Loader.Lenient
+	Warnings []*ParseError
+}
+
+func (m *Mesh) TriangleCount() int {
+	return len(m.Indices) / 3
+}
+
+// Triangles expands the mesh into the triangle soup the compute shader reads.
+// Triangles whose corners all have colors are colored with their average
+// instead of the albedo of their material.
+func (m *Mesh) Triangles() []Triangle {
+	materials := make([]RenderMaterial, len(m.Materials))
+	for i := range m.Materials {
+		materials[i] = m.Materials[i].Render()
+	}
+
+	triangles := make([]Triangle, m.TriangleCount())
+	for i := range triangles {
+		var color, intensity mgl32.Vec3
+		if mat := m.FaceMaterials[i]; mat >= 0 {
+			color = materials[mat].Albedo
+			intensity = materials[mat].Emission
+		}
+		a, b, c := &m.Vertices[m.Indices[3*i]], &m.Vertices[m.Indices[3*i+1]], &m.Vertices[m.Indices[3*i+2]]
+		if a.Flags&b.Flags&c.Flags&HasColors != 0 {
+			color = a.Color.Add(b.Color).Add(c.Color).Mul(1.0 / 3)
+		}
+		triangles[i] = Triangle{
+			A:         a.Position.Vec4(-1337),
+			B:         b.Position.Vec4(-1337),
+			C:         c.Position.Vec4(-1337),
+			Color:     color.Vec4(-1337),
+			Intensity: intensity.Vec4(-1337),
+		}
+	}
+	return triangles
+}
+
+// Select returns a copy of the mesh with only the groups keep returns true
+// for, e.g. to hide or instance parts of a model. Vertices that are no
+// longer used are dropped, materials are kept as they are.
+func (m *Mesh) Select(keep func(obj *Object, g *Group) bool) *Mesh {
+	out := &Mesh{Materials: m.Materials, Atlas: m.Atlas}
+	remap := map[uint32]uint32{}
+
+	for i := range m.Objects {
+		obj := &m.Objects[i]
+		selected := Object{Name: obj.Name}
+		for j := range obj.Groups {
+			g := &obj.Groups[j]
+			if !keep(obj, g) {
+				continue
+			}
+
+			ng := *g
+			ng.Start = out.TriangleCount()
+			for t := g.Start; t < g.Start+g.Count; t++ {
+				for _, idx := range m.Indices[3*t : 3*t+3] {
+					nidx, ok := remap[idx]
+					if !ok {
+						nidx = uint32(len(out.Vertices))
+						out.Vertices = append(out.Vertices, m.Vertices[idx])
+						remap[idx] = nidx
+					}
+					out.Indices = append(out.Indices, nidx)
+				}
+				out.FaceMaterials = append(out.FaceMaterials, m.FaceMaterials[t])
+				out.FaceSmoothing = append(out.FaceSmoothing, m.FaceSmoothing[t])
+			}
+			selected.Groups = append(selected.Groups, ng)
+		}
+		if len(selected.Groups) > 0 {
+			out.Objects = append(out.Objects, selected)
+		}
+	}
+
+	return out
+}
@@ -0,0 +1,315 @@
+package objparser
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	s "strings"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+type token struct {
+	text string
+	// 1-based byte offset into the line
+	col int
+}
+
+// fields splits a line on blanks and drops everything after a '#'
+func fields(line string) []token {
+	toks := []token{}
+	start := -1
+	for i := 0; i <= len(line); i++ {
+		end := i == len(line) || line[i] == '#'
+		if end || line[i] == ' ' || line[i] == '\t' || line[i] == '\r' {
+			if start >= 0 {
+				toks = append(toks, token{line[start:i], start + 1})
+				start = -1
+			}
+			if end {
+				break
+			}
+		} else if start < 0 {
+			start = i
+		}
+	}
+	return toks
+}
+
+// reader is the line based tokenizer of the .mtl parser
+type reader struct {
+	file string
+	line int
+	// the current line, file names may contain blanks
+	text     string
+	lenient  bool
+	warnings *[]*ParseError
+}
+
+func (r *reader) errorAt(tok token, err error) *ParseError {
+	return &ParseError{File: r.file, Line: r.line, Column: tok.col, Token: tok.text, Err: err}
+}
+
+// span returns the text of the line covered by toks, blanks included
+func (r *reader) span(toks []token) string {
+	first, last := toks[0], toks[len(toks)-1]
+	return r.text[first.col-1 : last.col-1+len(last.text)]
+}
+
+func (r *reader) warn(tok token, err error) {
+	*r.warnings = append(*r.warnings, r.errorAt(tok, err))
+}
+
+// unsupported fails in strict mode and records a warning in lenient mode
+func (r *reader) unsupported(tok token) error {
+	if !r.lenient {
+		return r.errorAt(tok, ErrUnsupported)
+	}
+	r.warn(tok, ErrUnsupported)
+	return nil
+}
+
+// floats parses the first n numbers following the directive tok
+func (r *reader) floats(tok token, args []token, n int) ([]float32, error) {
+	if len(args) < n {
+		return nil, r.errorAt(tok, ErrArguments)
+	}
+	out := make([]float32, n)
+	for i := range out {
+		f, err := strconv.ParseFloat(args[i].text, 32)
+		if err != nil {
+			return nil, r.errorAt(args[i], ErrNumber)
+		}
+		out[i] = float32(f)
+	}
+	return out, nil
+}
+
+func parseMtl(in io.Reader, name string, lenient bool, warnings *[]*ParseError) ([]Material, error) {
+	materials := []Material{}
+	r := &mtlReader{reader: reader{file: name, lenient: lenient, warnings: warnings}}
+
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		r.line++
+		r.text = scanner.Text()
+		toks := fields(r.text)
+		if len(toks) == 0 {
+			continue
+		}
+		dir, args := toks[0], toks[1:]
+
+		if dir.text == "newmtl" {
+			if len(args) == 0 {
+				return nil, r.errorAt(dir, ErrArguments)
+			}
+			// the whole rest of the line like usemtl, names may contain blanks
+			materials = append(materials, NewMaterial(r.span(args)))
+			continue
+		}
+		if len(materials) == 0 {
+			return nil, r.errorAt(dir, ErrNoMaterial)
+		}
+		if err := r.parseLine(&materials[len(materials)-1], dir, args); err != nil {
+			return nil, err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return materials, nil
+}
+
+type mtlReader struct {
+	reader
+}
+
+func (r *mtlReader) parseLine(cur *Material, dir token, args []token) error {
+	var err error
+	switch dir.text {
+	case "Ka":
+		err = r.color(&cur.Ambient, dir, args)
+	case "Kd":
+		err = r.color(&cur.Diffuse, dir, args)
+	case "Ks":
+		err = r.color(&cur.Specular, dir, args)
+	case "Ke":
+		err = r.color(&cur.Emissive, dir, args)
+	case "Tf":
+		err = r.color(&cur.TransmissionFilter, dir, args)
+	case "Ns":
+		err = r.scalar(&cur.SpecularExponent, dir, args)
+	case "Ni":
+		err = r.scalar(&cur.OpticalDensity, dir, args)
+	case "d":
+		// "d -halo factor" is read as a plain dissolve
+		if len(args) > 0 && args[0].text == "-halo" {
+			args = args[1:]
+		}
+		err = r.scalar(&cur.Dissolve, dir, args)
+	case "Tr":
+		tr := 1 - cur.Dissolve
+		err = r.scalar(&tr, dir, args)
+		cur.Dissolve = 1 - tr
+	case "Pr":
+		err = r.scalar(&cur.Roughness, dir, args)
+	case "Pm":
+		err = r.scalar(&cur.Metallic, dir, args)
+	case "illum":
+		if len(args) == 0 {
+			return r.errorAt(dir, ErrArguments)
+		}
+		cur.Illum, err = strconv.Atoi(args[0].text)
+		if err != nil {
+			return r.errorAt(args[0], ErrNumber)
+		}
+
+	case "map_Ka":
+		cur.AmbientMap, err = r.textureMap(dir, args)
+	case "map_Kd":
+		cur.DiffuseMap, err = r.textureMap(dir, args)
+	case "map_Ks":
+		cur.SpecularMap, err = r.textureMap(dir, args)
+	case "map_Ke":
+		cur.EmissiveMap, err = r.textureMap(dir, args)
+	case "map_Ns":
+		cur.SpecularExponentMap, err = r.textureMap(dir, args)
+	case "map_d":
+		cur.DissolveMap, err = r.textureMap(dir, args)
+	case "map_Bump", "map_bump", "bump":
+		cur.BumpMap, err = r.textureMap(dir, args)
+	case "disp":
+		cur.DisplacementMap, err = r.textureMap(dir, args)
+	case "map_Pr":
+		cur.RoughnessMap, err = r.textureMap(dir, args)
+	case "map_Pm":
+		cur.MetallicMap, err = r.textureMap(dir, args)
+
+	case "sharpness", "decal", "refl":
+		// valid, but not used for rendering yet
+
+	default:
+		return r.unsupported(dir)
+	}
+	return err
+}
+
+// color reads "r g b" or a single gray value into dst, spectral and xyz
+// colors are not supported
+func (r *mtlReader) color(dst *mgl32.Vec3, dir token, args []token) error {
+	if len(args) > 0 && (args[0].text == "spectral" || args[0].text == "xyz") {
+		return r.unsupported(args[0])
+	}
+	if len(args) < 3 {
+		v, err := r.floats(dir, args, 1)
+		if err != nil {
+			return err
+		}
+		*dst = mgl32.Vec3{v[0], v[0], v[0]}
+		return nil
+	}
+	v, err := r.floats(dir, args, 3)
+	if err != nil {
+		return err
+	}
+	*dst = mgl32.Vec3{v[0], v[1], v[2]}
+	return nil
+}
+
+func (r *mtlReader) scalar(dst *float32, dir token, args []token) error {
+	v, err := r.floats(dir, args, 1)
+	if err != nil {
+		return err
+	}
+	*dst = v[0]
+	return nil
+}
+
+// textureMap reads "map_xx [options] file", the file is resolved relative to the .mtl file
+func (r *mtlReader) textureMap(dir token, args []token) (*TextureMap, error) {
+	tm := &TextureMap{
+		Scale:          mgl32.Vec3{1, 1, 1},
+		BumpMultiplier: 1,
+		file:           r.file,
+		line:           r.line,
+	}
+
+	for len(args) > 0 && s.HasPrefix(args[0].text, "-") {
+		opt := args[0]
+		args = args[1:]
+
+		var err error
+		switch opt.text {
+		case "-s":
+			args, err = r.optionVec(&tm.Scale, opt, args)
+		case "-o":
+			args, err = r.optionVec(&tm.Offset, opt, args)
+		case "-t":
+			var turbulence mgl32.Vec3
+			args, err = r.optionVec(&turbulence, opt, args)
+		case "-bm":
+			args, err = r.optionScalar(&tm.BumpMultiplier, opt, args)
+		case "-clamp":
+			if len(args) == 0 {
+				return nil, r.errorAt(opt, ErrArguments)
+			}
+			tm.Clamp = args[0].text == "on"
+			args = args[1:]
+		case "-blendu", "-blendv", "-cc", "-imfchan":
+			if len(args) == 0 {
+				return nil, r.errorAt(opt, ErrArguments)
+			}
+			args = args[1:]
+		case "-boost", "-texres":
+			var ignored float32
+			args, err = r.optionScalar(&ignored, opt, args)
+		case "-mm":
+			var base, gain float32
+			if args, err = r.optionScalar(&base, opt, args); err == nil {
+				args, err = r.optionScalar(&gain, opt, args)
+			}
+		default:
+			err = r.unsupported(opt)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(args) == 0 {
+		return nil, r.errorAt(dir, ErrArguments)
+	}
+
+	// everything after the options is the file name, blanks included
+	tm.token = token{r.span(args), args[0].col}
+	tm.Path = Resolve(r.file, tm.token.text)
+
+	return tm, nil
+}
+
+func (r *mtlReader) optionScalar(dst *float32, opt token, args []token) ([]token, error) {
+	if err := r.scalar(dst, opt, args); err != nil {
+		return args, err
+	}
+	return args[1:], nil
+}
+
+// optionVec reads the one to three numbers of a texture option into dst
+func (r *mtlReader) optionVec(dst *mgl32.Vec3, opt token, args []token) ([]token, error) {
+	n := 0
+	for n < 3 && n < len(args) {
+		if _, err := strconv.ParseFloat(args[n].text, 32); err != nil {
+			break
+		}
+		n++
+	}
+	if n == 0 {
+		return args, r.errorAt(opt, ErrArguments)
+	}
+	v, err := r.floats(opt, args, n)
+	if err != nil {
+		return args, err
+	}
+	copy(dst[:], v)
+	return args[n:], nil
+}
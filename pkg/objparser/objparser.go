@@ -1,21 +1,15 @@
 package objparser
 
 import (
-	"bufio"
-	"os"
-	"log"
-	"strconv"
-	s "strings"
-	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+
 	"github.com/go-gl/mathgl/mgl32"
+	"github.com/supermuesli/computeshader/pkg/triangulate"
 )
 
-type Material struct {
-	Name      string
-	Color     [3]float32 
-	Intensity [3]float32
-}
-
 type Triangle struct {
 	A         mgl32.Vec4
 	B         mgl32.Vec4
@@ -24,225 +18,385 @@ type Triangle struct {
 	Intensity mgl32.Vec4
 }
 
-func GetTriangles(path string) []Triangle {
-	vertices   := []float32{}
-	parsedMtls := []Material{}
-	triangles  := []Triangle{}
+// Loader configures how .obj files are parsed. The zero value is ready to use.
+type Loader struct {
+	// Lenient reports unsupported directives and missing material
+	// libraries as warnings instead of failing the whole file.
+	Lenient bool
+	// LoadTextures decodes the texture maps of all materials into Mesh.Atlas
+	LoadTextures bool
+	// Resolver opens the .obj file and everything it refers to, relative
+	// names are resolved against the directory of the referring file.
+	// Files are read from disk if it is nil.
+	Resolver Resolver
+	// Workers > 1 reads the whole file into memory and tokenizes it with
+	// that many goroutines. The result is the same as with one worker.
+	Workers int
+}
 
-	curColor     := [3]float32{0, 0, 0}
-	curIntensity := [3]float32{0, 0, 0}
+// Load parses the .obj file at path with the default Loader
+func Load(path string) (*Mesh, error) {
+	var l Loader
+	return l.Load(path)
+}
 
-	cwd, err := os.Getwd()
+// GetTriangles parses the .obj file at path and returns its triangles
+func GetTriangles(path string) ([]Triangle, error) {
+	mesh, err := Load(path)
 	if err != nil {
-		panic(err)
+		return nil, err
+	}
+	return mesh.Triangles(), nil
+}
+
+// Load parses the .obj file name, which is a path on disk or a name for
+// l.Resolver
+func (l *Loader) Load(name string) (*Mesh, error) {
+	res := l.resolver()
+	if l.Resolver == nil {
+		name = filepath.ToSlash(name)
 	}
 
-	file, err := os.Open(path)
+	file, err := res.Open(name)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 	defer file.Close()
 
-	scanner := bufio.NewScanner(file)
-
-	for scanner.Scan() {
-		cur := scanner.Text()
-		//fmt.Println("cur at start", cur)
-		if len(cur) > 1 {
-			// delete all tabs
-			cur = s.ReplaceAll(cur, "\t", " ")
-			//fmt.Println("cut after tabs", cur)
-			// delete all double spaces
-			for {
-				cur = s.ReplaceAll(cur, "  ", " ")
-				if !s.Contains(cur, "  ") {
-					break
-				}
-			}
-			//fmt.Println("cur after double spaces", cur)
-			// delete all prefix spaces
-			for {
-				if cur == " " {
-					break
-				}
-				if string(cur[0]) == " " {
-					cur = cur[1:]
-				} else {
-					break
-				}
-			}
-			//fmt.Println("cur after prefix spaces", cur)
-			if len(cur) > 5  {
-				if cur[:6] == "mtllib" {
-					fmt.Println("parsing", cwd + "/pkg/3dmodels/" + s.Split(cur, " ")[1])
-					parsedMtls = append(parsedMtls, parseMtl(cwd + "/pkg/3dmodels/" + s.Split(cur, " ")[1])...)
-
-				} else if cur[:6] == "usemtl" {
-					materialName := s.Split(cur, " ")[1]
-					for _, pm := range parsedMtls {
-						if pm.Name == materialName {
-							curColor = pm.Color
-							curIntensity = pm.Intensity
-							break
-						}
-					}
-
-				}
-			} 
-			if string(cur[0]) == "v" && string(cur[1]) == " " {
-				curVertex := s.Split(cur, " ")
-				curVertex = curVertex[1:]
-				//fmt.Println("cur at v", cur)
-				v0, err := strconv.ParseFloat(curVertex[0], 32)
-				if err != nil {
-					log.Fatal(err)
-				}
-				v1, err := strconv.ParseFloat(curVertex[1], 32)
-				if err != nil {
-					log.Fatal(err)
-				}
-				v2, err := strconv.ParseFloat(curVertex[2], 32)
-				if err != nil {
-					log.Fatal(err)
-				}
-				vertices = append(vertices, []float32{float32(v0), float32(v1), float32(v2)}...)
-			} else if string(cur[0]) == "f" {
-				curFace := s.Split(cur, " ")[1:]
-				i0, err := strconv.Atoi(s.Split(curFace[0], "/")[0])
-				if err != nil {
-					log.Fatal(err)
-				}
-				i1, err := strconv.Atoi(s.Split(curFace[1], "/")[0])
-				if err != nil {
-					log.Fatal(err)
-				}
-				i2, err := strconv.Atoi(s.Split(curFace[2], "/")[0])
-				if err != nil {
-					log.Fatal(err)
-				}
-				i3 := 99999999
-				if len(curFace) == 4 {
-					i3, err = strconv.Atoi(s.Split(curFace[3], "/")[0])
-					if err != nil {
-						log.Fatal(err)
-					}
-				}
-
-				if i0 < 1 {
-					i0 = len(vertices) + 3*i0
-				}
-				if i1 < 1 {
-					i1 = len(vertices) + 3*i1
-				}
-				if i2 < 1 {
-					i2 = len(vertices) + 3*i2
-				}
-				if i3 < 1 {
-					i3 = len(vertices) + 3*i3
-				}
-
-				triangles = append(triangles, Triangle {
-					C: mgl32.Vec4{vertices[i2], vertices[i2 + 1], vertices[i2 + 2], -1337},
-					B: mgl32.Vec4{vertices[i1], vertices[i1 + 1], vertices[i1 + 2], -1337},
-					A: mgl32.Vec4{vertices[i0], vertices[i0 + 1], vertices[i0 + 2], -1337},
-					Color: mgl32.Vec4{curColor[0], curColor[1], curColor[2], -1337},
-					Intensity: mgl32.Vec4{curIntensity[0], curIntensity[1], curIntensity[2], -1337},
-				})
-				
-				// triangulate quad
-				if len(curFace) == 4 {	
-					triangles = append(triangles, Triangle {
-						C: mgl32.Vec4{vertices[i3], vertices[i3 + 1], vertices[i3 + 2], -1337},
-						B: mgl32.Vec4{vertices[i2], vertices[i2 + 1], vertices[i2 + 2], -1337},
-						A: mgl32.Vec4{vertices[i0], vertices[i0 + 1], vertices[i0 + 2], -1337},
-						Color: mgl32.Vec4{curColor[0], curColor[1], curColor[2], -1337},
-						Intensity: mgl32.Vec4{curIntensity[0], curIntensity[1], curIntensity[2], -1337},
-					})
-				}
-			} 
+	return l.Parse(file, name)
+}
+
+// Parse reads an .obj file from in. name is used in errors and to resolve
+// the material libraries.
+func (l *Loader) Parse(in io.Reader, name string) (*Mesh, error) {
+	if l.Workers > 1 {
+		data, err := ioutil.ReadAll(in)
+		if err != nil {
+			return nil, err
 		}
+		return l.parseParallel(data, name)
 	}
 
-	if err := scanner.Err(); err != nil {
-		log.Fatal(err)
+	b := newMeshBuilder(l, name)
+	if err := b.parser.Parse(in, name); err != nil {
+		return nil, err
 	}
+	return b.finish(), nil
+}
 
-	fmt.Println("len(triangles)", len(triangles))
-	return triangles
+func (l *Loader) resolver() Resolver {
+	if l.Resolver == nil {
+		return DiskResolver
+	}
+	return l.Resolver
 }
 
-func parseMtl(path string) []Material {
-	materials := []Material{} 
-	file, err := os.Open(path)
-	if err != nil {
-		panic(err)
+// meshBuilder turns the statements coming from a Parser into a Mesh
+type meshBuilder struct {
+	parser       *Parser
+	lenient      bool
+	loadTextures bool
+	resolver     Resolver
+	mesh         *Mesh
+	positions    []mgl32.Vec3
+	texcoords    []mgl32.Vec2
+	normals      []mgl32.Vec3
+	// deduplicates the corners of all faces into mesh.Vertices
+	vertexIndex map[vertexKey]uint32
+	curMaterial int32
+	corners     []mgl32.Vec3
+	tris        [][3]int
+
+	// state of o, g and s, a change opens a new Group on the next face
+	objectName string
+	groupNames []string
+	smoothing  uint32
+	newObject  bool
+	newGroup   bool
+}
+
+func newMeshBuilder(l *Loader, name string) *meshBuilder {
+	b := &meshBuilder{
+		parser:       &Parser{file: name},
+		lenient:      l.Lenient,
+		loadTextures: l.LoadTextures,
+		resolver:     l.resolver(),
+		mesh:         &Mesh{},
+		vertexIndex:  map[vertexKey]uint32{},
+		curMaterial:  -1,
+		groupNames:   []string{"default"},
+		newGroup:     true,
+	}
+
+	p := b.parser
+	p.OnVertex = func(v mgl32.Vec3) error {
+		b.positions = append(b.positions, v)
+		return nil
+	}
+	p.OnTexCoord = func(uv mgl32.Vec2) error {
+		b.texcoords = append(b.texcoords, uv)
+		return nil
+	}
+	p.OnNormal = func(n mgl32.Vec3) error {
+		b.normals = append(b.normals, normalize(n))
+		return nil
+	}
+	p.OnFace = b.face
+	p.OnMtllib = b.mtllib
+	p.OnUsemtl = b.usemtl
+	p.OnObject = func(name string) error {
+		b.objectName = name
+		b.newObject = true
+		b.newGroup = true
+		return nil
+	}
+	p.OnGroup = func(names []string) error {
+		if !equalNames(names, b.groupNames) {
+			b.groupNames = names
+			b.newGroup = true
+		}
+		return nil
+	}
+	p.OnSmoothing = func(group uint32) error {
+		if group != b.smoothing {
+			b.smoothing = group
+			b.newGroup = true
+		}
+		return nil
+	}
+	p.OnUnknown = func(directive string) error {
+		if !b.lenient {
+			return ErrUnsupported
+		}
+		b.warn(p.dirError(ErrUnsupported))
+		return nil
+	}
+
+	return b
+}
+
+// normalize is Normalize that leaves zero vectors and vectors that are
+// already unit length alone, normalizing twice would change the last bits
+// and files written by Write would not load back the same
+func normalize(n mgl32.Vec3) mgl32.Vec3 {
+	if l := n.Len(); l > 0 && math.Abs(float64(l)-1) > 1e-6 {
+		return n.Mul(1 / l)
+	}
+	return n
+}
+
+func (b *meshBuilder) warn(err *ParseError) {
+	b.mesh.Warnings = append(b.mesh.Warnings, err)
+}
+
+func (b *meshBuilder) finish() *Mesh {
+	b.finishNormals()
+	if b.loadTextures {
+		b.mesh.LoadTextures(b.resolver)
+	}
+	return b.mesh
+}
+
+func (b *meshBuilder) usemtl(name string) error {
+	for i, m := range b.mesh.Materials {
+		if m.Name == name {
+			b.curMaterial = int32(i)
+			return nil
+		}
+	}
+	// the previous material stays active
+	b.warn(b.parser.argsError(ErrUnknownMaterial))
+	return nil
+}
+
+// mtllib loads the libraries named in names. A line can list several
+// libraries and each of them can contain blanks, so the longest run of
+// arguments that names an existing file wins.
+func (b *meshBuilder) mtllib(names string) error {
+	// tokenize names like a line of its own and shift the columns back
+	r := &reader{file: b.parser.file, line: b.parser.line, text: names}
+	args := fields(names)
+	for i := range args {
+		args[i].col += b.parser.argCol - 1
+	}
+	shift := b.parser.argCol - 1
+	span := func(toks []token) string {
+		first, last := toks[0], toks[len(toks)-1]
+		return names[first.col-1-shift : last.col-1-shift+len(last.text)]
 	}
-	defer file.Close()
 
-	scanner := bufio.NewScanner(file)
-
-	for scanner.Scan() {
-		cur := scanner.Text()
-		if len(cur) > 1 {
-			cur = s.ReplaceAll(cur, "\t", " ")
-			for {
-				cur = s.ReplaceAll(cur, "  ", " ")
-				if !s.Contains(cur, "  ") {
-					break
-				}
+	for len(args) > 0 {
+		var (
+			file io.ReadCloser
+			name string
+			err  error
+			n    int
+		)
+		for n = len(args); n > 0; n-- {
+			name = Resolve(r.file, span(args[:n]))
+			if file, err = b.resolver.Open(name); err == nil {
+				break
 			}
-			for {
-				if cur == " " {
-					break
-				}
-				if string(cur[0]) == " " {
-					cur = cur[1:]
-				} else {
-					break
-				}
+		}
+
+		if file == nil {
+			// err is the one of the single argument
+			if !b.lenient {
+				return r.errorAt(args[0], err)
 			}
-			if len(cur) > 5 {
-				if cur[:6] == "newmtl" {
-					materials = append(materials, Material {
-						Name: s.Split(cur, " ")[1],
-						Color: [3]float32{0, 0, 0},
-						Intensity: [3]float32{0, 0, 0},
-					})
-				} 
-			} 
-			if string(cur[0]) == "K" && string(cur[1]) == "a" {
-				curVertex := s.Split(cur, " ")[1:]
-				r, err := strconv.ParseFloat(curVertex[0], 32)
-				if err != nil {
-					log.Fatal(err)
-				}
-				g, err := strconv.ParseFloat(curVertex[1], 32)
-				if err != nil {
-					log.Fatal(err)
-				}
-				b, err := strconv.ParseFloat(curVertex[2], 32)
-				if err != nil {
-					log.Fatal(err)
-				}
-				materials[len(materials)-1].Color = [3]float32{float32(r),float32(g),float32(b)}
-			} else if string(cur[0]) == "K" && string(cur[1]) == "e" {
-				curVertex := s.Split(cur, " ")[1:]
-				r, err := strconv.ParseFloat(curVertex[0], 32)
-				if err != nil {
-					log.Fatal(err)
-				}
-				g, err := strconv.ParseFloat(curVertex[1], 32)
-				if err != nil {
-					log.Fatal(err)
-				}
-				b, err := strconv.ParseFloat(curVertex[2], 32)
-				if err != nil {
-					log.Fatal(err)
-				}
-				materials[len(materials)-1].Intensity = [3]float32{float32(r),float32(g),float32(b)}
+			b.warn(r.errorAt(args[0], err))
+			args = args[1:]
+			continue
+		}
+
+		mtls, err := parseMtl(file, name, b.lenient, &b.mesh.Warnings)
+		file.Close()
+		if err != nil {
+			return err
+		}
+		b.mesh.Materials = append(b.mesh.Materials, mtls...)
+		args = args[n:]
+	}
+	return nil
+}
+
+func (b *meshBuilder) face(fvs []FaceVertex) error {
+	corners := b.corners[:0]
+	for _, fv := range fvs {
+		corners = append(corners, b.positions[fv.V])
+	}
+	b.corners = corners
+
+	tris := append(b.tris[:0], [3]int{0, 1, 2})
+	if len(corners) == 4 && convexQuad(corners) {
+		// the common case, same result as the ear clipper but without allocations
+		tris = append(tris, [3]int{0, 2, 3})
+	} else if len(corners) > 3 {
+		var err error
+		tris, err = triangulate.Polygon(corners)
+		if err != nil {
+			// keep the face as a fan so that nothing goes missing
+			b.warn(b.parser.dirError(err))
+			tris = tris[:0]
+			for i := 2; i < len(corners); i++ {
+				tris = append(tris, [3]int{0, i - 1, i})
 			}
 		}
 	}
 
-	return materials
-}
\ No newline at end of file
+	b.tris = tris
+	b.addToGroup(len(tris))
+	for _, t := range tris {
+		tri := b.mesh.TriangleCount()
+		b.mesh.Indices = append(b.mesh.Indices, b.vertex(fvs[t[0]], tri), b.vertex(fvs[t[1]], tri), b.vertex(fvs[t[2]], tri))
+		b.mesh.FaceMaterials = append(b.mesh.FaceMaterials, b.curMaterial)
+		b.mesh.FaceSmoothing = append(b.mesh.FaceSmoothing, b.smoothing)
+
+		// accumulate area weighted face normals for corners without vn,
+		// which are only shared within the smoothing group
+		p0, p1, p2 := corners[t[0]], corners[t[1]], corners[t[2]]
+		faceNormal := p1.Sub(p0).Cross(p2.Sub(p0))
+		for _, idx := range b.mesh.Indices[len(b.mesh.Indices)-3:] {
+			v := &b.mesh.Vertices[idx]
+			if v.Flags&HasNormals == 0 {
+				v.Normal = v.Normal.Add(faceNormal)
+			}
+		}
+	}
+
+	return nil
+}
+
+// convexQuad reports whether q is a strictly convex, planar enough quad
+func convexQuad(q []mgl32.Vec3) bool {
+	n := q[2].Sub(q[0]).Cross(q[3].Sub(q[1]))
+	for i := range q {
+		a, b, c := q[i], q[(i+1)%4], q[(i+2)%4]
+		if b.Sub(a).Cross(c.Sub(b)).Dot(n) <= 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// addToGroup adds the next n triangles to the current Group
+func (b *meshBuilder) addToGroup(n int) {
+	objects := &b.mesh.Objects
+	if b.newObject || len(*objects) == 0 {
+		*objects = append(*objects, Object{Name: b.objectName})
+		b.newObject = false
+	}
+	obj := &(*objects)[len(*objects)-1]
+
+	if b.newGroup {
+		obj.Groups = append(obj.Groups, Group{
+			Names:     b.groupNames,
+			Smoothing: b.smoothing,
+			Start:     b.mesh.TriangleCount(),
+		})
+		b.newGroup = false
+	}
+	obj.Groups[len(obj.Groups)-1].Count += n
+}
+
+func equalNames(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// vertexKey tells the vertices of a Mesh apart. Corners without vn get the
+// averaged normal of the faces of their smoothing group, or the normal of
+// their triangle tri if smoothing is off.
+type vertexKey struct {
+	FaceVertex
+	smoothing uint32
+	tri       int
+}
+
+// vertex returns the index of the corner fv of the triangle tri in
+// mesh.Vertices, adding it if needed
+func (b *meshBuilder) vertex(fv FaceVertex, tri int) uint32 {
+	key := vertexKey{FaceVertex: fv, tri: -1}
+	if fv.VN < 0 {
+		if b.smoothing == 0 {
+			key.tri = tri
+		} else {
+			key.smoothing = b.smoothing
+		}
+	}
+	if idx, ok := b.vertexIndex[key]; ok {
+		return idx
+	}
+
+	v := Vertex{Position: b.positions[fv.V]}
+	if fv.VN >= 0 {
+		v.Normal = b.normals[fv.VN]
+		v.Flags |= HasNormals
+	}
+	if fv.VT >= 0 {
+		v.UV = b.texcoords[fv.VT]
+		v.Flags |= HasUVs
+	}
+
+	idx := uint32(len(b.mesh.Vertices))
+	b.mesh.Vertices = append(b.mesh.Vertices, v)
+	b.vertexIndex[key] = idx
+	return idx
+}
+
+// finishNormals normalizes the accumulated normals of vertices without vn
+func (b *meshBuilder) finishNormals() {
+	for i := range b.mesh.Vertices {
+		v := &b.mesh.Vertices[i]
+		if v.Flags&HasNormals == 0 && v.Normal.Len() > 0 {
+			v.Normal = v.Normal.Normalize()
+		}
+	}
+}
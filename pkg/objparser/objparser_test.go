@@ -0,0 +1,451 @@
+package objparser
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// memFS resolves names to inline files
+type memFS map[string]string
+
+func (fs memFS) Open(name string) (io.ReadCloser, error) {
+	data, ok := fs[name]
+	if !ok {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+	return ioutil.NopCloser(strings.NewReader(data)), nil
+}
+
+func parseString(t *testing.T, l Loader, obj string) (*Mesh, error) {
+	t.Helper()
+	return l.Parse(strings.NewReader(obj), "test.obj")
+}
+
+const triangleVertices = "v 0 0 0\nv 1 0 0\nv 0 1 0\n"
+
+func TestFaceCorners(t *testing.T) {
+	tests := []struct {
+		name string
+		obj  string
+		// per corner of every triangle, nil if the file has none
+		positions []mgl32.Vec3
+		uvs       []mgl32.Vec2
+		normals   []mgl32.Vec3
+	}{
+		{
+			name:      "v",
+			obj:       triangleVertices + "f 1 2 3\n",
+			positions: []mgl32.Vec3{{0, 0, 0}, {1, 0, 0}, {0, 1, 0}},
+		},
+		{
+			name:      "v/vt",
+			obj:       triangleVertices + "vt 0 0\nvt 1 0\nvt 0 1\nf 1/3 2/2 3/1\n",
+			positions: []mgl32.Vec3{{0, 0, 0}, {1, 0, 0}, {0, 1, 0}},
+			uvs:       []mgl32.Vec2{{0, 1}, {1, 0}, {0, 0}},
+		},
+		{
+			name:      "v//vn normalized",
+			obj:       triangleVertices + "vn 0 0 2\nf 1//1 2//1 3//1\n",
+			positions: []mgl32.Vec3{{0, 0, 0}, {1, 0, 0}, {0, 1, 0}},
+			normals:   []mgl32.Vec3{{0, 0, 1}, {0, 0, 1}, {0, 0, 1}},
+		},
+		{
+			name:      "v/vt/vn",
+			obj:       triangleVertices + "vt 0.5 0.25\nvn 0 0 1\nvn 0 1 0\nf 1/1/2 2/1/1 3/1/2\n",
+			positions: []mgl32.Vec3{{0, 0, 0}, {1, 0, 0}, {0, 1, 0}},
+			uvs:       []mgl32.Vec2{{0.5, 0.25}, {0.5, 0.25}, {0.5, 0.25}},
+			normals:   []mgl32.Vec3{{0, 1, 0}, {0, 0, 1}, {0, 1, 0}},
+		},
+		{
+			name:      "vt without v",
+			obj:       triangleVertices + "vt 0.5\nf 1/1 2/1 3/1\n",
+			positions: []mgl32.Vec3{{0, 0, 0}, {1, 0, 0}, {0, 1, 0}},
+			uvs:       []mgl32.Vec2{{0.5, 0}, {0.5, 0}, {0.5, 0}},
+		},
+		{
+			name:      "negative",
+			obj:       triangleVertices + "vt 1 1\nvn 1 0 0\nf -3/-1/-1 -2/-1/-1 -1/-1/-1\n",
+			positions: []mgl32.Vec3{{0, 0, 0}, {1, 0, 0}, {0, 1, 0}},
+			uvs:       []mgl32.Vec2{{1, 1}, {1, 1}, {1, 1}},
+			normals:   []mgl32.Vec3{{1, 0, 0}, {1, 0, 0}, {1, 0, 0}},
+		},
+		{
+			name: "negative relative to the face",
+			obj:  triangleVertices + "f -3 -2 -1\nv 0 0 1\nv 1 0 1\nv 0 1 1\nf -3 -2 -1\n",
+			positions: []mgl32.Vec3{
+				{0, 0, 0}, {1, 0, 0}, {0, 1, 0},
+				{0, 0, 1}, {1, 0, 1}, {0, 1, 1},
+			},
+		},
+		{
+			name:      "mixed positive and negative",
+			obj:       triangleVertices + "v 1 1 0\nf 1 -3 -1\n",
+			positions: []mgl32.Vec3{{0, 0, 0}, {1, 0, 0}, {1, 1, 0}},
+		},
+		{
+			name: "quad",
+			obj:  triangleVertices + "v 1 1 0\nf 1 2 4 3\n",
+			positions: []mgl32.Vec3{
+				{0, 0, 0}, {1, 0, 0}, {1, 1, 0},
+				{0, 0, 0}, {1, 1, 0}, {0, 1, 0},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := parseString(t, Loader{}, tt.obj)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(m.Indices) != len(tt.positions) {
+				t.Fatalf("got %d corners, want %d", len(m.Indices), len(tt.positions))
+			}
+			for i, idx := range m.Indices {
+				v := m.Vertices[idx]
+				if v.Position != tt.positions[i] {
+					t.Errorf("corner %d: position %v, want %v", i, v.Position, tt.positions[i])
+				}
+				if got, want := v.Flags&HasUVs != 0, tt.uvs != nil; got != want {
+					t.Errorf("corner %d: has uvs %v, want %v", i, got, want)
+				} else if want && v.UV != tt.uvs[i] {
+					t.Errorf("corner %d: uv %v, want %v", i, v.UV, tt.uvs[i])
+				}
+				if got, want := v.Flags&HasNormals != 0, tt.normals != nil; got != want {
+					t.Errorf("corner %d: has normals %v, want %v", i, got, want)
+				} else if want && v.Normal != tt.normals[i] {
+					t.Errorf("corner %d: normal %v, want %v", i, v.Normal, tt.normals[i])
+				}
+			}
+		})
+	}
+}
+
+func TestFaceErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		obj    string
+		line   int
+		column int
+		token  string
+		err    error
+	}{
+		{"v out of range", triangleVertices + "f 1 2 4\n", 4, 7, "4", ErrIndex},
+		{"v zero", triangleVertices + "f 0 1 2\n", 4, 3, "0", ErrIndex},
+		{"v negative out of range", triangleVertices + "f 1 -4 2\n", 4, 5, "-4", ErrIndex},
+		{"v before its statement", "v 0 0 0\nv 1 0 0\nf 1 2 3\nv 0 1 0\n", 3, 7, "3", ErrIndex},
+		{"vt out of range", triangleVertices + "vt 0 0\nf 1/1 2/2 3/1\n", 5, 7, "2/2", ErrIndex},
+		{"vn out of range", triangleVertices + "f 1//1 2//1 3//1\n", 4, 3, "1//1", ErrIndex},
+		{"vn negative out of range", triangleVertices + "vn 0 0 1\nf 1//-2 2//1 3//1\n", 5, 3, "1//-2", ErrIndex},
+		{"malformed index", triangleVertices + "f 1 2/x 3\n", 4, 5, "2/x", ErrNumber},
+		{"missing v", triangleVertices + "f 1 2 /1\n", 4, 7, "/1", ErrNumber},
+		{"too many parts", triangleVertices + "f 1/1/1/1 2 3\n", 4, 3, "1/1/1/1", ErrNumber},
+		{"too few corners", triangleVertices + "f 1 2\n", 4, 1, "f", ErrArguments},
+		{"indented", triangleVertices + "\t f  1 2 9\n", 4, 10, "9", ErrIndex},
+		{"malformed vertex", "v 0 0\n", 1, 1, "v", ErrArguments},
+		{"malformed number", "v 0 0 1e\n", 1, 7, "1e", ErrNumber},
+	}
+
+	for _, tt := range tests {
+		for _, workers := range []int{0, 4} {
+			_, err := parseString(t, Loader{Workers: workers}, tt.obj)
+			var perr *ParseError
+			if !errors.As(err, &perr) {
+				t.Errorf("%s, %d workers: got %v, want a ParseError", tt.name, workers, err)
+				continue
+			}
+			if perr.File != "test.obj" || perr.Line != tt.line || perr.Column != tt.column || perr.Token != tt.token || !errors.Is(err, tt.err) {
+				t.Errorf("%s, %d workers: got %s:%d:%d %q %v, want test.obj:%d:%d %q %v", tt.name, workers,
+					perr.File, perr.Line, perr.Column, perr.Token, perr.Err, tt.line, tt.column, tt.token, tt.err)
+			}
+		}
+	}
+}
+
+func TestMtllibBlanks(t *testing.T) {
+	fs := memFS{
+		"models/my materials.mtl": "newmtl red\nKd 1 0 0\n",
+		"models/more.mtl":         "newmtl green\nKd 0 1 0\n",
+		"models/with blanks.obj": "mtllib my materials.mtl  more.mtl\n" + triangleVertices +
+			"usemtl green\nf 1 2 3\nusemtl red\nf 3 2 1\n",
+	}
+	l := Loader{Resolver: fs}
+	m, err := l.Load("models/with blanks.obj")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Materials) != 2 || m.Materials[0].Name != "red" || m.Materials[1].Name != "green" {
+		t.Fatalf("got materials %+v, want red and green", m.Materials)
+	}
+	if !reflect.DeepEqual(m.FaceMaterials, []int32{1, 0}) {
+		t.Errorf("got face materials %v, want [1 0]", m.FaceMaterials)
+	}
+	if m.Materials[0].Diffuse != (mgl32.Vec3{1, 0, 0}) {
+		t.Errorf("got Kd %v of red", m.Materials[0].Diffuse)
+	}
+
+	// a missing library is an error pointing at the first name it could be
+	fs["models/missing.obj"] = "mtllib no such.mtl\n"
+	_, err = l.Load("models/missing.obj")
+	var perr *ParseError
+	if !errors.As(err, &perr) || perr.Line != 1 || perr.Column != 8 || perr.Token != "no" || !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("got %v, want models/missing.obj:1:8 for \"no\"", err)
+	}
+
+	l.Lenient = true
+	m, err = l.Load("models/missing.obj")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Warnings) != 2 {
+		t.Errorf("got warnings %v, want one per name", m.Warnings)
+	}
+}
+
+func TestMaterialNameBlanks(t *testing.T) {
+	fs := memFS{
+		"names.mtl": "newmtl Blue Paint  # comment\nKd 0 0 1\nnewmtl Blue\nKd 0 1 1\n",
+		"names.obj": "mtllib names.mtl\n" + triangleVertices +
+			"usemtl Blue\nf 1 2 3\nusemtl  Blue Paint \nf 3 2 1\n",
+	}
+	l := Loader{Resolver: fs}
+	m, err := l.Load("names.obj")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Materials) != 2 || m.Materials[0].Name != "Blue Paint" || m.Materials[1].Name != "Blue" {
+		t.Fatalf("got materials %+v, want Blue Paint and Blue", m.Materials)
+	}
+	if !reflect.DeepEqual(m.FaceMaterials, []int32{1, 0}) || len(m.Warnings) != 0 {
+		t.Errorf("got face materials %v and warnings %v, want [1 0] and none", m.FaceMaterials, m.Warnings)
+	}
+
+	// the names survive writing the mesh out
+	var obj, mtl strings.Builder
+	if err := Write(&obj, m, "out.mtl"); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteMtl(&mtl, m.Materials, ""); err != nil {
+		t.Fatal(err)
+	}
+	fs["out.obj"], fs["out.mtl"] = obj.String(), mtl.String()
+	got, err := l.Load("out.obj")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Materials) != 2 || got.Materials[0].Name != "Blue Paint" || !reflect.DeepEqual(got.FaceMaterials, m.FaceMaterials) {
+		t.Errorf("got materials %+v and face materials %v after writing", got.Materials, got.FaceMaterials)
+	}
+}
+
+// bundled are the models in pkg/3dmodels
+var bundled = []struct {
+	file            string
+	triangles       int
+	materials       int
+	objects, groups int
+	// all vertices have normals, some have uvs
+	normals, texcoords bool
+}{
+	{"CornellBox-Original.obj", 36, 8, 1, 7, false, false},
+	{"plant.obj", 45840, 7, 2, 2, true, true},
+	{"testObj.obj", 11970, 5, 1, 5, true, true},
+}
+
+func TestBundledModels(t *testing.T) {
+	for _, tt := range bundled {
+		t.Run(tt.file, func(t *testing.T) {
+			m, err := Load("../3dmodels/" + tt.file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(m.Warnings) > 0 {
+				t.Errorf("warnings %v", m.Warnings)
+			}
+			if m.TriangleCount() != tt.triangles || len(m.FaceMaterials) != tt.triangles || len(m.FaceSmoothing) != tt.triangles {
+				t.Errorf("got %d triangles, %d face materials and %d smoothing groups, want %d",
+					m.TriangleCount(), len(m.FaceMaterials), len(m.FaceSmoothing), tt.triangles)
+			}
+			if len(m.Materials) != tt.materials {
+				t.Errorf("got %d materials, want %d", len(m.Materials), tt.materials)
+			}
+			for i, idx := range m.Indices {
+				if int(idx) >= len(m.Vertices) {
+					t.Fatalf("index %d is %d of %d vertices", i, idx, len(m.Vertices))
+				}
+			}
+			for i, mat := range m.FaceMaterials {
+				if mat < -1 || int(mat) >= len(m.Materials) {
+					t.Fatalf("triangle %d has material %d of %d", i, mat, len(m.Materials))
+				}
+			}
+
+			// the groups cover the triangles in order
+			groups, next := 0, 0
+			for _, obj := range m.Objects {
+				for _, g := range obj.Groups {
+					if g.Start != next || g.Count <= 0 {
+						t.Errorf("group %v of %q covers %d+%d, want it to start at %d", g.Names, obj.Name, g.Start, g.Count, next)
+					}
+					for f := g.Start; f < g.Start+g.Count && f < len(m.FaceSmoothing); f++ {
+						if m.FaceSmoothing[f] != g.Smoothing {
+							t.Fatalf("triangle %d has smoothing group %d, its group %d", f, m.FaceSmoothing[f], g.Smoothing)
+						}
+					}
+					next = g.Start + g.Count
+					groups++
+				}
+			}
+			if len(m.Objects) != tt.objects || groups != tt.groups || next != tt.triangles {
+				t.Errorf("got %d objects, %d groups up to triangle %d, want %d, %d, %d", len(m.Objects), groups, next, tt.objects, tt.groups, tt.triangles)
+			}
+
+			uvs := false
+			for i, v := range m.Vertices {
+				if got := v.Flags&HasNormals != 0; got != tt.normals {
+					t.Fatalf("vertex %d has normals %v, want %v", i, got, tt.normals)
+				}
+				uvs = uvs || v.Flags&HasUVs != 0
+				if l := v.Normal.Len(); l < 0.999 || l > 1.001 {
+					t.Fatalf("vertex %d has normal %v", i, v.Normal)
+				}
+			}
+			if uvs != tt.texcoords {
+				t.Errorf("got uvs %v, want %v", uvs, tt.texcoords)
+			}
+		})
+	}
+}
+
+func TestParallelLoader(t *testing.T) {
+	for _, tt := range bundled {
+		data, err := ioutil.ReadFile("../3dmodels/" + tt.file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		name := "../3dmodels/" + tt.file
+		var l Loader
+		want, err := l.Parse(strings.NewReader(string(data)), name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, workers := range []int{2, 4, 8} {
+			l := Loader{Workers: workers}
+			got, err := l.Parse(strings.NewReader(string(data)), name)
+			if err != nil {
+				t.Fatalf("%s, %d workers: %v", tt.file, workers, err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("%s, %d workers: mesh differs from the sequential one", tt.file, workers)
+			}
+		}
+	}
+}
+
+// TestParallelChunks parses a file that is cut into several chunks, with
+// relative indices, material and group changes across the cuts
+func TestParallelChunks(t *testing.T) {
+	var b strings.Builder
+	b.WriteString("mtllib m.mtl\n")
+	for i := 0; b.Len() < 4*minChunkSize; i++ {
+		b.WriteString("v 0 0 0\nv 1 0 0\nv 0 1 0\nvn 0 0 1\nvt 0 0\n")
+		switch i % 7 {
+		case 0:
+			b.WriteString("usemtl a\ng left\n")
+		case 3:
+			b.WriteString("usemtl b\ng right\ns 1\n")
+		case 5:
+			b.WriteString("o part\ns off\n")
+		}
+		b.WriteString("f -3/-1/-1 -2/-1/-1 -1/-1/-1\nf 1 -1 -2\n")
+	}
+	fs := memFS{"m.mtl": "newmtl a\nnewmtl b\n", "chunks.obj": b.String()}
+
+	want, err := (&Loader{Resolver: fs}).Load("chunks.obj")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, workers := range []int{2, 4, 8} {
+		got, err := (&Loader{Resolver: fs, Workers: workers}).Load("chunks.obj")
+		if err != nil {
+			t.Fatalf("%d workers: %v", workers, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%d workers: mesh differs from the sequential one", workers)
+		}
+	}
+}
+
+func TestSmoothingGroups(t *testing.T) {
+	obj := triangleVertices + "f 1 2 3\ns 1\nf 1 2 3\ng part\nf 1 2 3\ns off\nf 1 2 3\ns 0\nf 1 2 3\ns 2\nf 1 2 3\n"
+	m, err := parseString(t, Loader{}, obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []uint32{0, 1, 1, 0, 0, 2}; !reflect.DeepEqual(m.FaceSmoothing, want) {
+		t.Errorf("got smoothing groups %v, want %v", m.FaceSmoothing, want)
+	}
+	var got []uint32
+	for _, g := range m.Objects[0].Groups {
+		got = append(got, g.Smoothing)
+	}
+	if want := []uint32{0, 1, 1, 0, 2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got groups with smoothing %v, want %v", got, want)
+	}
+}
+
+func TestLinesAndPoints(t *testing.T) {
+	obj := triangleVertices + "l 1 2 3 1\np 1 2\nf 1 2 3\nl 2 3\n"
+	for _, workers := range []int{0, 4} {
+		m, err := parseString(t, Loader{Workers: workers}, obj)
+		if err != nil {
+			t.Fatalf("%d workers: %v", workers, err)
+		}
+		if m.TriangleCount() != 1 || len(m.Warnings) != 0 {
+			t.Errorf("%d workers: got %d triangles and warnings %v, want the face only", workers, m.TriangleCount(), m.Warnings)
+		}
+	}
+}
+
+func TestSmoothingNormals(t *testing.T) {
+	// two triangles at a right angle that share the edge 1 3
+	const corner = "v 0 0 0\nv 1 0 0\nv 0 1 0\nv 0 0 1\n"
+	z, x := mgl32.Vec3{0, 0, 1}, mgl32.Vec3{1, 0, 0}
+	smooth := mgl32.Vec3{1, 0, 1}.Normalize()
+	tests := []struct {
+		name     string
+		obj      string
+		vertices int
+		normals  []mgl32.Vec3
+	}{
+		{"no s", corner + "f 1 2 3\nf 1 3 4\n", 6, []mgl32.Vec3{z, z, z, x, x, x}},
+		{"s off", corner + "s off\nf 1 2 3\nf 1 3 4\n", 6, []mgl32.Vec3{z, z, z, x, x, x}},
+		{"s 0", corner + "s 0\nf 1 2 3\nf 1 3 4\n", 6, []mgl32.Vec3{z, z, z, x, x, x}},
+		{"one group", corner + "s 1\nf 1 2 3\nf 1 3 4\n", 4, []mgl32.Vec3{smooth, z, smooth, smooth, smooth, x}},
+		{"group per face", corner + "s 1\nf 1 2 3\ns 2\nf 1 3 4\n", 6, []mgl32.Vec3{z, z, z, x, x, x}},
+		{"smooth then flat", corner + "s 1\nf 1 2 3\ns off\nf 1 3 4\n", 6, []mgl32.Vec3{z, z, z, x, x, x}},
+		{"vn wins", corner + "vn 0 1 0\ns off\nf 1//1 2//1 3//1\nf 1//1 3//1 4//1\n", 4, []mgl32.Vec3{{0, 1, 0}, {0, 1, 0}, {0, 1, 0}, {0, 1, 0}, {0, 1, 0}, {0, 1, 0}}},
+	}
+
+	for _, tt := range tests {
+		m, err := parseString(t, Loader{}, tt.obj)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(m.Vertices) != tt.vertices {
+			t.Errorf("%s: got %d vertices, want %d", tt.name, len(m.Vertices), tt.vertices)
+		}
+		for i, idx := range m.Indices {
+			if n := m.Vertices[idx].Normal; !n.ApproxEqual(tt.normals[i]) {
+				t.Errorf("%s: corner %d has normal %v, want %v", tt.name, i, n, tt.normals[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package objparser
+
+import (
+	"bytes"
+	"sync"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// chunks smaller than this are not worth a goroutine
+const minChunkSize = 256 << 10
+
+// chunk is a run of whole lines that is tokenized on its own. Everything but
+// v, vt and vn is recorded as an event and replayed in file order by the
+// merge step, face indices are kept as written until then.
+type chunk struct {
+	data      []byte
+	positions []mgl32.Vec3
+	texcoords []mgl32.Vec2
+	normals   []mgl32.Vec3
+	corners   []FaceVertex
+	events    []event
+	lines     int
+	err       error
+}
+
+type eventKind uint8
+
+const (
+	faceEvent eventKind = iota
+	mtllibEvent
+	usemtlEvent
+	objectEvent
+	groupEvent
+	smoothingEvent
+	unknownEvent
+)
+
+type event struct {
+	kind eventKind
+	// line is relative to the chunk
+	lineState
+	// number of v, vt and vn statements of the chunk before this one
+	nv, nvt, nvn int
+	// corners[start:end] of faces
+	start, end int
+	text       string
+	names      []string
+	group      uint32
+}
+
+func (c *chunk) parse() {
+	p := &Parser{raw: true}
+	add := func(kind eventKind) *event {
+		c.events = append(c.events, event{
+			kind: kind, lineState: p.lineState, nv: len(c.positions), nvt: len(c.texcoords), nvn: len(c.normals),
+		})
+		return &c.events[len(c.events)-1]
+	}
+
+	p.OnVertex = func(v mgl32.Vec3) error {
+		c.positions = append(c.positions, v)
+		return nil
+	}
+	p.OnTexCoord = func(uv mgl32.Vec2) error {
+		c.texcoords = append(c.texcoords, uv)
+		return nil
+	}
+	p.OnNormal = func(n mgl32.Vec3) error {
+		c.normals = append(c.normals, normalize(n))
+		return nil
+	}
+	p.OnFace = func(corners []FaceVertex) error {
+		ev := add(faceEvent)
+		ev.start = len(c.corners)
+		c.corners = append(c.corners, corners...)
+		ev.end = len(c.corners)
+		return nil
+	}
+	p.OnMtllib = func(names string) error {
+		add(mtllibEvent).text = names
+		return nil
+	}
+	p.OnUsemtl = func(name string) error {
+		add(usemtlEvent).text = name
+		return nil
+	}
+	p.OnObject = func(name string) error {
+		add(objectEvent).text = name
+		return nil
+	}
+	p.OnGroup = func(names []string) error {
+		add(groupEvent).names = names
+		return nil
+	}
+	p.OnSmoothing = func(group uint32) error {
+		add(smoothingEvent).group = group
+		return nil
+	}
+	p.OnUnknown = func(directive string) error {
+		add(unknownEvent).text = directive
+		return nil
+	}
+
+	c.err = p.parseData(c.data)
+	c.lines = p.line
+}
+
+// splitChunks cuts data into about n pieces at line breaks
+func splitChunks(data []byte, n int) []*chunk {
+	size := len(data)/n + 1
+	if size < minChunkSize {
+		size = minChunkSize
+	}
+
+	chunks := []*chunk{}
+	for len(data) > 0 {
+		end := len(data)
+		if size < end {
+			end = size
+			if nl := bytes.IndexByte(data[end:], '\n'); nl >= 0 {
+				end += nl + 1
+			} else {
+				end = len(data)
+			}
+		}
+		chunks = append(chunks, &chunk{data: data[:end]})
+		data = data[end:]
+	}
+	return chunks
+}
+
+// parseParallel tokenizes chunks of data concurrently and then feeds them
+// to a meshBuilder in file order, which resolves the relative indices and
+// materials exactly like the sequential parser would
+func (l *Loader) parseParallel(data []byte, name string) (*Mesh, error) {
+	// more chunks than workers evens out chunks that are slower to parse
+	chunks := splitChunks(data, 4*l.Workers)
+
+	work := make(chan *chunk)
+	var wg sync.WaitGroup
+	for i := 0; i < l.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for c := range work {
+				c.parse()
+			}
+		}()
+	}
+	for _, c := range chunks {
+		work <- c
+	}
+	close(work)
+	wg.Wait()
+
+	b := newMeshBuilder(l, name)
+	p := b.parser
+	line := 0
+	for _, c := range chunks {
+		nv, nvt, nvn := len(b.positions), len(b.texcoords), len(b.normals)
+		b.positions = append(b.positions, c.positions...)
+		b.texcoords = append(b.texcoords, c.texcoords...)
+		b.normals = append(b.normals, c.normals...)
+
+		for i := range c.events {
+			ev := &c.events[i]
+			p.lineState = ev.lineState
+			p.line += line
+
+			var err error
+			switch ev.kind {
+			case faceEvent:
+				corners := c.corners[ev.start:ev.end]
+				for j := range corners {
+					if !resolveCorner(&corners[j], nv+ev.nv, nvt+ev.nvt, nvn+ev.nvn) {
+						// parse the line again for the error the sequential parser would give
+						q := &Parser{file: name, lineState: p.lineState}
+						q.nv, q.nvt, q.nvn = nv+ev.nv, nvt+ev.nvt, nvn+ev.nvn
+						return nil, q.parseLine(ev.lineState.text)
+					}
+				}
+				err = b.face(corners)
+			case mtllibEvent:
+				err = b.mtllib(ev.text)
+			case usemtlEvent:
+				err = p.OnUsemtl(ev.text)
+			case objectEvent:
+				err = p.OnObject(ev.text)
+			case groupEvent:
+				err = p.OnGroup(ev.names)
+			case smoothingEvent:
+				err = p.OnSmoothing(ev.group)
+			case unknownEvent:
+				err = p.OnUnknown(ev.text)
+			}
+			if err = p.wrap(err); err != nil {
+				return nil, err
+			}
+		}
+
+		if c.err != nil {
+			if pe, ok := c.err.(*ParseError); ok {
+				pe.File = name
+				pe.Line += line
+			}
+			return nil, c.err
+		}
+		line += c.lines
+	}
+
+	return b.finish(), nil
+}
@@ -0,0 +1,47 @@
+package objparser
+
+import (
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	s "strings"
+)
+
+// Resolver opens the .obj file and the material libraries and textures it
+// refers to. Like with fs.FS, names are slash separated.
+type Resolver interface {
+	Open(name string) (io.ReadCloser, error)
+}
+
+// ResolverFunc adapts a function, e.g. the Open method of an fs.FS or a zip
+// archive, to a Resolver
+type ResolverFunc func(name string) (io.ReadCloser, error)
+
+func (f ResolverFunc) Open(name string) (io.ReadCloser, error) {
+	return f(name)
+}
+
+// DiskResolver opens files on disk, it is used when Loader.Resolver is nil
+var DiskResolver Resolver = osResolver{}
+
+type osResolver struct{}
+
+func (osResolver) Open(name string) (io.ReadCloser, error) {
+	file, err := os.Open(filepath.FromSlash(name))
+	if err != nil {
+		// no typed nil in the interface
+		return nil, err
+	}
+	return file, nil
+}
+
+// Resolve returns the name of a file that is referenced from the file from
+func Resolve(from, ref string) string {
+	// exporters on windows like to write backslashes
+	ref = s.ReplaceAll(ref, "\\", "/")
+	if path.IsAbs(ref) || filepath.IsAbs(filepath.FromSlash(ref)) {
+		return path.Clean(ref)
+	}
+	return path.Join(path.Dir(from), ref)
+}
@@ -0,0 +1,486 @@
+package objparser
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"math"
+	"strconv"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// FaceVertex is one corner of a face. Parser hands out 0-based indices into
+// the v, vt and vn statements read so far, VT and VN are -1 if absent.
+type FaceVertex struct {
+	V, VT, VN int
+}
+
+// Parser is a streaming .obj tokenizer. It reads the file line by line
+// without allocating per line and calls the matching callback for every
+// statement, nil callbacks are skipped. Slices passed to callbacks are only
+// valid until the callback returns. An error returned by a callback stops
+// Parse and is returned with the position of the statement attached.
+type Parser struct {
+	OnVertex   func(v mgl32.Vec3) error
+	OnTexCoord func(uv mgl32.Vec2) error
+	OnNormal   func(n mgl32.Vec3) error
+	OnFace     func(corners []FaceVertex) error
+	// names is the raw argument text, it may list several files
+	OnMtllib    func(names string) error
+	OnUsemtl    func(name string) error
+	OnObject    func(name string) error
+	OnGroup     func(names []string) error
+	OnSmoothing func(group uint32) error
+	// OnUnknown is called for every other statement, if it is nil those
+	// fail with ErrUnsupported
+	OnUnknown func(directive string) error
+
+	// raw hands the indices to OnFace as they are written in the file,
+	// 0 for absent ones, instead of resolving them
+	raw bool
+
+	file string
+	lineState
+	// number of v, vt and vn statements so far
+	nv, nvt, nvn int
+
+	long    []byte
+	corners []FaceVertex
+}
+
+// lineState is the position of the statement being parsed
+type lineState struct {
+	line int
+	// the current line without line break and comment
+	text []byte
+	// 1-based columns of the directive, its end and the first argument
+	dirCol, dirEnd, argCol int
+}
+
+// Parse reads the whole .obj file from in, name is only used in errors
+func (p *Parser) Parse(in io.Reader, name string) error {
+	p.file = name
+	br := bufio.NewReaderSize(in, 1<<16)
+	for {
+		line, err := br.ReadSlice('\n')
+		if err == bufio.ErrBufferFull {
+			// longer than the buffer, collect the pieces
+			p.long = append(p.long[:0], line...)
+			for err == bufio.ErrBufferFull {
+				line, err = br.ReadSlice('\n')
+				p.long = append(p.long, line...)
+			}
+			line = p.long
+		}
+		if len(line) > 0 {
+			p.line++
+			if perr := p.parseLine(line); perr != nil {
+				return perr
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// parseData is Parse for a file that is already in memory. Unlike with
+// Parse, the text of the lines stays valid after the callbacks return.
+func (p *Parser) parseData(data []byte) error {
+	for len(data) > 0 {
+		end := bytes.IndexByte(data, '\n') + 1
+		if end == 0 {
+			end = len(data)
+		}
+		p.line++
+		if err := p.parseLine(data[:end]); err != nil {
+			return err
+		}
+		data = data[end:]
+	}
+	return nil
+}
+
+// Line returns the 1-based line of the statement being handled
+func (p *Parser) Line() int {
+	return p.line
+}
+
+// errorAt builds an error for the bytes [start, end) of the current line
+func (p *Parser) errorAt(start, end int, err error) *ParseError {
+	return &ParseError{File: p.file, Line: p.line, Column: start + 1, Token: string(p.text[start:end]), Err: err}
+}
+
+// dirError points err at the directive of the current statement
+func (p *Parser) dirError(err error) *ParseError {
+	return p.errorAt(p.dirCol-1, p.dirEnd-1, err)
+}
+
+// argsError points err at all arguments of the current statement
+func (p *Parser) argsError(err error) *ParseError {
+	end := len(p.text)
+	for end > 0 && isBlank(p.text[end-1]) {
+		end--
+	}
+	return p.errorAt(p.argCol-1, end, err)
+}
+
+// wrap attaches the position of the current statement to callback errors
+func (p *Parser) wrap(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(*ParseError); ok {
+		return err
+	}
+	return p.dirError(err)
+}
+
+func isBlank(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\f' || c == '\v'
+}
+
+// field returns the bounds of the next blank separated field at or after pos
+func (p *Parser) field(pos int) (start, end int) {
+	for pos < len(p.text) && isBlank(p.text[pos]) {
+		pos++
+	}
+	start = pos
+	for pos < len(p.text) && !isBlank(p.text[pos]) {
+		pos++
+	}
+	return start, pos
+}
+
+func (p *Parser) parseLine(line []byte) error {
+	// cut line break and comment
+	for i, c := range line {
+		if c == '#' || c == '\n' {
+			line = line[:i]
+			break
+		}
+	}
+	p.text = line
+
+	start, end := p.field(0)
+	if start == end {
+		return nil
+	}
+	dir := line[start:end]
+	p.dirCol, p.dirEnd = start+1, end+1
+	p.argCol, _ = p.field(end)
+	p.argCol++
+
+	switch {
+	case len(dir) == 1 && dir[0] == 'v':
+		var v mgl32.Vec3
+		if err := p.floats(end, v[:]); err != nil {
+			return err
+		}
+		p.nv++
+		if p.OnVertex != nil {
+			return p.wrap(p.OnVertex(v))
+		}
+
+	case len(dir) == 2 && dir[0] == 'v' && dir[1] == 't':
+		var uv mgl32.Vec2
+		// v is optional
+		pos := end
+		for i := range uv {
+			s, e := p.field(pos)
+			if s == e && i > 0 {
+				break
+			}
+			if err := p.float(s, e, &uv[i]); err != nil {
+				return err
+			}
+			pos = e
+		}
+		p.nvt++
+		if p.OnTexCoord != nil {
+			return p.wrap(p.OnTexCoord(uv))
+		}
+
+	case len(dir) == 2 && dir[0] == 'v' && dir[1] == 'n':
+		var n mgl32.Vec3
+		if err := p.floats(end, n[:]); err != nil {
+			return err
+		}
+		p.nvn++
+		if p.OnNormal != nil {
+			return p.wrap(p.OnNormal(n))
+		}
+
+	case len(dir) == 1 && dir[0] == 'f':
+		return p.parseFace(end)
+
+	default:
+		return p.parseOther(string(dir), end)
+	}
+	return nil
+}
+
+// parseOther handles the statements that are rare enough to allocate
+func (p *Parser) parseOther(dir string, end int) error {
+	args := string(trimBlanks(p.text[end:]))
+
+	switch dir {
+	case "mtllib", "usemtl", "o":
+		if args == "" {
+			return p.dirError(ErrArguments)
+		}
+		switch {
+		case dir == "mtllib" && p.OnMtllib != nil:
+			return p.wrap(p.OnMtllib(args))
+		case dir == "usemtl" && p.OnUsemtl != nil:
+			return p.wrap(p.OnUsemtl(args))
+		case dir == "o" && p.OnObject != nil:
+			return p.wrap(p.OnObject(args))
+		}
+
+	case "g":
+		names := []string{}
+		for pos := end; ; {
+			s, e := p.field(pos)
+			if s == e {
+				break
+			}
+			names = append(names, string(p.text[s:e]))
+			pos = e
+		}
+		if len(names) == 0 {
+			names = append(names, "default")
+		}
+		if p.OnGroup != nil {
+			return p.wrap(p.OnGroup(names))
+		}
+
+	case "s":
+		s, e := p.field(end)
+		if s == e {
+			return p.dirError(ErrArguments)
+		}
+		var group uint32
+		if args != "off" {
+			n, err := strconv.ParseUint(string(p.text[s:e]), 10, 32)
+			if err != nil {
+				return p.errorAt(s, e, ErrNumber)
+			}
+			group = uint32(n)
+		}
+		if p.OnSmoothing != nil {
+			return p.wrap(p.OnSmoothing(group))
+		}
+
+	case "l", "p":
+		// lines and points have no area for rays to hit, they are skipped
+
+	default:
+		if p.OnUnknown == nil {
+			return p.dirError(ErrUnsupported)
+		}
+		return p.wrap(p.OnUnknown(dir))
+	}
+	return nil
+}
+
+func trimBlanks(b []byte) []byte {
+	for len(b) > 0 && isBlank(b[0]) {
+		b = b[1:]
+	}
+	for len(b) > 0 && isBlank(b[len(b)-1]) {
+		b = b[:len(b)-1]
+	}
+	return b
+}
+
+func (p *Parser) parseFace(end int) error {
+	p.corners = p.corners[:0]
+	pos := end
+	for {
+		s, e := p.field(pos)
+		if s == e {
+			break
+		}
+		fv, err := p.corner(s, e)
+		if err != nil {
+			return err
+		}
+		p.corners = append(p.corners, fv)
+		pos = e
+	}
+	if len(p.corners) < 3 {
+		return p.dirError(ErrArguments)
+	}
+	if p.OnFace != nil {
+		return p.wrap(p.OnFace(p.corners))
+	}
+	return nil
+}
+
+// corner parses one of the v, v/vt, v//vn or v/vt/vn forms in [s, e)
+func (p *Parser) corner(s, e int) (FaceVertex, error) {
+	var idx [3]int
+	part, i := 0, s
+	for {
+		j := i
+		for j < e && p.text[j] != '/' {
+			j++
+		}
+		if j > i {
+			n, ok := parseInt(p.text[i:j])
+			if !ok {
+				return FaceVertex{}, p.errorAt(s, e, ErrNumber)
+			}
+			idx[part] = n
+		} else if part != 1 {
+			// only vt may be left out
+			return FaceVertex{}, p.errorAt(s, e, ErrNumber)
+		}
+		if j == e {
+			break
+		}
+		part++
+		if part > 2 {
+			return FaceVertex{}, p.errorAt(s, e, ErrNumber)
+		}
+		i = j + 1
+	}
+
+	fv := FaceVertex{idx[0], idx[1], idx[2]}
+	if p.raw {
+		return fv, nil
+	}
+	if !resolveCorner(&fv, p.nv, p.nvt, p.nvn) {
+		return fv, p.errorAt(s, e, ErrIndex)
+	}
+	return fv, nil
+}
+
+// resolveCorner turns the 1-based or negative (relative to the end) indices
+// of fv into 0-based ones, -1 for absent ones. nv, nvt and nvn are the
+// numbers of elements read so far.
+func resolveCorner(fv *FaceVertex, nv, nvt, nvn int) bool {
+	var ok bool
+	if fv.V, ok = resolveIndex(fv.V, nv); !ok || fv.V < 0 {
+		return false
+	}
+	if fv.VT, ok = resolveIndex(fv.VT, nvt); !ok {
+		return false
+	}
+	fv.VN, ok = resolveIndex(fv.VN, nvn)
+	return ok
+}
+
+func resolveIndex(i, count int) (int, bool) {
+	switch {
+	case i == 0:
+		return -1, true
+	case i > 0:
+		i--
+	default:
+		i += count
+	}
+	return i, i >= 0 && i < count
+}
+
+func parseInt(b []byte) (int, bool) {
+	neg := false
+	if len(b) > 0 && (b[0] == '-' || b[0] == '+') {
+		neg = b[0] == '-'
+		b = b[1:]
+	}
+	if len(b) == 0 || len(b) > 18 {
+		return 0, false
+	}
+	n := 0
+	for _, c := range b {
+		if c < '0' || c > '9' {
+			return 0, false
+		}
+		n = n*10 + int(c-'0')
+	}
+	if neg {
+		n = -n
+	}
+	return n, true
+}
+
+// floats parses the first len(dst) fields after pos
+func (p *Parser) floats(pos int, dst []float32) error {
+	for i := range dst {
+		s, e := p.field(pos)
+		if s == e {
+			return p.dirError(ErrArguments)
+		}
+		if err := p.float(s, e, &dst[i]); err != nil {
+			return err
+		}
+		pos = e
+	}
+	return nil
+}
+
+func (p *Parser) float(s, e int, dst *float32) error {
+	if s == e {
+		return p.dirError(ErrArguments)
+	}
+	f, ok := parseFloat(p.text[s:e])
+	if !ok {
+		return p.errorAt(s, e, ErrNumber)
+	}
+	*dst = f
+	return nil
+}
+
+var pow10 = [...]float64{1e0, 1e1, 1e2, 1e3, 1e4, 1e5, 1e6, 1e7, 1e8, 1e9, 1e10,
+	1e11, 1e12, 1e13, 1e14, 1e15, 1e16, 1e17, 1e18, 1e19, 1e20, 1e21, 1e22}
+
+// parseFloat has a fast path for the plain decimals .obj files are made of,
+// everything else goes through strconv
+func parseFloat(b []byte) (float32, bool) {
+	i, neg := 0, false
+	if i < len(b) && (b[i] == '-' || b[i] == '+') {
+		neg = b[i] == '-'
+		i++
+	}
+
+	var mant uint64
+	exp, digits, sawDigit := 0, 0, false
+	for ; i < len(b) && b[i] >= '0' && b[i] <= '9'; i++ {
+		sawDigit = true
+		mant = mant*10 + uint64(b[i]-'0')
+		if mant != 0 {
+			digits++
+		}
+	}
+	if i < len(b) && b[i] == '.' {
+		for i++; i < len(b) && b[i] >= '0' && b[i] <= '9'; i++ {
+			sawDigit = true
+			mant = mant*10 + uint64(b[i]-'0')
+			if mant != 0 {
+				digits++
+			}
+			exp--
+		}
+	}
+
+	// exact as long as mant and the power of ten fit into a float64 mantissa
+	if !sawDigit || i != len(b) || digits > 15 || exp < -22 {
+		f, err := strconv.ParseFloat(string(b), 32)
+		if err != nil || math.IsNaN(f) {
+			return 0, false
+		}
+		return float32(f), true
+	}
+
+	f := float64(mant) / pow10[-exp]
+	if neg {
+		f = -f
+	}
+	return float32(f), true
+}
@@ -0,0 +1,123 @@
+package objparser
+
+import (
+	"image"
+	"image/draw"
+	_ "image/jpeg"
+	_ "image/png"
+	"sort"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// TextureAtlas packs all texture maps of a mesh into one RGBA image that can
+// be uploaded with a single glTexImage2D
+type TextureAtlas struct {
+	Image *image.RGBA
+	// Regions maps TextureMap.Path to the pixels of that texture in Image
+	Regions map[string]image.Rectangle
+}
+
+// Transform returns the offset and scale that map texture coordinates of
+// the texture at path into atlas coordinates
+func (a *TextureAtlas) Transform(path string) (offset, scale mgl32.Vec2, ok bool) {
+	rect, ok := a.Regions[path]
+	if !ok {
+		return offset, scale, false
+	}
+	size := a.Image.Bounds().Size()
+	offset = mgl32.Vec2{float32(rect.Min.X) / float32(size.X), float32(rect.Min.Y) / float32(size.Y)}
+	scale = mgl32.Vec2{float32(rect.Dx()) / float32(size.X), float32(rect.Dy()) / float32(size.Y)}
+	return offset, scale, true
+}
+
+// LoadTextures decodes the texture maps of all materials into m.Atlas,
+// textures that cannot be read are added to m.Warnings
+func (m *Mesh) LoadTextures(res Resolver) {
+	m.Atlas = loadAtlas(res, m.Materials, &m.Warnings)
+}
+
+// loadAtlas decodes every texture the materials reference, files that cannot
+// be read or decoded are reported as warnings and left out of the atlas
+func loadAtlas(res Resolver, materials []Material, warnings *[]*ParseError) *TextureAtlas {
+	images := map[string]image.Image{}
+	paths := []string{}
+	for i := range materials {
+		for _, tm := range materials[i].Maps() {
+			if _, seen := images[tm.Path]; seen {
+				continue
+			}
+			img, err := tm.Image, error(nil)
+			if img == nil {
+				img, err = decodeImage(res, tm.Path)
+			}
+			if err != nil {
+				// maps of other formats do not come from a .mtl line
+				file := tm.file
+				if file == "" {
+					file = tm.Path
+				}
+				*warnings = append(*warnings, &ParseError{
+					File: file, Line: tm.line, Column: tm.token.col, Token: tm.token.text, Err: err,
+				})
+			}
+			// failed images are remembered as nil so that they are only reported once
+			images[tm.Path] = img
+			if img != nil {
+				paths = append(paths, tm.Path)
+			}
+		}
+	}
+	if len(paths) == 0 {
+		return nil
+	}
+
+	// shelf packing, tallest images first
+	sort.SliceStable(paths, func(i, j int) bool {
+		return images[paths[i]].Bounds().Dy() > images[paths[j]].Bounds().Dy()
+	})
+	area, widest := 0, 0
+	for _, p := range paths {
+		size := images[p].Bounds().Size()
+		area += size.X * size.Y
+		if size.X > widest {
+			widest = size.X
+		}
+	}
+	width := 1
+	for width*width < area || width < widest {
+		width *= 2
+	}
+
+	regions := map[string]image.Rectangle{}
+	x, y, shelf := 0, 0, 0
+	for _, p := range paths {
+		size := images[p].Bounds().Size()
+		if x+size.X > width {
+			x, y, shelf = 0, y+shelf, 0
+		}
+		regions[p] = image.Rect(x, y, x+size.X, y+size.Y)
+		x += size.X
+		if size.Y > shelf {
+			shelf = size.Y
+		}
+	}
+
+	atlas := &TextureAtlas{Image: image.NewRGBA(image.Rect(0, 0, width, y+shelf)), Regions: regions}
+	for _, p := range paths {
+		img := images[p]
+		draw.Draw(atlas.Image, regions[p], img, img.Bounds().Min, draw.Src)
+	}
+	return atlas
+}
+
+func decodeImage(res Resolver, name string) (image.Image, error) {
+	file, err := res.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	img, _, err := image.Decode(file)
+	return img, err
+}
@@ -0,0 +1,320 @@
+package objparser
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	s "strings"
+	"unicode/utf8"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// Save writes m to the .obj file at name and its materials to a .mtl file
+// with the same base name next to it. Texture paths are rewritten relative
+// to the new .mtl file.
+func Save(name string, m *Mesh) error {
+	mtllib := ""
+	if len(m.Materials) > 0 {
+		mtlName := s.TrimSuffix(name, filepath.Ext(name)) + ".mtl"
+		if err := saveFile(mtlName, func(w io.Writer) error {
+			return WriteMtl(w, m.Materials, filepath.ToSlash(filepath.Dir(mtlName)))
+		}); err != nil {
+			return err
+		}
+		mtllib = filepath.Base(mtlName)
+	}
+
+	return saveFile(name, func(w io.Writer) error {
+		return Write(w, m, mtllib)
+	})
+}
+
+func saveFile(name string, write func(io.Writer) error) error {
+	file, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if err := write(file); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// Write writes m as an .obj file. Positions, uvs and normals are written
+// per vertex, normals only if they came from the source file, so that
+// loading the output again gives the same mesh; the loader synthesizes the
+// other normals again the same way for meshes that were loaded from .obj
+// files. mtllib is the name of the material library to reference, none is
+// written if it is empty.
+//
+// A triangle without material after one with a material can not be
+// expressed in .obj, it keeps the previous material. Objects after the
+// first need a name to start, unnamed ones are called object1, object2 and
+// so on after their index. Blanks in group and material names, and # and
+// line breaks in all names, are written as _.
+func Write(w io.Writer, m *Mesh, mtllib string) error {
+	out := &objWriter{w: bufio.NewWriter(w), mesh: m}
+	if mtllib != "" {
+		out.printf("mtllib %s\n", mtllib)
+	}
+	out.vertices()
+
+	if len(m.Objects) == 0 {
+		out.faces(0, m.TriangleCount())
+	}
+	for i, obj := range m.Objects {
+		if name := argument(obj.Name); name != "" {
+			out.printf("o %s\n", name)
+		} else if i > 0 {
+			out.printf("o object%d\n", i)
+		}
+		for _, g := range obj.Groups {
+			out.group(g)
+			out.faces(g.Start, g.Start+g.Count)
+		}
+	}
+
+	if out.err != nil {
+		return out.err
+	}
+	return out.w.Flush()
+}
+
+// objWriter keeps track of the state the parser will be in when it reads
+// the output, so that only changes need to be written
+type objWriter struct {
+	w    *bufio.Writer
+	err  error
+	mesh *Mesh
+	// per vertex the 1-based v/vt/vn indices, 0 if it has none
+	corners   [][3]int
+	material  int32
+	groups    []string
+	smoothing uint32
+}
+
+func (o *objWriter) printf(format string, args ...interface{}) {
+	if o.err == nil {
+		_, o.err = fmt.Fprintf(o.w, format, args...)
+	}
+}
+
+func (o *objWriter) vertices() {
+	verts := o.mesh.Vertices
+	o.corners = make([][3]int, len(verts))
+	for i, v := range verts {
+		o.printf("v %s %s %s\n", formatFloat(v.Position[0]), formatFloat(v.Position[1]), formatFloat(v.Position[2]))
+		o.corners[i][0] = i + 1
+	}
+	n := 0
+	for i, v := range verts {
+		if v.Flags&HasUVs != 0 {
+			o.printf("vt %s %s\n", formatFloat(v.UV[0]), formatFloat(v.UV[1]))
+			n++
+			o.corners[i][1] = n
+		}
+	}
+	n = 0
+	for i, v := range verts {
+		if v.Flags&HasNormals != 0 {
+			o.printf("vn %s %s %s\n", formatFloat(v.Normal[0]), formatFloat(v.Normal[1]), formatFloat(v.Normal[2]))
+			n++
+			o.corners[i][2] = n
+		}
+	}
+
+	o.material = -1
+	o.groups = []string{"default"}
+}
+
+func (o *objWriter) group(g Group) {
+	names := g.Names
+	if len(names) == 0 {
+		names = []string{"default"}
+	}
+	if !equalNames(names, o.groups) {
+		o.printf("g")
+		for _, name := range names {
+			o.printf(" %s", word(name))
+		}
+		o.printf("\n")
+		o.groups = names
+	}
+	if g.Smoothing != o.smoothing {
+		if g.Smoothing == 0 {
+			o.printf("s off\n")
+		} else {
+			o.printf("s %d\n", g.Smoothing)
+		}
+		o.smoothing = g.Smoothing
+	}
+}
+
+// faces writes the triangles [start, end)
+func (o *objWriter) faces(start, end int) {
+	m := o.mesh
+	for t := start; t < end; t++ {
+		if mat := m.FaceMaterials[t]; mat >= 0 && mat != o.material {
+			o.printf("usemtl %s\n", materialName(m.Materials[mat].Name))
+			o.material = mat
+		}
+
+		o.printf("f")
+		for _, idx := range m.Indices[3*t : 3*t+3] {
+			c := o.corners[idx]
+			switch {
+			case c[1] > 0 && c[2] > 0:
+				o.printf(" %d/%d/%d", c[0], c[1], c[2])
+			case c[2] > 0:
+				o.printf(" %d//%d", c[0], c[2])
+			case c[1] > 0:
+				o.printf(" %d/%d", c[0], c[1])
+			default:
+				o.printf(" %d", c[0])
+			}
+		}
+		o.printf("\n")
+	}
+}
+
+// WriteMtl writes materials as an .mtl file. Texture paths are written
+// relative to dir, the slash separated directory the file is saved in.
+// Images embedded in the model file are referenced by name only, they are
+// not written out.
+func WriteMtl(w io.Writer, materials []Material, dir string) error {
+	out := &objWriter{w: bufio.NewWriter(w)}
+	for i, m := range materials {
+		if i > 0 {
+			out.printf("\n")
+		}
+		out.printf("newmtl %s\n", materialName(m.Name))
+		out.printf("Ka %s\n", formatVec(m.Ambient))
+		out.printf("Kd %s\n", formatVec(m.Diffuse))
+		out.printf("Ks %s\n", formatVec(m.Specular))
+		out.printf("Ke %s\n", formatVec(m.Emissive))
+		out.printf("Tf %s\n", formatVec(m.TransmissionFilter))
+		out.printf("Ns %s\n", formatFloat(m.SpecularExponent))
+		out.printf("Ni %s\n", formatFloat(m.OpticalDensity))
+		out.printf("d %s\n", formatFloat(m.Dissolve))
+		out.printf("illum %d\n", m.Illum)
+		if m.Roughness >= 0 {
+			out.printf("Pr %s\n", formatFloat(m.Roughness))
+		}
+		if m.Metallic >= 0 {
+			out.printf("Pm %s\n", formatFloat(m.Metallic))
+		}
+
+		for _, tm := range []struct {
+			dir string
+			tm  *TextureMap
+		}{
+			{"map_Ka", m.AmbientMap},
+			{"map_Kd", m.DiffuseMap},
+			{"map_Ks", m.SpecularMap},
+			{"map_Ke", m.EmissiveMap},
+			{"map_Ns", m.SpecularExponentMap},
+			{"map_d", m.DissolveMap},
+			{"map_Bump", m.BumpMap},
+			{"disp", m.DisplacementMap},
+			{"map_Pr", m.RoughnessMap},
+			{"map_Pm", m.MetallicMap},
+		} {
+			if tm.tm != nil {
+				out.textureMap(tm.dir, tm.tm, dir)
+			}
+		}
+	}
+
+	if out.err != nil {
+		return out.err
+	}
+	return out.w.Flush()
+}
+
+// textureMap writes the options that differ from the defaults and the path
+func (o *objWriter) textureMap(dir string, tm *TextureMap, mtlDir string) {
+	o.printf("%s", dir)
+	if tm.Scale != (mgl32.Vec3{1, 1, 1}) {
+		o.printf(" -s %s", formatVec(tm.Scale))
+	}
+	if tm.Offset != (mgl32.Vec3{}) {
+		o.printf(" -o %s", formatVec(tm.Offset))
+	}
+	if tm.BumpMultiplier != 1 {
+		o.printf(" -bm %s", formatFloat(tm.BumpMultiplier))
+	}
+	if tm.Clamp {
+		o.printf(" -clamp on")
+	}
+	o.printf(" %s\n", relativePath(mtlDir, tm.Path))
+}
+
+// relativePath returns name relative to dir, relative paths are taken to
+// be relative to the working directory
+func relativePath(dir, name string) string {
+	from, to := filepath.FromSlash(dir), filepath.FromSlash(name)
+	if filepath.IsAbs(from) != filepath.IsAbs(to) {
+		var err error
+		if from, err = filepath.Abs(from); err != nil {
+			return name
+		}
+		if to, err = filepath.Abs(to); err != nil {
+			return name
+		}
+	}
+	rel, err := filepath.Rel(from, to)
+	if err != nil {
+		return name
+	}
+	return filepath.ToSlash(rel)
+}
+
+// argument makes name safe to write as the argument of o, # would start a
+// comment and line breaks would end the statement. Blanks around it are
+// dropped like the parser does.
+func argument(name string) string {
+	return s.TrimFunc(s.Map(func(r rune) rune {
+		if r == '#' || r == '\n' || r == '\r' {
+			return '_'
+		}
+		return r
+	}, name), func(r rune) bool {
+		return r < utf8.RuneSelf && isBlank(byte(r))
+	})
+}
+
+// materialName is argument for newmtl and usemtl, which need a name
+func materialName(name string) string {
+	if name = argument(name); name == "" {
+		return "_"
+	}
+	return name
+}
+
+// word is argument for g, which splits its arguments at blanks
+func word(name string) string {
+	name = s.Map(func(r rune) rune {
+		if r == '#' || r == '\n' || r == '\r' || r < utf8.RuneSelf && isBlank(byte(r)) {
+			return '_'
+		}
+		return r
+	}, name)
+	if name == "" {
+		return "_"
+	}
+	return name
+}
+
+// formatFloat returns the shortest text that parses back to f
+func formatFloat(f float32) string {
+	return strconv.FormatFloat(float64(f), 'g', -1, 32)
+}
+
+func formatVec(v mgl32.Vec3) string {
+	return formatFloat(v[0]) + " " + formatFloat(v[1]) + " " + formatFloat(v[2])
+}
@@ -0,0 +1,217 @@
+package objparser_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/supermuesli/computeshader/pkg/gltf"
+	"github.com/supermuesli/computeshader/pkg/objparser"
+)
+
+// roundTrip writes m next to name and loads it back. Files other than the
+// written ones are read from disk.
+func roundTrip(t *testing.T, m *objparser.Mesh, name string) *objparser.Mesh {
+	t.Helper()
+	files := map[string][]byte{}
+	mtllib := ""
+	if len(m.Materials) > 0 {
+		mtlName := strings.TrimSuffix(name, path.Ext(name)) + ".roundtrip.mtl"
+		var mtl bytes.Buffer
+		if err := objparser.WriteMtl(&mtl, m.Materials, path.Dir(name)); err != nil {
+			t.Fatal(err)
+		}
+		files[mtlName] = mtl.Bytes()
+		mtllib = path.Base(mtlName)
+	}
+	var obj bytes.Buffer
+	if err := objparser.Write(&obj, m, mtllib); err != nil {
+		t.Fatal(err)
+	}
+	files[name] = obj.Bytes()
+
+	l := objparser.Loader{Resolver: objparser.ResolverFunc(func(name string) (io.ReadCloser, error) {
+		if data, ok := files[name]; ok {
+			return ioutil.NopCloser(bytes.NewReader(data)), nil
+		}
+		return objparser.DiskResolver.Open(name)
+	})}
+	out, err := l.Load(name)
+	if err != nil {
+		t.Fatalf("loading the written file: %v\n%s", err, obj.Bytes())
+	}
+	return out
+}
+
+func TestWriteBundled(t *testing.T) {
+	for _, file := range []string{"CornellBox-Original.obj", "plant.obj", "testObj.obj"} {
+		t.Run(file, func(t *testing.T) {
+			name := "../3dmodels/" + file
+			m, err := objparser.Load(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := roundTrip(t, m, name)
+			exportedOnly(got)
+			exportedOnly(m)
+			if !reflect.DeepEqual(got, m) {
+				diffMeshes(t, got, m)
+			}
+		})
+	}
+}
+
+// exportedOnly drops what texture maps remember about where they were
+// declared, which differs between the source and the written file
+func exportedOnly(m *objparser.Mesh) {
+	for i := range m.Materials {
+		for _, tm := range []**objparser.TextureMap{
+			&m.Materials[i].AmbientMap, &m.Materials[i].DiffuseMap, &m.Materials[i].SpecularMap,
+			&m.Materials[i].EmissiveMap, &m.Materials[i].SpecularExponentMap, &m.Materials[i].DissolveMap,
+			&m.Materials[i].BumpMap, &m.Materials[i].DisplacementMap, &m.Materials[i].RoughnessMap,
+			&m.Materials[i].MetallicMap,
+		} {
+			if *tm != nil {
+				*tm = &objparser.TextureMap{
+					Path: (*tm).Path, Scale: (*tm).Scale, Offset: (*tm).Offset,
+					BumpMultiplier: (*tm).BumpMultiplier, Clamp: (*tm).Clamp, Image: (*tm).Image,
+				}
+			}
+		}
+	}
+}
+
+// diffMeshes reports the first difference of got and want
+func diffMeshes(t *testing.T, got, want *objparser.Mesh) {
+	t.Helper()
+	g, w := reflect.ValueOf(got).Elem(), reflect.ValueOf(want).Elem()
+	for i := 0; i < g.NumField(); i++ {
+		gf, wf := g.Field(i), w.Field(i)
+		if reflect.DeepEqual(gf.Interface(), wf.Interface()) {
+			continue
+		}
+		name := g.Type().Field(i).Name
+		if gf.Kind() == reflect.Slice && gf.Len() == wf.Len() {
+			for j := 0; j < gf.Len(); j++ {
+				if !reflect.DeepEqual(gf.Index(j).Interface(), wf.Index(j).Interface()) {
+					t.Errorf("%s[%d]: got %+v, want %+v", name, j, gf.Index(j).Interface(), wf.Index(j).Interface())
+					break
+				}
+			}
+			continue
+		}
+		t.Errorf("%s: got %+v, want %+v", name, gf.Interface(), wf.Interface())
+	}
+}
+
+// gltfQuad is a glTF file with a quad with normals and uvs, placed twice:
+// by a named node and by an unnamed child of it. The names of the mesh
+// and the material contain blanks.
+func gltfQuad() []byte {
+	var buf bytes.Buffer
+	for _, v := range [][]float32{
+		// positions
+		{0, 0, 0}, {1, 0, 0}, {1, 1, 0}, {0, 1, 0},
+		// normals
+		{0, 0, 1}, {0, 0, 1}, {0, 0, 1}, {0, 0, 1},
+		// uvs
+		{0, 0}, {1, 0}, {1, 1}, {0, 1},
+	} {
+		binary.Write(&buf, binary.LittleEndian, v)
+	}
+	binary.Write(&buf, binary.LittleEndian, []uint16{0, 1, 2, 0, 2, 3})
+
+	return []byte(fmt.Sprintf(`{
+		"asset": {"version": "2.0"},
+		"buffers": [{"byteLength": %d, "uri": "data:application/octet-stream;base64,%s"}],
+		"bufferViews": [
+			{"buffer": 0, "byteOffset": 0, "byteLength": 96},
+			{"buffer": 0, "byteOffset": 96, "byteLength": 32},
+			{"buffer": 0, "byteOffset": 128, "byteLength": 12}
+		],
+		"accessors": [
+			{"bufferView": 0, "componentType": 5126, "count": 4, "type": "VEC3"},
+			{"bufferView": 0, "byteOffset": 48, "componentType": 5126, "count": 4, "type": "VEC3"},
+			{"bufferView": 1, "componentType": 5126, "count": 4, "type": "VEC2"},
+			{"bufferView": 2, "componentType": 5123, "count": 6, "type": "SCALAR"}
+		],
+		"materials": [{"name": "Blue Paint", "pbrMetallicRoughness": {"baseColorFactor": [0, 0, 1, 1]}}],
+		"meshes": [{"name": "Quad Mesh", "primitives": [{
+			"attributes": {"POSITION": 0, "NORMAL": 1, "TEXCOORD_0": 2},
+			"indices": 3, "material": 0
+		}]}],
+		"nodes": [
+			{"name": "first quad", "mesh": 0, "children": [1]},
+			{"mesh": 0, "translation": [2, 0, 0]}
+		],
+		"scenes": [{"nodes": [0]}]
+	}`, buf.Len(), base64.StdEncoding.EncodeToString(buf.Bytes())))
+}
+
+func TestWriteGLTF(t *testing.T) {
+	const name = "quad.gltf"
+	var l gltf.Loader
+	m, err := l.Parse(bytes.NewReader(gltfQuad()), name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := roundTrip(t, m, "quad.obj")
+
+	if !reflect.DeepEqual(got.Vertices, m.Vertices) || !reflect.DeepEqual(got.Indices, m.Indices) ||
+		!reflect.DeepEqual(got.FaceMaterials, m.FaceMaterials) || !reflect.DeepEqual(got.FaceSmoothing, m.FaceSmoothing) {
+		diffMeshes(t, got, m)
+	}
+	if len(got.Materials) != 1 || got.Materials[0].Name != "Blue Paint" || got.Materials[0].Diffuse != m.Materials[0].Diffuse {
+		t.Errorf("got materials %+v, want Blue Paint with Kd %v", got.Materials, m.Materials[0].Diffuse)
+	}
+
+	// the unnamed child node is an object called after its node, the
+	// blanks of the mesh name would split the group
+	want := []objparser.Object{
+		{Name: "first quad", Groups: []objparser.Group{{Names: []string{"Quad_Mesh"}, Start: 0, Count: 2}}},
+		{Name: "nodes[1]", Groups: []objparser.Group{{Names: []string{"Quad_Mesh"}, Start: 2, Count: 2}}},
+	}
+	if !reflect.DeepEqual(got.Objects, want) {
+		t.Errorf("got objects %+v, want %+v", got.Objects, want)
+	}
+}
+
+func TestWriteNames(t *testing.T) {
+	m := &objparser.Mesh{
+		Vertices: []objparser.Vertex{
+			{Position: [3]float32{0, 0, 0}}, {Position: [3]float32{1, 0, 0}}, {Position: [3]float32{0, 1, 0}},
+		},
+		Indices:       []uint32{0, 1, 2, 0, 2, 1, 1, 2, 0},
+		FaceMaterials: []int32{-1, -1, -1},
+		FaceSmoothing: []uint32{1, 1, 0},
+		Objects: []objparser.Object{
+			{Name: "first", Groups: []objparser.Group{{Names: []string{"a b", "c#d"}, Smoothing: 1, Start: 0, Count: 1}}},
+			{Groups: []objparser.Group{{Smoothing: 1, Start: 1, Count: 1}}},
+			{Name: " \t", Groups: []objparser.Group{{Names: []string{"", "x"}, Start: 2, Count: 1}}},
+		},
+	}
+	var obj bytes.Buffer
+	if err := objparser.Write(&obj, m, ""); err != nil {
+		t.Fatal(err)
+	}
+	got, err := (&objparser.Loader{}).Parse(&obj, "names.obj")
+	if err != nil {
+		t.Fatalf("%v\n%s", err, obj.Bytes())
+	}
+
+	want := []objparser.Object{
+		{Name: "first", Groups: []objparser.Group{{Names: []string{"a_b", "c_d"}, Smoothing: 1, Start: 0, Count: 1}}},
+		{Name: "object1", Groups: []objparser.Group{{Names: []string{"default"}, Smoothing: 1, Start: 1, Count: 1}}},
+		{Name: "object2", Groups: []objparser.Group{{Names: []string{"_", "x"}, Start: 2, Count: 1}}},
+	}
+	if !reflect.DeepEqual(got.Objects, want) {
+		t.Errorf("got objects %+v, want %+v", got.Objects, want)
+	}
+}
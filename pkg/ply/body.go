@@ -0,0 +1,392 @@
+package ply
+
+import (
+	"io"
+	"math"
+	"strconv"
+	s "strings"
+
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/supermuesli/computeshader/pkg/objparser"
+	"github.com/supermuesli/computeshader/pkg/triangulate"
+)
+
+// vertex attributes and the property names exporters use for them
+const (
+	attrX = iota
+	attrY
+	attrZ
+	attrNX
+	attrNY
+	attrNZ
+	attrU
+	attrV
+	attrRed
+	attrGreen
+	attrBlue
+	attrCount
+)
+
+var attributeNames = map[string]int{
+	"x": attrX, "y": attrY, "z": attrZ,
+	"nx": attrNX, "ny": attrNY, "nz": attrNZ,
+	"u": attrU, "v": attrV, "s": attrU, "t": attrV,
+	"texture_u": attrU, "texture_v": attrV, "texture_s": attrU, "texture_t": attrV,
+	"red": attrRed, "green": attrGreen, "blue": attrBlue,
+	"diffuse_red": attrRed, "diffuse_green": attrGreen, "diffuse_blue": attrBlue,
+}
+
+// face is a polygon of the face element, indices[start:end] are its corners
+type face struct {
+	start, end int
+	// line of the face in ascii files, for errors
+	line int
+}
+
+// builder collects the vertex and face elements, which may come in any order
+type builder struct {
+	vertices []objparser.Vertex
+	indices  []int
+	faces    []face
+}
+
+// body reads the elements declared in h, elements other than vertex and
+// face are skipped
+func (r *reader) body(h *header) (*objparser.Mesh, error) {
+	if h.format != ascii {
+		// errors in binary data have no line
+		r.line = 0
+	}
+
+	b := &builder{}
+	for i := range h.elements {
+		e := &h.elements[i]
+		var err error
+		switch e.name {
+		case "vertex":
+			err = r.vertices(e, b)
+		case "face":
+			err = r.faces(e, b)
+		default:
+			err = r.skip(e)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return r.mesh(b)
+}
+
+// vertices reads the vertex element into b.vertices
+func (r *reader) vertices(e *element, b *builder) error {
+	// the attribute every property is read into, -1 for ignored ones
+	attrs := make([]int, len(e.props))
+	var flags objparser.AttributeFlags
+	for i, p := range e.props {
+		attr, ok := attributeNames[p.name]
+		if !ok || p.countType != invalidType {
+			attrs[i] = -1
+			continue
+		}
+		attrs[i] = attr
+		switch attr {
+		case attrNX, attrNY, attrNZ:
+			flags |= objparser.HasNormals
+		case attrU, attrV:
+			flags |= objparser.HasUVs
+		case attrRed, attrGreen, attrBlue:
+			flags |= objparser.HasColors
+		}
+	}
+
+	var values [attrCount]float64
+	for n := 0; n < e.count; n++ {
+		if err := r.beginElement(); err != nil {
+			return err
+		}
+		for i, p := range e.props {
+			if attrs[i] < 0 {
+				if err := r.skipProperty(e, p); err != nil {
+					return err
+				}
+				continue
+			}
+			v, err := r.value(e, p.typ)
+			if err != nil {
+				return err
+			}
+			if attrs[i] >= attrRed {
+				v = normalizeColor(v, p.typ)
+			}
+			values[attrs[i]] = v
+		}
+		if err := r.endElement(); err != nil {
+			return err
+		}
+
+		b.vertices = append(b.vertices, objparser.Vertex{
+			Position: mgl32.Vec3{float32(values[attrX]), float32(values[attrY]), float32(values[attrZ])},
+			Normal:   mgl32.Vec3{float32(values[attrNX]), float32(values[attrNY]), float32(values[attrNZ])},
+			UV:       mgl32.Vec2{float32(values[attrU]), float32(values[attrV])},
+			Color:    mgl32.Vec3{float32(values[attrRed]), float32(values[attrGreen]), float32(values[attrBlue])},
+			Flags:    flags,
+		})
+	}
+	return nil
+}
+
+// normalizeColor maps integer color channels to 0 to 1, float channels
+// already are
+func normalizeColor(v float64, t propType) float64 {
+	switch t {
+	case uint8Type:
+		return v / math.MaxUint8
+	case uint16Type:
+		return v / math.MaxUint16
+	case uint32Type:
+		return v / math.MaxUint32
+	case int8Type:
+		return v / math.MaxInt8
+	case int16Type:
+		return v / math.MaxInt16
+	case int32Type:
+		return v / math.MaxInt32
+	}
+	return v
+}
+
+// faces reads the polygons of the face element into b
+func (r *reader) faces(e *element, b *builder) error {
+	list := -1
+	for i, p := range e.props {
+		if (p.name == "vertex_indices" || p.name == "vertex_index") && p.countType != invalidType {
+			list = i
+		}
+	}
+	if list < 0 {
+		return r.errorAt(e.name, ErrHeader)
+	}
+
+	for n := 0; n < e.count; n++ {
+		if err := r.beginElement(); err != nil {
+			return err
+		}
+		for i, p := range e.props {
+			if i != list {
+				if err := r.skipProperty(e, p); err != nil {
+					return err
+				}
+				continue
+			}
+
+			count, err := r.count(e, p)
+			if err != nil {
+				return err
+			}
+			f := face{start: len(b.indices), line: r.line}
+			for k := 0; k < count; k++ {
+				v, err := r.value(e, p.typ)
+				if err != nil {
+					return err
+				}
+				if v < 0 || v != math.Trunc(v) {
+					return r.errorAt(e.name, ErrIndex)
+				}
+				b.indices = append(b.indices, int(v))
+			}
+			f.end = len(b.indices)
+			b.faces = append(b.faces, f)
+		}
+		if err := r.endElement(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// skip reads over all instances of e
+func (r *reader) skip(e *element) error {
+	for n := 0; n < e.count; n++ {
+		if err := r.beginElement(); err != nil {
+			return err
+		}
+		for _, p := range e.props {
+			if err := r.skipProperty(e, p); err != nil {
+				return err
+			}
+		}
+		if err := r.endElement(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *reader) skipProperty(e *element, p property) error {
+	count := 1
+	if p.countType != invalidType {
+		var err error
+		if count, err = r.count(e, p); err != nil {
+			return err
+		}
+	}
+	for k := 0; k < count; k++ {
+		if _, err := r.value(e, p.typ); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// count reads the length prefix of the list property p
+func (r *reader) count(e *element, p property) (int, error) {
+	v, err := r.value(e, p.countType)
+	if err != nil {
+		return 0, err
+	}
+	if v < 0 {
+		return 0, r.errorAt(p.name, ErrNumber)
+	}
+	return int(v), nil
+}
+
+// beginElement starts the next element instance. In ascii files every
+// instance is a line of its own.
+func (r *reader) beginElement() error {
+	if r.order != nil {
+		return nil
+	}
+	for len(r.fields) == 0 {
+		line, err := r.readLine()
+		if err != nil {
+			return err
+		}
+		r.fields = s.Fields(line)
+	}
+	return nil
+}
+
+// endElement checks that the ascii line of an instance has no values left
+func (r *reader) endElement() error {
+	if len(r.fields) > 0 {
+		err := r.errorAt(r.fields[0], ErrArguments)
+		r.fields = nil
+		return err
+	}
+	return nil
+}
+
+// value reads the next scalar of type t
+func (r *reader) value(e *element, t propType) (float64, error) {
+	if r.order == nil {
+		if len(r.fields) == 0 {
+			return 0, r.errorAt(e.name, ErrArguments)
+		}
+		tok := r.fields[0]
+		r.fields = r.fields[1:]
+		var v float64
+		var err error
+		if t == float32Type || t == float64Type {
+			v, err = strconv.ParseFloat(tok, 64)
+		} else {
+			var i int64
+			i, err = strconv.ParseInt(tok, 10, 64)
+			v = float64(i)
+		}
+		if err != nil {
+			return 0, r.errorAt(tok, ErrNumber)
+		}
+		return v, nil
+	}
+
+	buf := r.buf[:t.size()]
+	if _, err := io.ReadFull(r.in, buf); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return 0, r.errorAt(e.name, err)
+	}
+	switch t {
+	case int8Type:
+		return float64(int8(buf[0])), nil
+	case uint8Type:
+		return float64(buf[0]), nil
+	case int16Type:
+		return float64(int16(r.order.Uint16(buf))), nil
+	case uint16Type:
+		return float64(r.order.Uint16(buf)), nil
+	case int32Type:
+		return float64(int32(r.order.Uint32(buf))), nil
+	case uint32Type:
+		return float64(r.order.Uint32(buf)), nil
+	case float32Type:
+		return float64(math.Float32frombits(r.order.Uint32(buf))), nil
+	default:
+		return math.Float64frombits(r.order.Uint64(buf)), nil
+	}
+}
+
+// mesh triangulates the faces of b into one group with a default
+// material, so that meshes without colors render gray
+func (r *reader) mesh(b *builder) (*objparser.Mesh, error) {
+	m := &objparser.Mesh{
+		Vertices:  b.vertices,
+		Materials: []objparser.Material{objparser.NewMaterial("default")},
+	}
+
+	var corners []mgl32.Vec3
+	for _, f := range b.faces {
+		idx := b.indices[f.start:f.end]
+		corners = corners[:0]
+		for _, i := range idx {
+			if i >= len(m.Vertices) {
+				return nil, &objparser.ParseError{File: r.file, Line: f.line, Token: strconv.Itoa(i), Err: ErrIndex}
+			}
+			corners = append(corners, m.Vertices[i].Position)
+		}
+
+		var tris [][3]int
+		switch {
+		case len(idx) < 3:
+			// points and edges have no area
+			continue
+		case len(idx) == 3:
+			tris = [][3]int{{0, 1, 2}}
+		default:
+			var err error
+			if tris, err = triangulate.Polygon(corners); err != nil {
+				// keep the face as a fan so that nothing goes missing
+				m.Warnings = append(m.Warnings, &objparser.ParseError{File: r.file, Line: f.line, Err: err})
+				tris = tris[:0]
+				for i := 2; i < len(idx); i++ {
+					tris = append(tris, [3]int{0, i - 1, i})
+				}
+			}
+		}
+
+		for _, t := range tris {
+			m.Indices = append(m.Indices, uint32(idx[t[0]]), uint32(idx[t[1]]), uint32(idx[t[2]]))
+			m.FaceMaterials = append(m.FaceMaterials, 0)
+			m.FaceSmoothing = append(m.FaceSmoothing, 0)
+
+			// accumulate area weighted face normals for files without normals
+			p0, p1, p2 := corners[t[0]], corners[t[1]], corners[t[2]]
+			faceNormal := p1.Sub(p0).Cross(p2.Sub(p0))
+			for _, k := range t {
+				if v := &m.Vertices[idx[k]]; v.Flags&objparser.HasNormals == 0 {
+					v.Normal = v.Normal.Add(faceNormal)
+				}
+			}
+		}
+	}
+
+	for i := range m.Vertices {
+		if v := &m.Vertices[i]; v.Normal.Len() > 0 {
+			v.Normal = v.Normal.Normalize()
+		}
+	}
+	if n := m.TriangleCount(); n > 0 {
+		m.Objects = []objparser.Object{{Groups: []objparser.Group{{Names: []string{"default"}, Count: n}}}}
+	}
+	return m, nil
+}
@@ -0,0 +1,14 @@
+package ply
+
+import (
+	"errors"
+)
+
+var (
+	ErrFormat      = errors.New("not a PLY file")
+	ErrHeader      = errors.New("malformed header")
+	ErrNumber      = errors.New("malformed number")
+	ErrArguments   = errors.New("wrong number of values")
+	ErrIndex       = errors.New("index out of range")
+	ErrUnsupported = errors.New("unsupported feature")
+)
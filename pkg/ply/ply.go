@@ -0,0 +1,245 @@
+// Package ply imports Stanford PLY meshes in the ascii and both binary
+// encodings into the mesh type of objparser, including per-vertex colors.
+package ply
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"path/filepath"
+	"strconv"
+	s "strings"
+
+	"github.com/supermuesli/computeshader/pkg/objparser"
+)
+
+// Loader configures how PLY files are read. The zero value is ready to use.
+type Loader struct {
+	// Resolver opens the PLY file, like objparser.Loader.Resolver. Files
+	// are read from disk if it is nil.
+	Resolver objparser.Resolver
+}
+
+// Load reads the .ply file at path with the default Loader
+func Load(path string) (*objparser.Mesh, error) {
+	var l Loader
+	return l.Load(path)
+}
+
+// Load reads the .ply file name, which is a path on disk or a name for
+// l.Resolver
+func (l *Loader) Load(name string) (*objparser.Mesh, error) {
+	res := l.Resolver
+	if res == nil {
+		res = objparser.DiskResolver
+		name = filepath.ToSlash(name)
+	}
+
+	file, err := res.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return l.Parse(file, name)
+}
+
+// Parse reads a PLY file from in, name is only used in errors
+func (l *Loader) Parse(in io.Reader, name string) (*objparser.Mesh, error) {
+	r := &reader{file: name, in: bufio.NewReader(in)}
+	h, err := r.header()
+	if err != nil {
+		return nil, err
+	}
+	return r.body(h)
+}
+
+type format int
+
+const (
+	ascii format = iota
+	binaryLittleEndian
+	binaryBigEndian
+)
+
+// scalar types and their sizes in binary files
+type propType int
+
+const (
+	invalidType propType = iota
+	int8Type
+	uint8Type
+	int16Type
+	uint16Type
+	int32Type
+	uint32Type
+	float32Type
+	float64Type
+)
+
+var typeNames = map[string]propType{
+	"char": int8Type, "int8": int8Type,
+	"uchar": uint8Type, "uint8": uint8Type,
+	"short": int16Type, "int16": int16Type,
+	"ushort": uint16Type, "uint16": uint16Type,
+	"int": int32Type, "int32": int32Type,
+	"uint": uint32Type, "uint32": uint32Type,
+	"float": float32Type, "float32": float32Type,
+	"double": float64Type, "float64": float64Type,
+}
+
+func (t propType) size() int {
+	switch t {
+	case int8Type, uint8Type:
+		return 1
+	case int16Type, uint16Type:
+		return 2
+	case int32Type, uint32Type, float32Type:
+		return 4
+	case float64Type:
+		return 8
+	}
+	return 0
+}
+
+// property is a "property type name" or "property list count item name" line
+type property struct {
+	name string
+	typ  propType
+	// the type of the length prefix, invalidType for scalar properties
+	countType propType
+}
+
+type element struct {
+	name  string
+	count int
+	props []property
+}
+
+type header struct {
+	format   format
+	elements []element
+}
+
+// reader reads the header line by line and the body element by element
+type reader struct {
+	file string
+	in   *bufio.Reader
+	// line of the ascii text read last, binary bodies leave it at end_header
+	line  int
+	order binary.ByteOrder
+	// the values of the current ascii line that were not read yet
+	fields []string
+	buf    [8]byte
+}
+
+func (r *reader) errorAt(tok string, err error) *objparser.ParseError {
+	return &objparser.ParseError{File: r.file, Line: r.line, Token: tok, Err: err}
+}
+
+// readLine returns the next line without line break
+func (r *reader) readLine() (string, error) {
+	line, err := r.in.ReadString('\n')
+	if err == io.EOF && line != "" {
+		err = nil
+	}
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return "", r.errorAt("", err)
+	}
+	r.line++
+	return s.TrimRight(line, "\r\n"), nil
+}
+
+func (r *reader) header() (*header, error) {
+	magic, err := r.readLine()
+	if err != nil || magic != "ply" {
+		return nil, r.errorAt(magic, ErrFormat)
+	}
+
+	h := &header{format: -1}
+	for {
+		line, err := r.readLine()
+		if err != nil {
+			return nil, err
+		}
+		f := s.Fields(line)
+		if len(f) == 0 {
+			continue
+		}
+
+		switch f[0] {
+		case "format":
+			if len(f) != 3 {
+				return nil, r.errorAt(f[0], ErrArguments)
+			}
+			switch f[1] {
+			case "ascii":
+				h.format = ascii
+			case "binary_little_endian":
+				h.format, r.order = binaryLittleEndian, binary.LittleEndian
+			case "binary_big_endian":
+				h.format, r.order = binaryBigEndian, binary.BigEndian
+			default:
+				return nil, r.errorAt(f[1], ErrUnsupported)
+			}
+			if f[2] != "1.0" {
+				return nil, r.errorAt(f[2], ErrUnsupported)
+			}
+		case "element":
+			if len(f) != 3 {
+				return nil, r.errorAt(f[0], ErrArguments)
+			}
+			count, err := strconv.Atoi(f[2])
+			if err != nil || count < 0 {
+				return nil, r.errorAt(f[2], ErrNumber)
+			}
+			h.elements = append(h.elements, element{name: f[1], count: count})
+		case "property":
+			if len(h.elements) == 0 {
+				return nil, r.errorAt(f[0], ErrHeader)
+			}
+			p, err := r.property(f)
+			if err != nil {
+				return nil, err
+			}
+			e := &h.elements[len(h.elements)-1]
+			e.props = append(e.props, p)
+		case "comment", "obj_info":
+		case "end_header":
+			if h.format < 0 {
+				return nil, r.errorAt(f[0], ErrHeader)
+			}
+			return h, nil
+		default:
+			return nil, r.errorAt(f[0], ErrHeader)
+		}
+	}
+}
+
+func (r *reader) property(f []string) (property, error) {
+	if len(f) >= 2 && f[1] == "list" {
+		if len(f) != 5 {
+			return property{}, r.errorAt(f[0], ErrArguments)
+		}
+		p := property{name: f[4], countType: typeNames[f[2]], typ: typeNames[f[3]]}
+		if p.countType == invalidType || p.countType == float32Type || p.countType == float64Type {
+			return p, r.errorAt(f[2], ErrHeader)
+		}
+		if p.typ == invalidType {
+			return p, r.errorAt(f[3], ErrHeader)
+		}
+		return p, nil
+	}
+
+	if len(f) != 3 {
+		return property{}, r.errorAt(f[0], ErrArguments)
+	}
+	p := property{name: f[2], typ: typeNames[f[1]]}
+	if p.typ == invalidType {
+		return p, r.errorAt(f[1], ErrHeader)
+	}
+	return p, nil
+}
@@ -0,0 +1,265 @@
+package ply
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/supermuesli/computeshader/pkg/objparser"
+)
+
+// fixtureElement is an element of a test file. Its rows hold the values of
+// all properties in order, a list is its length followed by its items.
+type fixtureElement struct {
+	name  string
+	props []string
+	rows  [][]float64
+}
+
+// encode returns the file with the elements in the given format
+func encode(format string, elements []fixtureElement) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "ply\nformat %s 1.0\ncomment test fixture\n", format)
+	for _, e := range elements {
+		fmt.Fprintf(&buf, "element %s %d\n", e.name, len(e.rows))
+		for _, p := range e.props {
+			fmt.Fprintf(&buf, "property %s\n", p)
+		}
+	}
+	buf.WriteString("end_header\n")
+
+	var order binary.ByteOrder = binary.LittleEndian
+	switch format {
+	case "binary_big_endian":
+		order = binary.BigEndian
+	case "ascii":
+		for _, e := range elements {
+			for _, row := range e.rows {
+				f := []string{}
+				for _, v := range row {
+					f = append(f, strconv.FormatFloat(v, 'f', -1, 64))
+				}
+				fmt.Fprintf(&buf, "%s\n", strings.Join(f, " "))
+			}
+		}
+		return buf.Bytes()
+	}
+
+	for _, e := range elements {
+		for _, row := range e.rows {
+			for _, p := range e.props {
+				f := strings.Fields(p)
+				if f[0] != "list" {
+					writeValue(&buf, order, f[0], row[0])
+					row = row[1:]
+					continue
+				}
+				n := int(row[0])
+				writeValue(&buf, order, f[1], row[0])
+				for _, v := range row[1 : 1+n] {
+					writeValue(&buf, order, f[2], v)
+				}
+				row = row[1+n:]
+			}
+		}
+	}
+	return buf.Bytes()
+}
+
+func writeValue(w io.Writer, order binary.ByteOrder, typ string, v float64) {
+	var data interface{}
+	switch typeNames[typ] {
+	case int8Type:
+		data = int8(v)
+	case uint8Type:
+		data = uint8(v)
+	case int16Type:
+		data = int16(v)
+	case uint16Type:
+		data = uint16(v)
+	case int32Type:
+		data = int32(v)
+	case uint32Type:
+		data = uint32(v)
+	case float32Type:
+		data = float32(v)
+	case float64Type:
+		data = v
+	}
+	binary.Write(w, order, data)
+}
+
+func parse(data []byte) (*objparser.Mesh, error) {
+	var l Loader
+	return l.Parse(bytes.NewReader(data), "test.ply")
+}
+
+var formats = []string{"ascii", "binary_little_endian", "binary_big_endian"}
+
+// quad is a colored quad with normals, a list property of the vertices, a
+// scalar property of the faces and an element that are all skipped
+var quad = []fixtureElement{
+	{"vertex", []string{"float x", "float y", "double z", "float nx", "float ny", "float nz", "list uchar int skipped", "uchar red", "uchar green", "uchar blue"}, [][]float64{
+		{0, 0, 0, 0, 0, 1, 2, 7, 8, 255, 0, 0},
+		{1, 0, 0, 0, 0, 1, 0, 0, 255, 0},
+		{1, 1, 0, 0, 0, 1, 1, 9, 0, 0, 255},
+		{0, 1, 0.5, 0, 0, 1, 0, 51, 102, 153},
+	}},
+	{"edge", []string{"int vertex1", "int vertex2"}, [][]float64{{0, 1}, {1, 2}}},
+	{"face", []string{"list uchar uint vertex_indices", "short flags"}, [][]float64{
+		{4, 0, 1, 2, 3, -1},
+	}},
+}
+
+func TestFormats(t *testing.T) {
+	flags := objparser.HasNormals | objparser.HasColors
+	want := &objparser.Mesh{
+		Vertices: []objparser.Vertex{
+			{Position: mgl32.Vec3{0, 0, 0}, Normal: mgl32.Vec3{0, 0, 1}, Color: mgl32.Vec3{1, 0, 0}, Flags: flags},
+			{Position: mgl32.Vec3{1, 0, 0}, Normal: mgl32.Vec3{0, 0, 1}, Color: mgl32.Vec3{0, 1, 0}, Flags: flags},
+			{Position: mgl32.Vec3{1, 1, 0}, Normal: mgl32.Vec3{0, 0, 1}, Color: mgl32.Vec3{0, 0, 1}, Flags: flags},
+			{Position: mgl32.Vec3{0, 1, 0.5}, Normal: mgl32.Vec3{0, 0, 1}, Color: mgl32.Vec3{0.2, 0.4, 0.6}, Flags: flags},
+		},
+		Indices:       []uint32{0, 1, 2, 0, 2, 3},
+		FaceMaterials: []int32{0, 0},
+		FaceSmoothing: []uint32{0, 0},
+		Materials:     []objparser.Material{objparser.NewMaterial("default")},
+		Objects:       []objparser.Object{{Groups: []objparser.Group{{Names: []string{"default"}, Count: 2}}}},
+	}
+	for _, format := range formats {
+		got, err := parse(encode(format, quad))
+		if err != nil {
+			t.Errorf("%s: %v", format, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %+v, want %+v", format, got, want)
+		}
+	}
+}
+
+func TestGeneratedNormals(t *testing.T) {
+	// two triangles folded along the x axis, without normals
+	elements := []fixtureElement{
+		{"vertex", []string{"float x", "float y", "float z"}, [][]float64{{0, 0, 0}, {1, 0, 0}, {0, 1, 0}, {0, 0, 1}}},
+		{"face", []string{"list uchar int vertex_index"}, [][]float64{{3, 0, 1, 2}, {3, 1, 0, 3}}},
+	}
+	m, err := parse(encode("binary_little_endian", elements))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := float32(math.Sqrt2 / 2)
+	want := []mgl32.Vec3{{0, s, s}, {0, s, s}, {0, 0, 1}, {0, 1, 0}}
+	for i, v := range m.Vertices {
+		if v.Normal.Sub(want[i]).Len() > 1e-6 || v.Flags != 0 {
+			t.Errorf("vertex %d: got normal %v with flags %d, want a generated %v", i, v.Normal, v.Flags, want[i])
+		}
+	}
+}
+
+func TestNormalizeColor(t *testing.T) {
+	tests := []struct {
+		typ  string
+		v    float64
+		want float64
+	}{
+		{"uchar", 255, 1},
+		{"uchar", 51, 0.2},
+		{"ushort", 65535, 1},
+		{"uint", math.MaxUint32, 1},
+		{"char", 127, 1},
+		{"short", 32767, 1},
+		{"int", math.MaxInt32, 1},
+		{"int", 0, 0},
+		{"float", 0.25, 0.25},
+		{"double", 0.75, 0.75},
+	}
+	for _, tt := range tests {
+		if got := normalizeColor(tt.v, typeNames[tt.typ]); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("%s %v: got %v, want %v", tt.typ, tt.v, got, tt.want)
+		}
+
+		// the same through a file in every format
+		elements := []fixtureElement{{"vertex", []string{"float x", "float y", "float z", tt.typ + " red", tt.typ + " green", tt.typ + " blue"}, [][]float64{{0, 0, 0, tt.v, 0, tt.v}}}}
+		for _, format := range formats {
+			m, err := parse(encode(format, elements))
+			if err != nil {
+				t.Errorf("%s %s: %v", format, tt.typ, err)
+				continue
+			}
+			if c := m.Vertices[0].Color; math.Abs(float64(c[0])-tt.want) > 1e-6 || c[1] != 0 || c[0] != c[2] {
+				t.Errorf("%s %s %v: got color %v, want %v", format, tt.typ, tt.v, c, tt.want)
+			}
+		}
+	}
+}
+
+func TestErrors(t *testing.T) {
+	triangle := [][]float64{{0, 0, 0}, {1, 0, 0}, {0, 1, 0}}
+	position := []string{"float x", "float y", "float z"}
+	tests := []struct {
+		name     string
+		elements []fixtureElement
+		want     error
+		// the line of the error in the ascii file, binary ones have none
+		line int
+	}{
+		{"index", []fixtureElement{
+			{"vertex", position, triangle},
+			{"face", []string{"list uchar int vertex_indices"}, [][]float64{{3, 0, 1, 2}, {3, 0, 1, 3}}},
+		}, ErrIndex, 15},
+		{"negative index", []fixtureElement{
+			{"vertex", position, triangle},
+			{"face", []string{"list uchar int vertex_indices"}, [][]float64{{3, 0, -1, 2}}},
+		}, ErrIndex, 14},
+		// reported where the face element starts
+		{"no index list", []fixtureElement{
+			{"vertex", position, triangle},
+			{"face", []string{"int vertex_indices"}, [][]float64{{0}}},
+		}, ErrHeader, 13},
+	}
+	for _, tt := range tests {
+		for _, format := range formats {
+			_, err := parse(encode(format, tt.elements))
+			line := tt.line
+			if format != "ascii" {
+				line = 0
+			}
+			var perr *objparser.ParseError
+			if !errors.Is(err, tt.want) || !errors.As(err, &perr) || perr.Line != line {
+				t.Errorf("%s %s: got %v, want %v on line %d", tt.name, format, err, tt.want, line)
+			}
+		}
+	}
+
+	// files with a malformed header or body
+	files := []struct {
+		name string
+		data string
+		want error
+	}{
+		{"magic", "obj\n", ErrFormat},
+		{"empty", "", ErrFormat},
+		{"no format", "ply\nelement vertex 0\nend_header\n", ErrHeader},
+		{"format", "ply\nformat binary 1.0\nend_header\n", ErrUnsupported},
+		{"property type", "ply\nformat ascii 1.0\nelement vertex 1\nproperty half x\nend_header\n", ErrHeader},
+		{"float count", "ply\nformat ascii 1.0\nelement face 1\nproperty list float int vertex_indices\nend_header\n", ErrHeader},
+		{"extra value", "ply\nformat ascii 1.0\nelement vertex 1\nproperty float x\nend_header\n1 2\n", ErrArguments},
+		{"number", "ply\nformat ascii 1.0\nelement vertex 1\nproperty int x\nend_header\n1.5\n", ErrNumber},
+		{"truncated", "ply\nformat binary_little_endian 1.0\nelement vertex 1\nproperty float x\nend_header\n\x00\x00", io.ErrUnexpectedEOF},
+		{"no header end", "ply\nformat ascii 1.0\n", io.ErrUnexpectedEOF},
+	}
+	for _, tt := range files {
+		if _, err := parse([]byte(tt.data)); !errors.Is(err, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
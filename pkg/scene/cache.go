@@ -0,0 +1,117 @@
+package scene
+
+import (
+	"fmt"
+	"hash/fnv"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/supermuesli/computeshader/pkg/bvh"
+	"github.com/supermuesli/computeshader/pkg/cache"
+	"github.com/supermuesli/computeshader/pkg/objparser"
+)
+
+// loadCached returns the mesh of the file name and the hierarchy over its
+// triangles from l.CacheDir if the cache is up to date, otherwise it parses
+// the file, builds the hierarchy and writes a new cache. Failing to write
+// the cache is only a warning.
+func (l *Loader) loadCached(name string) (*objparser.Mesh, meshHierarchy, error) {
+	cacheName := l.cacheName(name)
+	if mesh, h, ok := l.readCache(cacheName); ok {
+		return mesh, h, nil
+	}
+
+	rec := &recordingResolver{}
+	mesh, err := l.parse(rec, name)
+	if err != nil {
+		return nil, meshHierarchy{}, err
+	}
+	h := buildHierarchy(mesh)
+	entry := &cache.Entry{Mesh: mesh, Triangles: h.triangles, BVH: h.bvh, Dependencies: rec.deps}
+	if err := cache.Save(cacheName, entry); err != nil {
+		mesh.Warnings = append(mesh.Warnings, &objparser.ParseError{File: cacheName, Err: err})
+	}
+	return mesh, h, nil
+}
+
+// readCache returns the cached mesh and hierarchy, false if there is no
+// usable cache
+func (l *Loader) readCache(cacheName string) (*objparser.Mesh, meshHierarchy, bool) {
+	c := openCache(cacheName)
+	if c == nil {
+		return nil, meshHierarchy{}, false
+	}
+	defer c.Close()
+
+	mesh, err := c.Mesh()
+	if err != nil {
+		return nil, meshHierarchy{}, false
+	}
+	h, err := c.BVH()
+	if err != nil {
+		return nil, meshHierarchy{}, false
+	}
+	triangles, err := c.Triangles()
+	if err != nil {
+		return nil, meshHierarchy{}, false
+	}
+	// copied out of the mapped file, which is closed on return
+	h = &bvh.BVH{Nodes: append([]bvh.Node{}, h.Nodes...), Indices: append([]int32{}, h.Indices...)}
+	triangles = append([]objparser.Triangle{}, triangles...)
+	if l.LoadTextures {
+		mesh.LoadTextures(objparser.DiskResolver)
+	}
+	return mesh, meshHierarchy{triangles: triangles, bvh: h}, true
+}
+
+// openCache opens the cache file cacheName, nil if there is none or it is
+// stale
+func openCache(cacheName string) *cache.Cache {
+	c, err := cache.Open(cacheName)
+	if err != nil {
+		return nil
+	}
+	if c.Stale() {
+		c.Close()
+		return nil
+	}
+	return c
+}
+
+// cacheName returns the cache file of the model file name, the options
+// that change the result are part of the key
+func (l *Loader) cacheName(name string) string {
+	if abs, err := filepath.Abs(filepath.FromSlash(name)); err == nil {
+		name = abs
+	}
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%s\x00%t", name, l.Lenient)
+	return filepath.Join(l.CacheDir, fmt.Sprintf("%016x.cssc", h.Sum64()))
+}
+
+// recordingResolver opens files on disk and remembers them as dependencies
+// of the cache, the ones that do not exist as well
+type recordingResolver struct {
+	deps []cache.Dependency
+}
+
+func (r *recordingResolver) Open(name string) (io.ReadCloser, error) {
+	// absolute, the working directory may be another one next time
+	path, err := filepath.Abs(filepath.FromSlash(name))
+	if err != nil {
+		path = filepath.FromSlash(name)
+	}
+	file, err := objparser.DiskResolver.Open(name)
+	if err != nil {
+		// creating the file later changes what the loader makes of it
+		if os.IsNotExist(err) {
+			r.deps = append(r.deps, cache.Missing(path))
+		}
+		return nil, err
+	}
+	if dep, err := cache.Stat(path); err == nil {
+		r.deps = append(r.deps, dep)
+	}
+	return file, nil
+}
@@ -0,0 +1,84 @@
+package scene
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func tempDir(t *testing.T) (string, func()) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "scene")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+func writeFile(t *testing.T, name, data string) {
+	t.Helper()
+	if err := ioutil.WriteFile(name, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// messages returns the texts of the warnings of sc, cached warnings only
+// keep those
+func messages(sc *Scene) []string {
+	out := []string{}
+	for _, w := range sc.Warnings() {
+		out = append(out, w.Error())
+	}
+	return out
+}
+
+func TestLoadCached(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	model := filepath.Join(dir, "quad.obj")
+	writeFile(t, model, "mtllib quad.mtl\nv 0 0 0\nv 1 0 0\nv 1 1 0\nv 0 1 0\nusemtl red\nf 1 2 3 4\n")
+	l := Loader{Lenient: true, CacheDir: filepath.Join(dir, "cache")}
+	if err := os.Mkdir(l.CacheDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	miss, err := l.Load(model)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caches, _ := filepath.Glob(filepath.Join(l.CacheDir, "*.cssc"))
+	if len(caches) != 1 {
+		t.Fatalf("got cache files %v, want one", caches)
+	}
+	// the missing library and the unknown material
+	if len(miss.Warnings()) != 2 {
+		t.Errorf("got warnings %v, want 2", miss.Warnings())
+	}
+
+	hit, err := l.Load(model)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, got := *miss.Models[0].Mesh, *hit.Models[0].Mesh
+	want.Warnings, got.Warnings = nil, nil
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got cached mesh %+v, want %+v", got, want)
+	}
+	if !reflect.DeepEqual(messages(hit), messages(miss)) {
+		t.Errorf("got cached warnings %v, want %v", messages(hit), messages(miss))
+	}
+
+	// the library the cached load did not find
+	writeFile(t, filepath.Join(dir, "quad.mtl"), "newmtl red\nKd 1 0 0\n")
+	sc, err := l.Load(model)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mesh := sc.Models[0].Mesh
+	if len(mesh.Materials) != 1 || !reflect.DeepEqual(mesh.FaceMaterials, []int32{0, 0}) || len(sc.Warnings()) != 0 {
+		t.Errorf("got materials %+v, face materials %v and warnings %v after creating the library",
+			mesh.Materials, mesh.FaceMaterials, sc.Warnings())
+	}
+}
@@ -0,0 +1,248 @@
+package scene
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"sort"
+
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/supermuesli/computeshader/pkg/meshutil"
+	"github.com/supermuesli/computeshader/pkg/objparser"
+)
+
+// description is the json schema of a scene description file:
+//
+//	{
+//		"models": [{
+//			"file": "CornellBox-Original.obj",
+//			"translate": [0, 0, 0],
+//			"rotate": [0, 90, 0],
+//			"scale": [1, 1, 1],
+//			"normalize": true,
+//			"materials": {"leftWall": {"diffuse": [0.1, 0.1, 0.8]}}
+//		}],
+//		"lights": [{"position": [-0.2, 1.98, -0.2], "u": [0.4, 0, 0], "v": [0, 0, 0.4], "emission": [17, 12, 4]}],
+//		"camera": {"position": [0, 300, 950], "target": [0, 300, 0], "fov": 53.13, "speed": 50},
+//		"settings": {"width": 800, "height": 600, "hops": 3}
+//	}
+//
+// Model files are relative to the description. rotate are euler angles in
+// degrees, applied around x, then y, then z. normalize centers the model and
+// scales it to fit the cube [-1, 1] before the other transforms. The
+// material "*" overrides
+// every material of the model. The camera looks at target, or along
+// "direction" instead, and fov is its vertical field of view in degrees.
+// Everything but the file names is optional.
+type description struct {
+	Models []struct {
+		File      string                      `json:"file"`
+		Translate *[3]float32                 `json:"translate"`
+		Rotate    *[3]float32                 `json:"rotate"`
+		Scale     *[3]float32                 `json:"scale"`
+		Normalize bool                        `json:"normalize"`
+		Materials map[string]materialOverride `json:"materials"`
+	} `json:"models"`
+	Lights []struct {
+		Position [3]float32 `json:"position"`
+		U        [3]float32 `json:"u"`
+		V        [3]float32 `json:"v"`
+		Emission [3]float32 `json:"emission"`
+	} `json:"lights"`
+	Camera struct {
+		Position  *[3]float32 `json:"position"`
+		Target    *[3]float32 `json:"target"`
+		Direction *[3]float32 `json:"direction"`
+		FOV       *float32    `json:"fov"`
+		Speed     *float32    `json:"speed"`
+	} `json:"camera"`
+	Settings struct {
+		Width  *int `json:"width"`
+		Height *int `json:"height"`
+		Hops   *int `json:"hops"`
+	} `json:"settings"`
+}
+
+// materialOverride replaces the parameters of a material that are set
+type materialOverride struct {
+	Diffuse   *[3]float32 `json:"diffuse"`
+	Specular  *[3]float32 `json:"specular"`
+	Emissive  *[3]float32 `json:"emissive"`
+	Roughness *float32    `json:"roughness"`
+	Metallic  *float32    `json:"metallic"`
+	IOR       *float32    `json:"ior"`
+	Opacity   *float32    `json:"opacity"`
+}
+
+func (o *materialOverride) apply(m *objparser.Material) {
+	if o.Diffuse != nil {
+		m.Diffuse = *o.Diffuse
+	}
+	if o.Specular != nil {
+		m.Specular = *o.Specular
+	}
+	if o.Emissive != nil {
+		m.Emissive = *o.Emissive
+	}
+	if o.Roughness != nil {
+		m.Roughness = *o.Roughness
+	}
+	if o.Metallic != nil {
+		m.Metallic = *o.Metallic
+	}
+	if o.IOR != nil {
+		m.OpticalDensity = *o.IOR
+	}
+	if o.Opacity != nil {
+		m.Dissolve = *o.Opacity
+	}
+}
+
+// LoadDescription reads the scene description file name and the model
+// files it lists. A file that is listed several times is only loaded once
+// and its models share the mesh.
+func (l *Loader) LoadDescription(name string) (*Scene, error) {
+	res := l.Resolver
+	if res == nil {
+		res = objparser.DiskResolver
+		name = filepath.ToSlash(name)
+	}
+	file, err := res.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var desc description
+	dec := json.NewDecoder(file)
+	// typos should not silently fall back to defaults
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&desc); err != nil {
+		return nil, &objparser.ParseError{File: name, Err: err}
+	}
+
+	sc := New()
+	meshes := map[string]*objparser.Mesh{}
+	for _, md := range desc.Models {
+		if md.File == "" {
+			return nil, &objparser.ParseError{File: name, Token: "file", Err: objparser.ErrArguments}
+		}
+		modelName := objparser.Resolve(name, md.File)
+		mesh, ok := meshes[modelName]
+		if !ok {
+			if mesh, err = l.loadMesh(sc, modelName); err != nil {
+				return nil, err
+			}
+			meshes[modelName] = mesh
+		}
+
+		m := Model{Name: modelName, Mesh: mesh, Transform: mgl32.Ident4()}
+		if len(md.Materials) > 0 {
+			if m.Materials, err = l.overrideMaterials(sc, name, mesh, md.Materials); err != nil {
+				return nil, err
+			}
+		}
+		if t := md.Translate; t != nil {
+			m.Transform = mgl32.Translate3D(t[0], t[1], t[2])
+		}
+		if r := md.Rotate; r != nil {
+			rotation := mgl32.AnglesToQuat(mgl32.DegToRad(r[2]), mgl32.DegToRad(r[1]), mgl32.DegToRad(r[0]), mgl32.ZYX)
+			m.Transform = m.Transform.Mul4(rotation.Mat4())
+		}
+		if scale := md.Scale; scale != nil {
+			m.Transform = m.Transform.Mul4(mgl32.Scale3D(scale[0], scale[1], scale[2]))
+		}
+		if md.Normalize {
+			m.Transform = m.Transform.Mul4(meshutil.NormalizeTransform(mesh))
+		}
+		sc.Models = append(sc.Models, m)
+	}
+
+	for _, ld := range desc.Lights {
+		sc.Lights = append(sc.Lights, Light{Position: ld.Position, U: ld.U, V: ld.V, Emission: ld.Emission})
+	}
+
+	if p := desc.Camera.Position; p != nil {
+		sc.Camera.Position = *p
+	}
+	if sp := desc.Camera.Speed; sp != nil {
+		sc.Camera.Speed = *sp
+	}
+	if token := cameraView(&sc.Camera, desc.Camera.Target, desc.Camera.Direction, desc.Camera.FOV); token != "" {
+		return nil, &objparser.ParseError{File: name, Token: token, Err: ErrCamera}
+	}
+	if w := desc.Settings.Width; w != nil {
+		sc.Settings.Width = *w
+	}
+	if h := desc.Settings.Height; h != nil {
+		sc.Settings.Height = *h
+	}
+	if h := desc.Settings.Hops; h != nil {
+		sc.Settings.Hops = *h
+	}
+	return sc, nil
+}
+
+// cameraView points c at target or along direction and sets its field of
+// view. It returns the offending property, "" if there is none.
+func cameraView(c *Camera, target, direction *[3]float32, fov *float32) string {
+	switch {
+	case target != nil && direction != nil:
+		return "direction"
+	case target != nil:
+		c.Direction = mgl32.Vec3(*target).Sub(c.Position)
+		if c.Direction.Len() == 0 {
+			return "target"
+		}
+	case direction != nil:
+		c.Direction = *direction
+		if c.Direction.Len() == 0 {
+			return "direction"
+		}
+	}
+	c.Direction = c.Direction.Normalize()
+	if fov != nil {
+		if *fov <= 0 || *fov >= 180 {
+			return "fov"
+		}
+		c.FOV = *fov
+	}
+	return ""
+}
+
+// overrideMaterials returns a copy of the materials of mesh with overrides
+// applied. Unknown material names fail unless l.Lenient is set, then they
+// are added to the warnings of sc.
+func (l *Loader) overrideMaterials(sc *Scene, file string, mesh *objparser.Mesh, overrides map[string]materialOverride) ([]objparser.Material, error) {
+	materials := append([]objparser.Material{}, mesh.Materials...)
+	if o, ok := overrides["*"]; ok {
+		for i := range materials {
+			o.apply(&materials[i])
+		}
+	}
+	names := make([]string, 0, len(overrides))
+	for name := range overrides {
+		if name != "*" {
+			names = append(names, name)
+		}
+	}
+	// deterministic warnings
+	sort.Strings(names)
+	for _, name := range names {
+		o := overrides[name]
+		found := false
+		for i := range materials {
+			if materials[i].Name == name {
+				o.apply(&materials[i])
+				found = true
+			}
+		}
+		if !found {
+			err := &objparser.ParseError{File: file, Token: name, Err: objparser.ErrUnknownMaterial}
+			if !l.Lenient {
+				return nil, err
+			}
+			sc.warnings = append(sc.warnings, err)
+		}
+	}
+	return materials, nil
+}
@@ -0,0 +1,79 @@
+package scene
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/supermuesli/computeshader/pkg/objparser"
+)
+
+func TestUnknownFields(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	writeFile(t, filepath.Join(dir, "triangle.obj"), "v 0 0 0\nv 1 0 0\nv 0 1 0\nf 1 2 3\n")
+
+	tests := []struct {
+		name, json string
+		// the misspelled field
+		field string
+	}{
+		{"top level", `{"modles": [{"file": "triangle.obj"}]}`, "modles"},
+		{"model", `{"models": [{"file": "triangle.obj", "translation": [1, 0, 0]}]}`, "translation"},
+		{"material", `{"models": [{"file": "triangle.obj", "materials": {"*": {"difuse": [1, 0, 0]}}}]}`, "difuse"},
+		{"camera", `{"camera": {"fov": 60, "lookat": [0, 0, 0]}}`, "lookat"},
+	}
+	for _, tt := range tests {
+		name := filepath.Join(dir, "scene.json")
+		writeFile(t, name, tt.json)
+		var l Loader
+		_, err := l.Load(name)
+		var perr *objparser.ParseError
+		if !errors.As(err, &perr) || perr.File != filepath.ToSlash(name) || !strings.Contains(err.Error(), tt.field) {
+			t.Errorf("%s: got %v, want an error about %s", tt.name, err, tt.field)
+		}
+	}
+}
+
+func TestMaterialOverrides(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	writeFile(t, filepath.Join(dir, "faces.mtl"), "newmtl red\nKd 1 0 0\nnewmtl green\nKd 0 1 0\n")
+	writeFile(t, filepath.Join(dir, "faces.obj"), "mtllib faces.mtl\nv 0 0 0\nv 1 0 0\nv 0 1 0\n"+
+		"usemtl red\nf 1 2 3\nusemtl green\nf 1 2 3\n")
+	// the same mesh twice, the second time white with a blue second
+	// material, named overrides go after "*"
+	name := filepath.Join(dir, "scene.json")
+	writeFile(t, name, `{"models": [
+		{"file": "faces.obj"},
+		{"file": "faces.obj", "translate": [2, 0, 0], "materials": {"green": {"diffuse": [0, 0, 1]}, "*": {"diffuse": [1, 1, 1]}}}
+	]}`)
+
+	var l Loader
+	sc, err := l.Load(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	in := sc.Instanced()
+	if len(in.Instances) != 2 || in.Instances[0].First != in.Instances[1].First {
+		t.Fatalf("got instances %+v, want two of the same mesh", in.Instances)
+	}
+	if in.Instances[0].Materials != -1 {
+		t.Errorf("got materials %d for the model without overrides, want -1", in.Instances[0].Materials)
+	}
+
+	// Color.w of a triangle picks its override in the materials of the instance
+	inst := in.Instances[1]
+	for i, want := range []mgl32.Vec3{{1, 1, 1}, {0, 0, 1}} {
+		w := in.Triangles[inst.First+int32(i)].Color[3]
+		if w != float32(i) {
+			t.Errorf("triangle %d: got material %v in Color.w, want %d", i, w, i)
+			continue
+		}
+		if c := in.Materials[inst.Materials+int32(w)].Color.Vec3(); c != want {
+			t.Errorf("triangle %d: got override color %v, want %v", i, c, want)
+		}
+	}
+}
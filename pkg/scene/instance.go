@@ -0,0 +1,236 @@
+package scene
+
+import (
+	"path"
+	"path/filepath"
+	"runtime"
+	s "strings"
+
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/supermuesli/computeshader/pkg/bvh"
+	"github.com/supermuesli/computeshader/pkg/cache"
+	"github.com/supermuesli/computeshader/pkg/meshutil"
+	"github.com/supermuesli/computeshader/pkg/objparser"
+)
+
+// Instance places a mesh of Instanced.Triangles in the scene, laid out
+// like the Instance struct of the compute shader (std430)
+type Instance struct {
+	// Transform maps the mesh into the scene, Inverse maps it back
+	Transform mgl32.Mat4
+	Inverse   mgl32.Mat4
+	// scene space bounds of the placed mesh, w is padding
+	Min, Max mgl32.Vec4
+	// the triangles of the mesh in Instanced.Triangles
+	First, Count int32
+	// Materials is the index of the override of the first material of the
+	// mesh in Instanced.Materials, or -1 if the mesh materials are used
+	Materials int32
+	// Root is the root node of the hierarchy of the mesh in Instanced.BVH
+	Root int32
+}
+
+// Material is a material override, laid out like the Material struct of the
+// compute shader (std430)
+type Material struct {
+	Color     mgl32.Vec4
+	Intensity mgl32.Vec4
+}
+
+// Instanced is the scene the way the compute shader traverses it: every
+// mesh uploaded once and the models as instances of them. A hierarchy over
+// the instances is the top level, one over the triangles of every mesh the
+// bottom level.
+type Instanced struct {
+	// Triangles of all meshes in mesh space. Color.w is the index of the
+	// face material in the mesh, -1 for faces without one and for faces
+	// with vertex colors, which are not overridden.
+	Triangles []objparser.Triangle
+	Instances []Instance
+	Materials []Material
+	// BVH holds the hierarchies of all meshes, the indices of their leaves
+	// are into Triangles, and the one over the instances, the indices of
+	// its leaves are into Instances
+	BVH *bvh.BVH
+	// Root is the root node of the hierarchy over the instances, -1 if
+	// there are none
+	Root int32
+
+	// the mapped cache file of LoadInstanced
+	cache *cache.Cache
+}
+
+// meshHierarchy is the triangles of a mesh the way Instanced uploads them
+// and the hierarchy over them
+type meshHierarchy struct {
+	triangles []objparser.Triangle
+	bvh       *bvh.BVH
+}
+
+var builder = bvh.Builder{Workers: runtime.NumCPU()}
+
+// buildHierarchy returns the triangles of mesh with the index of their
+// face material in Color.w and builds the hierarchy over them
+func buildHierarchy(mesh *objparser.Mesh) meshHierarchy {
+	triangles := mesh.Triangles()
+	for i := range triangles {
+		a, b, c := mesh.Indices[3*i], mesh.Indices[3*i+1], mesh.Indices[3*i+2]
+		if mesh.Vertices[a].Flags&mesh.Vertices[b].Flags&mesh.Vertices[c].Flags&objparser.HasColors != 0 {
+			triangles[i].Color[3] = -1
+		} else {
+			triangles[i].Color[3] = float32(mesh.FaceMaterials[i])
+		}
+	}
+	return meshHierarchy{triangles: triangles, bvh: builder.Build(triangles)}
+}
+
+// span is a mesh in Instanced.Triangles
+type span struct {
+	first, count, root int32
+	bounds             meshutil.Box
+}
+
+func newInstanced() *Instanced {
+	return &Instanced{
+		Triangles: []objparser.Triangle{},
+		Instances: []Instance{},
+		Materials: []Material{},
+		BVH:       &bvh.BVH{Nodes: []bvh.Node{}, Indices: []int32{}},
+	}
+}
+
+// add uploads a mesh
+func (in *Instanced) add(h meshHierarchy) span {
+	sp := span{first: int32(len(in.Triangles)), count: int32(len(h.triangles)), bounds: meshutil.EmptyBox()}
+	if len(h.bvh.Nodes) > 0 {
+		sp.bounds = h.bvh.Nodes[0].Bounds()
+	}
+	sp.root = bvh.Concat(in.BVH, h.bvh, sp.first)
+	if len(in.Triangles) == 0 {
+		// the first mesh is not copied, it may be a mapped cache file
+		in.Triangles = h.triangles[:len(h.triangles):len(h.triangles)]
+	} else {
+		in.Triangles = append(in.Triangles, h.triangles...)
+	}
+	return sp
+}
+
+// place adds an instance of the mesh sp
+func (in *Instanced) place(sp span, transform mgl32.Mat4, materials int32) {
+	if sp.count == 0 {
+		return
+	}
+	bounds := sp.bounds.Transform(transform)
+	in.Instances = append(in.Instances, Instance{
+		Transform: transform,
+		Inverse:   transform.Inv(),
+		Min:       bounds.Min.Vec4(-1337),
+		Max:       bounds.Max.Vec4(-1337),
+		First:     sp.first,
+		Count:     sp.count,
+		Materials: materials,
+		Root:      sp.root,
+	})
+}
+
+// buildTop builds the hierarchy over the instances
+func (in *Instanced) buildTop() {
+	boxes := make([]meshutil.Box, len(in.Instances))
+	for i, inst := range in.Instances {
+		boxes[i] = meshutil.Box{Min: inst.Min.Vec3(), Max: inst.Max.Vec3()}
+	}
+	in.Root = bvh.Concat(in.BVH, builder.BuildBoxes(boxes), 0)
+}
+
+// Close releases the cache file of LoadInstanced, the slices of in must not
+// be used after. It does nothing for other Instanced.
+func (in *Instanced) Close() error {
+	if in.cache == nil {
+		return nil
+	}
+	c := in.cache
+	in.cache = nil
+	return c.Close()
+}
+
+// Instanced returns the meshes of all models once and an instance for every
+// model. The lights are one more mesh with an instance of its own.
+// Hierarchies of meshes that came from a cache are not built again.
+func (s *Scene) Instanced() *Instanced {
+	in := newInstanced()
+	spans := map[*objparser.Mesh]span{}
+	for _, m := range s.Models {
+		sp, ok := spans[m.Mesh]
+		if !ok {
+			h, ok := s.hierarchies[m.Mesh]
+			if !ok {
+				h = buildHierarchy(m.Mesh)
+			}
+			sp = in.add(h)
+			spans[m.Mesh] = sp
+		}
+
+		materials := int32(-1)
+		if m.Materials != nil {
+			materials = int32(len(in.Materials))
+			for _, mat := range m.Materials {
+				rm := mat.Render()
+				in.Materials = append(in.Materials, Material{Color: rm.Albedo.Vec4(-1337), Intensity: rm.Emission.Vec4(-1337)})
+			}
+		}
+		in.place(sp, m.transform(), materials)
+	}
+
+	lights := (&Scene{Lights: s.Lights}).Triangles()
+	for i := range lights {
+		lights[i].Color[3] = -1
+	}
+	in.place(in.add(meshHierarchy{triangles: lights, bvh: builder.Build(lights)}), mgl32.Ident4(), -1)
+
+	in.buildTop()
+	return in
+}
+
+// NewInstanced returns a triangle soup, like objparser.GetTriangles
+// returns it, as one mesh with one instance. The triangles keep their own
+// colors, the slice is not changed.
+func NewInstanced(triangles []objparser.Triangle) *Instanced {
+	triangles = append([]objparser.Triangle{}, triangles...)
+	for i := range triangles {
+		triangles[i].Color[3] = -1
+	}
+	in := newInstanced()
+	in.place(in.add(meshHierarchy{triangles: triangles, bvh: builder.Build(triangles)}), mgl32.Ident4(), -1)
+	in.buildTop()
+	return in
+}
+
+// LoadInstanced reads the file name like Load and returns it the way the
+// compute shader traverses it as well. The mesh of a model file with an up
+// to date cache in l.CacheDir is not decoded: the scene has no models then,
+// only the warnings of the cached load, and the triangles and hierarchy of
+// Instanced point into the mapped cache file until Instanced.Close.
+func (l *Loader) LoadInstanced(name string) (*Scene, *Instanced, error) {
+	if s.ToLower(path.Ext(name)) != ".json" && l.Resolver == nil && l.CacheDir != "" {
+		if c := openCache(l.cacheName(filepath.ToSlash(name))); c != nil {
+			warnings, err := c.Warnings()
+			triangles, terr := c.Triangles()
+			h, herr := c.BVH()
+			if err == nil && terr == nil && herr == nil {
+				sc := New()
+				sc.warnings = warnings
+				in := newInstanced()
+				in.place(in.add(meshHierarchy{triangles: triangles, bvh: h}), mgl32.Ident4(), -1)
+				in.buildTop()
+				in.cache = c
+				return sc, in, nil
+			}
+			c.Close()
+		}
+	}
+	sc, err := l.Load(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	return sc, sc.Instanced(), nil
+}
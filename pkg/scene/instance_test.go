@@ -0,0 +1,45 @@
+package scene
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadInstancedCached(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	model := filepath.Join(dir, "model.obj")
+	writeFile(t, model, "mtllib model.mtl\nv 0 0 0\nv 1 0 0\nv 1 1 0\nv 0 1 0\nv 0 0 1\n"+
+		"usemtl red\nf 1 2 3 4\nusemtl blue\nf 1 2 5\nf 2 3 5\n")
+	writeFile(t, filepath.Join(dir, "model.mtl"), "newmtl red\nKd 1 0 0\nnewmtl blue\nKd 0 0 1\n")
+	l := Loader{CacheDir: filepath.Join(dir, "cache")}
+	if err := os.Mkdir(l.CacheDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	_, miss, err := l.LoadInstanced(model)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer miss.Close()
+	_, hit, err := l.LoadInstanced(model)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer hit.Close()
+	if hit.cache == nil {
+		t.Fatal("the second load did not use the cache")
+	}
+
+	if !reflect.DeepEqual(hit.Triangles, miss.Triangles) {
+		t.Errorf("got cached triangles %+v, want %+v", hit.Triangles, miss.Triangles)
+	}
+	if !reflect.DeepEqual(hit.Instances, miss.Instances) || hit.Root != miss.Root {
+		t.Errorf("got cached instances %+v with root %d, want %+v with root %d", hit.Instances, hit.Root, miss.Instances, miss.Root)
+	}
+	if !reflect.DeepEqual(hit.BVH, miss.BVH) || !reflect.DeepEqual(hit.Materials, miss.Materials) {
+		t.Errorf("got cached hierarchy %+v and materials %+v, want %+v and %+v", hit.BVH, hit.Materials, miss.BVH, miss.Materials)
+	}
+}
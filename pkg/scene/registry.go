@@ -0,0 +1,213 @@
+package scene
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"path"
+	"path/filepath"
+	s "strings"
+	"sync"
+
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/supermuesli/computeshader/pkg/gltf"
+	"github.com/supermuesli/computeshader/pkg/objparser"
+	"github.com/supermuesli/computeshader/pkg/ply"
+	"github.com/supermuesli/computeshader/pkg/stl"
+)
+
+var (
+	ErrUnknownFormat = errors.New("unknown model format")
+	ErrCamera        = errors.New("invalid camera")
+)
+
+// Options are handed to the Parse function of a Format, formats ignore the
+// ones they have no use for
+type Options struct {
+	Resolver     objparser.Resolver
+	Lenient      bool
+	LoadTextures bool
+}
+
+// Format is a model file format the Loader can read
+type Format struct {
+	Name string
+	// lower case file extensions including the dot, e.g. ".obj"
+	Extensions []string
+	// prefixes of the file content that identify the format, they are
+	// checked before the extensions
+	Magic []string
+	// Parse reads a model from in, name is the Resolver name of the file
+	Parse func(in io.Reader, name string, opts Options) (*objparser.Mesh, error)
+}
+
+var (
+	formatsMu sync.RWMutex
+	formats   []Format
+)
+
+// Register adds a format to the registry. Formats registered later win
+// over earlier ones with the same magic or extension.
+func Register(f Format) {
+	formatsMu.Lock()
+	defer formatsMu.Unlock()
+	formats = append(formats, f)
+}
+
+// Formats returns the registered formats in the order they were registered
+func Formats() []Format {
+	formatsMu.RLock()
+	defer formatsMu.RUnlock()
+	return append([]Format(nil), formats...)
+}
+
+func init() {
+	Register(Format{
+		Name:       "obj",
+		Extensions: []string{".obj"},
+		Parse: func(in io.Reader, name string, opts Options) (*objparser.Mesh, error) {
+			l := objparser.Loader{Resolver: opts.Resolver, Lenient: opts.Lenient, LoadTextures: opts.LoadTextures}
+			return l.Parse(in, name)
+		},
+	})
+	Register(Format{
+		Name:       "gltf",
+		Extensions: []string{".gltf", ".glb"},
+		Magic:      []string{"glTF"},
+		Parse: func(in io.Reader, name string, opts Options) (*objparser.Mesh, error) {
+			l := gltf.Loader{Resolver: opts.Resolver, Lenient: opts.Lenient, LoadTextures: opts.LoadTextures}
+			return l.Parse(in, name)
+		},
+	})
+	Register(Format{
+		Name:       "ply",
+		Extensions: []string{".ply"},
+		Magic:      []string{"ply\n", "ply\r\n"},
+		Parse: func(in io.Reader, name string, opts Options) (*objparser.Mesh, error) {
+			l := ply.Loader{Resolver: opts.Resolver}
+			return l.Parse(in, name)
+		},
+	})
+	Register(Format{
+		Name:       "stl",
+		Extensions: []string{".stl"},
+		Parse: func(in io.Reader, name string, opts Options) (*objparser.Mesh, error) {
+			l := stl.Loader{Resolver: opts.Resolver}
+			return l.Parse(in, name)
+		},
+	})
+}
+
+// the longest magic of the built in formats is well below this
+const sniffLen = 64
+
+// detect returns the format of the file name that starts with head
+func detect(name string, head []byte) (Format, bool) {
+	fs := Formats()
+	for i := len(fs) - 1; i >= 0; i-- {
+		for _, magic := range fs[i].Magic {
+			if bytes.HasPrefix(head, []byte(magic)) {
+				return fs[i], true
+			}
+		}
+	}
+	ext := s.ToLower(path.Ext(name))
+	for i := len(fs) - 1; i >= 0; i-- {
+		for _, e := range fs[i].Extensions {
+			if e == ext {
+				return fs[i], true
+			}
+		}
+	}
+	return Format{}, false
+}
+
+// Loader configures how model files are loaded. The zero value is ready to use.
+type Loader struct {
+	// Lenient and LoadTextures are passed on to the formats that support them
+	Lenient      bool
+	LoadTextures bool
+	// Resolver opens the model files and everything they refer to, like
+	// objparser.Loader.Resolver. Files are read from disk if it is nil.
+	Resolver objparser.Resolver
+	// CacheDir is a directory for scene caches of the loaded models, see
+	// package cache. Caching is off if it is empty or Resolver is set.
+	CacheDir string
+}
+
+// Load reads the scene description or model file at path with the
+// default Loader
+func Load(path string) (*Scene, error) {
+	var l Loader
+	return l.Load(path)
+}
+
+// Load reads the file name, which is a path on disk or a name for
+// l.Resolver. Files ending in .json are scene descriptions, see
+// LoadDescription, everything else is a model file that makes up a scene
+// with the default camera and settings on its own. The format of a model
+// file is detected from its content and its extension.
+func (l *Loader) Load(name string) (*Scene, error) {
+	if s.ToLower(path.Ext(name)) == ".json" {
+		return l.LoadDescription(name)
+	}
+	sc := New()
+	mesh, err := l.loadMesh(sc, name)
+	if err != nil {
+		return nil, err
+	}
+	sc.Models = []Model{{Name: name, Mesh: mesh, Transform: mgl32.Ident4()}}
+	return sc, nil
+}
+
+// LoadMesh reads the model file name like Load but returns its mesh
+func (l *Loader) LoadMesh(name string) (*objparser.Mesh, error) {
+	return l.loadMesh(nil, name)
+}
+
+// loadMesh is LoadMesh, the hierarchy of a cached mesh is kept in sc if it
+// is not nil
+func (l *Loader) loadMesh(sc *Scene, name string) (*objparser.Mesh, error) {
+	if l.Resolver == nil && l.CacheDir != "" {
+		mesh, h, err := l.loadCached(filepath.ToSlash(name))
+		if err != nil {
+			return nil, err
+		}
+		if sc != nil {
+			if sc.hierarchies == nil {
+				sc.hierarchies = map[*objparser.Mesh]meshHierarchy{}
+			}
+			sc.hierarchies[mesh] = h
+		}
+		return mesh, nil
+	}
+	res := l.Resolver
+	if res == nil {
+		res = objparser.DiskResolver
+		name = filepath.ToSlash(name)
+	}
+	return l.parse(res, name)
+}
+
+// parse detects the format of the file name and reads it
+func (l *Loader) parse(res objparser.Resolver, name string) (*objparser.Mesh, error) {
+	file, err := res.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, err
+	}
+	head = head[:n]
+
+	format, ok := detect(name, head)
+	if !ok {
+		return nil, &objparser.ParseError{File: name, Err: ErrUnknownFormat}
+	}
+	in := io.MultiReader(bytes.NewReader(head), file)
+	return format.Parse(in, name, Options{Resolver: res, Lenient: l.Lenient, LoadTextures: l.LoadTextures})
+}
@@ -0,0 +1,59 @@
+package scene
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/supermuesli/computeshader/pkg/objparser"
+)
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name, head string
+		want       string
+	}{
+		{"model.ply", "ply\nformat ascii 1.0\n", "ply"},
+		// the magic wins over the extension
+		{"model.obj", "ply\r\nformat ascii 1.0\n", "ply"},
+		{"model.stl", "glTF\x02\x00\x00\x00", "gltf"},
+		{"MODEL.OBJ", "v 0 0 0\n", "obj"},
+		// stl has no magic, ascii files start with solid and binary ones
+		// with anything
+		{"model.stl", "solid part\n", "stl"},
+		{"model.gltf", "{\"asset\": {}}", "gltf"},
+		{"model.txt", "v 0 0 0\n", ""},
+		{"model", "", ""},
+	}
+	for _, tt := range tests {
+		f, ok := detect(tt.name, []byte(tt.head))
+		if f.Name != tt.want || ok != (tt.want != "") {
+			t.Errorf("%s %q: got %q, %t, want %q", tt.name, tt.head, f.Name, ok, tt.want)
+		}
+	}
+}
+
+func TestLoadMismatchedExtension(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+
+	// a ply file the obj parser would reject
+	model := filepath.Join(dir, "triangle.obj")
+	writeFile(t, model, "ply\nformat ascii 1.0\nelement vertex 3\nproperty float x\nproperty float y\nproperty float z\n"+
+		"element face 1\nproperty list uchar int vertex_indices\nend_header\n0 0 0\n1 0 0\n0 1 0\n3 0 1 2\n")
+	var l Loader
+	sc, err := l.Load(model)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := sc.Models[0].Mesh.TriangleCount(); n != 1 {
+		t.Errorf("got %d triangles, want 1", n)
+	}
+
+	unknown := filepath.Join(dir, "triangle.txt")
+	writeFile(t, unknown, "v 0 0 0\n")
+	var perr *objparser.ParseError
+	if _, err := l.Load(unknown); !errors.Is(err, ErrUnknownFormat) || !errors.As(err, &perr) || perr.File != filepath.ToSlash(unknown) {
+		t.Errorf("got %v, want %v for %s", err, ErrUnknownFormat, unknown)
+	}
+}
@@ -0,0 +1,167 @@
+// Package scene loads the models the renderer draws, in any of the
+// registered file formats, either one model file on its own or several of
+// them placed by a scene description file.
+package scene
+
+import (
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/supermuesli/computeshader/pkg/objparser"
+)
+
+// Scene is everything the renderer draws
+type Scene struct {
+	Models   []Model
+	Lights   []Light
+	Camera   Camera
+	Settings Settings
+
+	// problems of the scene description itself, or of the cached model of
+	// LoadInstanced
+	warnings []*objparser.ParseError
+	// the hierarchies of the meshes that came from a cache
+	hierarchies map[*objparser.Mesh]meshHierarchy
+}
+
+// New returns an empty scene with the default camera and settings
+func New() *Scene {
+	return &Scene{Camera: DefaultCamera, Settings: DefaultSettings}
+}
+
+// Model is the mesh of one model file placed in the scene
+type Model struct {
+	// the file the model was loaded from
+	Name string
+	Mesh *objparser.Mesh
+	// Transform maps the mesh into the scene, the zero value is taken as
+	// the identity
+	Transform mgl32.Mat4
+	// Materials replace the materials of Mesh if they are not nil, so that
+	// models with other materials can still share the mesh
+	Materials []objparser.Material
+}
+
+func (m *Model) transform() mgl32.Mat4 {
+	if m.Transform == (mgl32.Mat4{}) {
+		return mgl32.Ident4()
+	}
+	return m.Transform
+}
+
+// mesh returns Mesh with Materials applied
+func (m *Model) mesh() *objparser.Mesh {
+	if m.Materials == nil {
+		return m.Mesh
+	}
+	mesh := *m.Mesh
+	mesh.Materials = m.Materials
+	return &mesh
+}
+
+// Light is an emissive parallelogram spanned by U and V from Position
+type Light struct {
+	Position mgl32.Vec3
+	U, V     mgl32.Vec3
+	Emission mgl32.Vec3
+}
+
+// Camera is where the renderer starts to look from
+type Camera struct {
+	Position mgl32.Vec3
+	// Direction is where the camera looks with the cursor in the center
+	// of the window, the cursor turns it from there
+	Direction mgl32.Vec3
+	// FOV is the vertical field of view in degrees
+	FOV float32
+	// Speed is how far one key press moves the camera
+	Speed float32
+}
+
+// LookDirection returns Direction normalized, the one of DefaultCamera if
+// it is zero
+func (c *Camera) LookDirection() mgl32.Vec3 {
+	if c.Direction.Len() == 0 {
+		return DefaultCamera.Direction
+	}
+	return c.Direction.Normalize()
+}
+
+// FieldOfView returns FOV in radians, the one of DefaultCamera if it is 0
+func (c *Camera) FieldOfView() float32 {
+	if c.FOV <= 0 {
+		return mgl32.DegToRad(DefaultCamera.FOV)
+	}
+	return mgl32.DegToRad(c.FOV)
+}
+
+// Settings are the render settings
+type Settings struct {
+	// size of the window in pixels
+	Width, Height int
+	// Hops is the number of bounces of every path
+	Hops int
+}
+
+var (
+	DefaultCamera = Camera{
+		Position:  mgl32.Vec3{0, 300, 950},
+		Direction: mgl32.Vec3{0, 0, -1},
+		// the image plane is as far away as the window is high
+		FOV:   2 * 26.565051,
+		Speed: 50,
+	}
+	DefaultSettings = Settings{Width: 800, Height: 600, Hops: 3}
+)
+
+// Triangles returns the triangles of all models and lights in one
+// triangle soup, with the model transforms applied
+func (s *Scene) Triangles() []objparser.Triangle {
+	triangles := []objparser.Triangle{}
+	for _, m := range s.Models {
+		start := len(triangles)
+		triangles = append(triangles, m.mesh().Triangles()...)
+		tr := m.transform()
+		if tr == mgl32.Ident4() {
+			continue
+		}
+		for i := range triangles[start:] {
+			t := &triangles[start+i]
+			t.A, t.B, t.C = transform(tr, t.A), transform(tr, t.B), transform(tr, t.C)
+		}
+	}
+
+	for _, l := range s.Lights {
+		a, b, c, d := l.Position, l.Position.Add(l.U), l.Position.Add(l.U).Add(l.V), l.Position.Add(l.V)
+		white := mgl32.Vec3{1, 1, 1}
+		for _, t := range [][3]mgl32.Vec3{{a, b, c}, {a, c, d}} {
+			triangles = append(triangles, objparser.Triangle{
+				A:         t[0].Vec4(-1337),
+				B:         t[1].Vec4(-1337),
+				C:         t[2].Vec4(-1337),
+				Color:     white.Vec4(-1337),
+				Intensity: l.Emission.Vec4(-1337),
+			})
+		}
+	}
+	return triangles
+}
+
+// transform applies m to the position p, keeping the padding in w
+func transform(m mgl32.Mat4, p mgl32.Vec4) mgl32.Vec4 {
+	return m.Mul4x1(p.Vec3().Vec4(1)).Vec3().Vec4(p[3])
+}
+
+// Warnings returns the problems that did not stop the loaders of all models
+func (s *Scene) Warnings() []*objparser.ParseError {
+	warnings := append([]*objparser.ParseError{}, s.warnings...)
+	seen := map[*objparser.ParseError]bool{}
+	for _, m := range s.Models {
+		// models can share a mesh or the warnings of one
+		for _, w := range m.Mesh.Warnings {
+			if !seen[w] {
+				warnings = append(warnings, w)
+				seen[w] = true
+			}
+		}
+	}
+	return warnings
+}
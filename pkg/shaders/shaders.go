@@ -31,6 +31,9 @@ const (
 
 	uniform int samples = 1;
 
+	// bounces of every path
+	uniform int hops = 3;
+
 	// texture to write to
 	layout(binding = 6, rgba32f) uniform image2D img_output;
 	
@@ -40,18 +43,59 @@ const (
 		vec3 b;
 		vec3 c;
 		vec3 color;
+		// index of the face material in the mesh, or -1. it fills the
+		// padding after color
+		float color_material;
 		vec3 intensity;
 	};
 
-	// triangles to render
+	// triangles of every mesh once, in mesh space
 	layout(std430, binding = 3) buffer model_ssbo
 	{
 		Triangle triangles[];
 	};
 
+	// a mesh placed in the scene
+	struct Instance
+	{
+		mat4 transform;
+		mat4 inverse;
+		// scene space bounds
+		vec4 lo;
+		vec4 hi;
+		// triangles of the mesh
+		int first;
+		int count;
+		// first material override, or -1
+		int materials;
+		// root of the hierarchy of the mesh
+		int root;
+	};
+
+	layout(std430, binding = 4) buffer instance_ssbo
+	{
+		Instance instances[];
+	};
+
+	struct Material
+	{
+		vec3 color;
+		vec3 intensity;
+	};
+
+	// material overrides of the instances
+	layout(std430, binding = 5) buffer material_ssbo
+	{
+		Material materials[];
+	};
+
 	// camera 
 	uniform vec3 cam_origin_uniform = vec3(0, 300, 950);
 	uniform vec2 cursor_pos;
+	// where the camera looks with the cursor in the center of the window
+	uniform vec3 cam_direction = vec3(0, 0, -1);
+	// vertical field of view in radians
+	uniform float cam_fov = 0.9272952;
 	
 	// minimum "distance" to prevent self-intersection
 	const float EPSILON = 0.0001;
@@ -94,6 +138,119 @@ const (
 		}
 	}
 
+	// slab test of the ray against the box lo, hi, closer than max_d
+	bool hitsBox(vec3 ray_origin, vec3 inv_dir, vec3 lo, vec3 hi, float max_d) {
+		vec3 t0 = (lo - ray_origin) * inv_dir;
+		vec3 t1 = (hi - ray_origin) * inv_dir;
+		vec3 tmin = min(t0, t1);
+		vec3 tmax = max(t0, t1);
+		float t_near = max(max(tmin.x, tmin.y), tmin.z);
+		float t_far = min(min(tmax.x, tmax.y), tmax.z);
+		return t_near <= t_far + EPSILON && t_far > 0 && t_near < max_d;
+	}
+
+	// bounding volume hierarchy node, see package bvh. the two children of an
+	// inner node are next to each other
+	struct Node
+	{
+		vec3 lo;
+		// left child of inner nodes, first index of leaves
+		int left_first;
+		vec3 hi;
+		// primitives of a leaf, 0 for inner nodes
+		int count;
+	};
+
+	// the hierarchies over the triangles of every mesh and the one over the
+	// instances
+	layout(std430, binding = 7) buffer bvh_ssbo
+	{
+		Node nodes[];
+	};
+
+	// primitives of the leaves, into triangles for the meshes and into
+	// instances for the instance hierarchy
+	layout(std430, binding = 8) buffer bvh_index_ssbo
+	{
+		int bvh_indices[];
+	};
+
+	// root of the instance hierarchy, -1 if the scene is empty
+	uniform int bvh_root = -1;
+
+	// bvh.MaxDepth+1, the builder keeps the hierarchies shallow enough that
+	// the stacks never overflow
+	const int BVH_STACK_SIZE = 64;
+
+	// finds the closest triangle of the mesh hierarchy at root that the ray
+	// hits closer than min_d. origin and dir are in mesh space, scaled like
+	// the scene
+	bool traverseMesh(vec3 origin, vec3 dir, float scale, int root, inout float min_d, inout int closest_tri) {
+		bool hit = false;
+		vec3 inv_dir = 1/dir;
+		int stack[BVH_STACK_SIZE];
+		int top = 0;
+		stack[top++] = root;
+		while (top > 0) {
+			Node node = nodes[stack[--top]];
+			if (!hitsBox(origin, inv_dir, scale*node.lo, scale*node.hi, min_d)) {
+				continue;
+			}
+			if (node.count == 0) {
+				stack[top++] = node.left_first + 1;
+				stack[top++] = node.left_first;
+				continue;
+			}
+			for (int k = node.left_first; k < node.left_first + node.count; k++) {
+				int i = bvh_indices[k];
+				float d;
+				if (intersects(origin, dir, scale*triangles[i].a, scale*triangles[i].b, scale*triangles[i].c, d) && d < min_d) {
+					min_d = d;
+					closest_tri = i;
+					hit = true;
+				}
+			}
+		}
+		return hit;
+	}
+
+	// finds the closest triangle of the scene that the ray hits closer than
+	// min_d, and the instance it belongs to
+	bool traverseScene(vec3 ray_origin, vec3 ray_dir, float scale, inout float min_d, inout int closest_tri, inout int closest_inst) {
+		if (bvh_root < 0) {
+			return false;
+		}
+		bool hit = false;
+		vec3 inv_dir = 1/ray_dir;
+		int stack[BVH_STACK_SIZE];
+		int top = 0;
+		stack[top++] = bvh_root;
+		while (top > 0) {
+			Node node = nodes[stack[--top]];
+			if (!hitsBox(ray_origin, inv_dir, scale*node.lo, scale*node.hi, min_d)) {
+				continue;
+			}
+			if (node.count == 0) {
+				stack[top++] = node.left_first + 1;
+				stack[top++] = node.left_first;
+				continue;
+			}
+			for (int k = node.left_first; k < node.left_first + node.count; k++) {
+				int j = bvh_indices[k];
+				// the ray in mesh space. the direction is not normalized, so
+				// d stays the distance in the scene
+				mat4 to_mesh = instances[j].inverse;
+				vec3 origin = scale*(to_mesh*vec4(ray_origin/scale, 1)).xyz;
+				vec3 dir = mat3(to_mesh)*ray_dir;
+				if (traverseMesh(origin, dir, scale, instances[j].root, min_d, closest_tri)) {
+					closest_inst = j;
+					hit = true;
+				}
+			}
+		}
+		return hit;
+	}
+
 	mat4 rotationMatrix(vec3 axis, float angle) {
 		axis = normalize(axis);
 		float s = sin(angle);
@@ -215,36 +372,34 @@ const (
 	vec3 trace(vec3 ray_origin, vec3 ray_dir, int hops) {
 		vec3 col = vec3(1);
 		vec3 inten = vec3(0);
-		bool left_the_scene = true;
 		for (int hop = 0; hop < hops; ++hop) {
 			float min_d = 999999.0;
-			float d = 999999.0;
-			int closest_tri;
-			vec3 normal;
-			for (int i = 0; i < triangles.length(); i++) {
-				vec3 v0 = (height/2)*one_unit*triangles[i].a;
-				vec3 v1 = (height/2)*one_unit*triangles[i].b;
-				vec3 v2 = (height/2)*one_unit*triangles[i].c;
-				if (intersects(ray_origin, ray_dir, v0, v1, v2, d)) {
-					left_the_scene = false;
-					if (d < min_d) {
-						min_d = d;
-						normal = normalize(cross(v1 - v0, v2 - v0));
-
-						// normal buffer
-						//col = vec3(normal + vec3(1))/2;
-
-						closest_tri = i;
-					}
-				}
+			int closest_tri = -1;
+			int closest_inst = -1;
+			float scale = (height/2)*one_unit;
+			if (!traverseScene(ray_origin, ray_dir, scale, min_d, closest_tri, closest_inst)) {
+				// the path left the scene
+				break;
 			}
 
-			if (left_the_scene) {
-				break;
+			// mesh space normal back to scene space
+			vec3 v0 = triangles[closest_tri].a;
+			vec3 normal = cross(triangles[closest_tri].b - v0, triangles[closest_tri].c - v0);
+			normal = normalize(transpose(mat3(instances[closest_inst].inverse))*normal);
+
+			// normal buffer
+			//col = vec3(normal + vec3(1))/2;
+
+			vec3 tri_col = triangles[closest_tri].color;
+			vec3 tri_inten = triangles[closest_tri].intensity;
+			int material = int(triangles[closest_tri].color_material);
+			if (instances[closest_inst].materials >= 0 && material >= 0) {
+				tri_col = materials[instances[closest_inst].materials + material].color;
+				tri_inten = materials[instances[closest_inst].materials + material].intensity;
 			}
 
-			inten = inten + triangles[closest_tri].intensity*abs(dot(ray_dir, normal));
-			col = col * triangles[closest_tri].color;
+			inten = inten + tri_inten*abs(dot(ray_dir, normal));
+			col = col * tri_col;
 			ray_origin = ray_origin + min_d*ray_dir;
 			float rand_1 = rand(ray_dir.z+samples);
 			float rand_2 = rand(ray_dir.y-samples);
@@ -265,12 +420,17 @@ const (
 		// rotate camera based on cursor position
 		vec3 cam_origin = cam_origin_uniform;
 
-		vec3 ray_dest = vec3(cam_origin.x - width/2 + pixel_coord.x, cam_origin.y - height/2 + pixel_coord.y, cam_origin.z - height);
+		vec3 ray_dest = vec3(cam_origin.x - width/2 + pixel_coord.x, cam_origin.y - height/2 + pixel_coord.y, cam_origin.z - height/2/tan(cam_fov/2));
 		vec3 ray_dir = normalize(ray_dest - cam_origin);
-		ray_dir = rotate(rotate(ray_dir, vec3(1,0,0), (2*cursor_pos.y/height) - 1), vec3(0,1,0), (2*cursor_pos.x/width) - 1);
+		// pitch and yaw of the camera direction, the cursor turns it further
+		vec3 look = normalize(cam_direction);
+		float pitch = -asin(look.y);
+		// atan is undefined for a camera looking straight up or down
+		float yaw = look.xz == vec2(0) ? 0.0 : atan(look.x, -look.z);
+		ray_dir = rotate(rotate(ray_dir, vec3(1,0,0), pitch + (2*cursor_pos.y/height) - 1), vec3(0,1,0), yaw + (2*cursor_pos.x/width) - 1);
 
 		// send camera ray
-		vec3 pixel = trace(cam_origin, ray_dir, 3) + imageLoad(img_output, pixel_coord).xyz * (samples-1); 
+		vec3 pixel = trace(cam_origin, ray_dir, hops) + imageLoad(img_output, pixel_coord).xyz * (samples-1); 
 		
 		// gamma correction
 		//pixel = vec3(pow(pixel.x, 1.22), pow(pixel.y, 1.22), pow(pixel.z, 1.22));
@@ -0,0 +1,12 @@
+package stl
+
+import (
+	"errors"
+)
+
+var (
+	ErrFormat    = errors.New("not an STL file")
+	ErrNumber    = errors.New("malformed number")
+	ErrArguments = errors.New("wrong number of arguments")
+	ErrSyntax    = errors.New("unexpected keyword")
+)
@@ -0,0 +1,238 @@
+// Package stl reads and writes STL files, ascii and binary, as objparser
+// meshes. Every facet gets vertices of its own so that facet normals
+// survive a round trip.
+package stl
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"strconv"
+	s "strings"
+
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/supermuesli/computeshader/pkg/objparser"
+)
+
+const (
+	headerSize = 80
+	facetSize  = 50
+)
+
+// Loader configures how STL files are read. The zero value is ready to use.
+type Loader struct {
+	// Resolver opens the STL file, like objparser.Loader.Resolver. Files
+	// are read from disk if it is nil.
+	Resolver objparser.Resolver
+}
+
+// Load reads the .stl file at path with the default Loader
+func Load(path string) (*objparser.Mesh, error) {
+	var l Loader
+	return l.Load(path)
+}
+
+// Load reads the .stl file name, which is a path on disk or a name for
+// l.Resolver
+func (l *Loader) Load(name string) (*objparser.Mesh, error) {
+	res := l.Resolver
+	if res == nil {
+		res = objparser.DiskResolver
+		name = filepath.ToSlash(name)
+	}
+
+	file, err := res.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return l.Parse(file, name)
+}
+
+// Parse reads an ascii or binary STL file from in, name is only used in
+// errors. All facets get a default material so that the part renders.
+func (l *Loader) Parse(in io.Reader, name string) (*objparser.Mesh, error) {
+	data, err := ioutil.ReadAll(in)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &builder{mesh: &objparser.Mesh{
+		Materials: []objparser.Material{objparser.NewMaterial("default")},
+	}}
+	if isBinary(data) {
+		b.binary(data)
+	} else if err := b.ascii(data, name); err != nil {
+		return nil, err
+	}
+	return b.mesh, nil
+}
+
+// isBinary tells the encodings apart by the size, binary files often start
+// with "solid" too
+func isBinary(data []byte) bool {
+	if len(data) < headerSize+4 {
+		return false
+	}
+	n := binary.LittleEndian.Uint32(data[headerSize:])
+	return uint64(len(data)) == headerSize+4+uint64(n)*facetSize
+}
+
+type builder struct {
+	mesh *objparser.Mesh
+}
+
+func (b *builder) binary(data []byte) {
+	le := binary.LittleEndian
+	n := int(le.Uint32(data[headerSize:]))
+	data = data[headerSize+4:]
+
+	float := func(i int) float32 {
+		return math.Float32frombits(le.Uint32(data[4*i:]))
+	}
+	vec := func(i int) mgl32.Vec3 {
+		return mgl32.Vec3{float(i), float(i + 1), float(i + 2)}
+	}
+
+	b.startObject("")
+	corners := make([]mgl32.Vec3, 3)
+	for i := 0; i < n; i++ {
+		normal := vec(0)
+		corners[0], corners[1], corners[2] = vec(3), vec(6), vec(9)
+		b.facet(normal, corners)
+		// the trailing attribute byte count is not used for color
+		data = data[facetSize:]
+	}
+}
+
+// ascii reads "solid", "facet normal", "outer loop", "vertex", "endloop",
+// "endfacet" and "endsolid" lines
+func (b *builder) ascii(data []byte, name string) error {
+	const (
+		outside = iota
+		inSolid
+		inFacet
+		inLoop
+		afterLoop
+	)
+	state := outside
+	line := 0
+	var normal mgl32.Vec3
+	var corners []mgl32.Vec3
+
+	errorAt := func(tok string, err error) error {
+		return &objparser.ParseError{File: name, Line: line, Token: tok, Err: err}
+	}
+	vec := func(f []string) (mgl32.Vec3, error) {
+		var v mgl32.Vec3
+		if len(f) != 3 {
+			return v, errorAt("", ErrArguments)
+		}
+		for i := range v {
+			x, err := strconv.ParseFloat(f[i], 32)
+			if err != nil {
+				return v, errorAt(f[i], ErrNumber)
+			}
+			v[i] = float32(x)
+		}
+		return v, nil
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line++
+		f := s.Fields(scanner.Text())
+		if len(f) == 0 {
+			continue
+		}
+
+		var err error
+		switch {
+		case f[0] == "solid" && state == outside:
+			b.startObject(s.Join(f[1:], " "))
+			state = inSolid
+		case f[0] == "facet" && state == inSolid:
+			if len(f) < 2 || f[1] != "normal" {
+				return errorAt(f[0], ErrSyntax)
+			}
+			normal, err = vec(f[2:])
+			corners = corners[:0]
+			state = inFacet
+		case f[0] == "outer" && state == inFacet:
+			state = inLoop
+		case f[0] == "vertex" && state == inLoop:
+			var v mgl32.Vec3
+			v, err = vec(f[1:])
+			corners = append(corners, v)
+		case f[0] == "endloop" && state == inLoop:
+			if len(corners) < 3 {
+				return errorAt(f[0], ErrArguments)
+			}
+			state = afterLoop
+		case f[0] == "endfacet" && state == afterLoop:
+			b.facet(normal, corners)
+			state = inSolid
+		case f[0] == "endsolid" && state == inSolid:
+			state = outside
+		default:
+			if line == 1 {
+				return errorAt(f[0], ErrFormat)
+			}
+			return errorAt(f[0], ErrSyntax)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if state != outside {
+		return errorAt("", io.ErrUnexpectedEOF)
+	}
+	// empty and blank files have no solid line to tell what they are
+	if len(b.mesh.Objects) == 0 {
+		return &objparser.ParseError{File: name, Err: ErrFormat}
+	}
+	return nil
+}
+
+func (b *builder) startObject(name string) {
+	b.mesh.Objects = append(b.mesh.Objects, objparser.Object{
+		Name:   name,
+		Groups: []objparser.Group{{Names: []string{"default"}, Start: b.mesh.TriangleCount()}},
+	})
+}
+
+// facet adds the polygon corners as a fan of triangles. Facets with a zero
+// normal get the normal of their first triangle, which counts as synthesized.
+func (b *builder) facet(normal mgl32.Vec3, corners []mgl32.Vec3) {
+	flags := objparser.HasNormals
+	if normal.Len() == 0 || math.IsNaN(float64(normal.Len())) {
+		normal = corners[1].Sub(corners[0]).Cross(corners[2].Sub(corners[0]))
+		flags = 0
+	}
+	// normals that are already unit length are kept bit for bit
+	if l := normal.Len(); l > 0 && math.Abs(float64(l)-1) > 1e-6 {
+		normal = normal.Mul(1 / l)
+	}
+
+	m := b.mesh
+	base := uint32(len(m.Vertices))
+	for _, c := range corners {
+		m.Vertices = append(m.Vertices, objparser.Vertex{Position: c, Normal: normal, Flags: flags})
+	}
+	for i := 2; i < len(corners); i++ {
+		m.Indices = append(m.Indices, base, base+uint32(i-1), base+uint32(i))
+		m.FaceMaterials = append(m.FaceMaterials, 0)
+		m.FaceSmoothing = append(m.FaceSmoothing, 0)
+	}
+
+	groups := m.Objects[len(m.Objects)-1].Groups
+	groups[0].Count += len(corners) - 2
+}
@@ -0,0 +1,198 @@
+package stl
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/supermuesli/computeshader/pkg/objparser"
+)
+
+func parse(t *testing.T, data []byte) *objparser.Mesh {
+	t.Helper()
+	var l Loader
+	m, err := l.Parse(bytes.NewReader(data), "test.stl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+// binarySTL returns a binary file with header and one facet per entry of
+// facets, a normal followed by three corners
+func binarySTL(header string, facets [][4]mgl32.Vec3) []byte {
+	var buf bytes.Buffer
+	h := make([]byte, headerSize)
+	copy(h, header)
+	buf.Write(h)
+	binary.Write(&buf, binary.LittleEndian, uint32(len(facets)))
+	for _, f := range facets {
+		binary.Write(&buf, binary.LittleEndian, f)
+		binary.Write(&buf, binary.LittleEndian, uint16(0))
+	}
+	return buf.Bytes()
+}
+
+// corners returns the positions of the corners of all triangles
+func corners(m *objparser.Mesh) []mgl32.Vec3 {
+	out := []mgl32.Vec3{}
+	for _, idx := range m.Indices {
+		out = append(out, m.Vertices[idx].Position)
+	}
+	return out
+}
+
+const asciiPart = `solid my part
+  facet normal 0 0 1
+    outer loop
+      vertex 0 0 0
+      vertex 1 0 0
+      vertex 0 1 0
+    endloop
+  endfacet
+  facet normal 0 0 -2
+    outer loop
+      vertex 0 0 1
+      vertex 0 1 1
+      vertex 1 1 1
+      vertex 1 0 1
+    endloop
+  endfacet
+  facet normal 0 0 0
+    outer loop
+      vertex 0 0 2
+      vertex 0 2 2
+      vertex 2 0 2
+    endloop
+  endfacet
+endsolid my part
+`
+
+func TestASCII(t *testing.T) {
+	m := parse(t, []byte(asciiPart))
+
+	want := []mgl32.Vec3{
+		{0, 0, 0}, {1, 0, 0}, {0, 1, 0},
+		// the quad is a fan
+		{0, 0, 1}, {0, 1, 1}, {1, 1, 1}, {0, 0, 1}, {1, 1, 1}, {1, 0, 1},
+		{0, 0, 2}, {0, 2, 2}, {2, 0, 2},
+	}
+	if got := corners(m); !reflect.DeepEqual(got, want) {
+		t.Errorf("got corners %v, want %v", got, want)
+	}
+	normals := []struct {
+		normal mgl32.Vec3
+		flags  objparser.AttributeFlags
+	}{
+		{mgl32.Vec3{0, 0, 1}, objparser.HasNormals},
+		// normalized
+		{mgl32.Vec3{0, 0, -1}, objparser.HasNormals},
+		// a zero normal is computed from the corners
+		{mgl32.Vec3{0, 0, -1}, 0},
+	}
+	for i, n := range normals {
+		// the first corner of every facet
+		v := m.Vertices[[]int{0, 3, 7}[i]]
+		if v.Normal != n.normal || v.Flags != n.flags {
+			t.Errorf("facet %d: got normal %v with flags %d, want %v with %d", i, v.Normal, v.Flags, n.normal, n.flags)
+		}
+	}
+
+	wantObjects := []objparser.Object{{Name: "my part", Groups: []objparser.Group{{Names: []string{"default"}, Start: 0, Count: 4}}}}
+	if !reflect.DeepEqual(m.Objects, wantObjects) {
+		t.Errorf("got objects %+v, want %+v", m.Objects, wantObjects)
+	}
+	if !reflect.DeepEqual(m.FaceMaterials, []int32{0, 0, 0, 0}) || len(m.Materials) != 1 {
+		t.Errorf("got face materials %v of %d materials, want the default one", m.FaceMaterials, len(m.Materials))
+	}
+}
+
+func TestBinary(t *testing.T) {
+	// a normal that is not exactly unit length in float32 is kept bit for bit
+	n := mgl32.Vec3{0.6, 0.8, 0}
+	facets := [][4]mgl32.Vec3{
+		{n, {0, 0, 0}, {1, 0, 0}, {0, 1, 0}},
+		{{}, {0, 0, 1}, {0, 1, 1}, {1, 0, 1}},
+	}
+	// binary files are told apart by their size, a header starting with
+	// solid does not make them ascii
+	for _, header := range []string{"binary", "solid header"} {
+		m := parse(t, binarySTL(header, facets))
+
+		want := []mgl32.Vec3{{0, 0, 0}, {1, 0, 0}, {0, 1, 0}, {0, 0, 1}, {0, 1, 1}, {1, 0, 1}}
+		if got := corners(m); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got corners %v, want %v", header, got, want)
+		}
+		if v := m.Vertices[0]; v.Normal != n || v.Flags != objparser.HasNormals {
+			t.Errorf("%s: got normal %v with flags %d, want %v from the file", header, v.Normal, v.Flags, n)
+		}
+		if v := m.Vertices[3]; v.Normal != (mgl32.Vec3{0, 0, -1}) || v.Flags != 0 {
+			t.Errorf("%s: got normal %v with flags %d, want a computed 0 0 -1", header, v.Normal, v.Flags)
+		}
+	}
+}
+
+func TestErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want error
+		line int
+	}{
+		{"empty", "", ErrFormat, 0},
+		{"blank", " \n\t\r\n\n", ErrFormat, 0},
+		{"not stl", "ply\nformat ascii 1.0\n", ErrFormat, 1},
+		{"facet outside", "solid\nendsolid\nfacet normal 0 0 1\n", ErrSyntax, 3},
+		{"number", "solid\nfacet normal 0 x 1\n", ErrNumber, 2},
+		{"vertex", "solid\nfacet normal 0 0 1\nouter loop\nvertex 0 0\n", ErrArguments, 4},
+		{"two corners", "solid\nfacet normal 0 0 1\nouter loop\nvertex 0 0 0\nvertex 1 0 0\nendloop\n", ErrArguments, 6},
+		{"unfinished", "solid\nfacet normal 0 0 1\n", io.ErrUnexpectedEOF, 2},
+		// too short for its facet count
+		{"truncated binary", string(binarySTL("solid", [][4]mgl32.Vec3{{}})[:headerSize+4+facetSize-1]), ErrFormat, 1},
+	}
+	for _, tt := range tests {
+		var l Loader
+		_, err := l.Parse(strings.NewReader(tt.data), "test.stl")
+		var perr *objparser.ParseError
+		if !errors.Is(err, tt.want) || !errors.As(err, &perr) || perr.Line != tt.line {
+			t.Errorf("%s: got %v, want %v on line %d", tt.name, err, tt.want, tt.line)
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	m := parse(t, []byte(asciiPart))
+	for _, format := range []string{"binary", "ascii"} {
+		var buf bytes.Buffer
+		var err error
+		if format == "binary" {
+			err = Write(&buf, m)
+		} else {
+			err = WriteASCII(&buf, m, "my part")
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := parse(t, buf.Bytes())
+
+		// every triangle is a facet of its own now, with the normals of
+		// the facets it came from
+		if !reflect.DeepEqual(corners(got), corners(m)) {
+			t.Errorf("%s: got corners %v, want %v", format, corners(got), corners(m))
+		}
+		for i, idx := range got.Indices {
+			gn, wn := got.Vertices[idx].Normal, m.Vertices[m.Indices[i]].Normal
+			if gn != wn {
+				t.Errorf("%s: corner %d has normal %v, want %v", format, i, gn, wn)
+			}
+		}
+		if format == "ascii" && got.Objects[0].Name != "my part" {
+			t.Errorf("got solid %q, want my part", got.Objects[0].Name)
+		}
+	}
+}
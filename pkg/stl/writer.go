@@ -0,0 +1,97 @@
+package stl
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/supermuesli/computeshader/pkg/objparser"
+)
+
+// Save writes m to the binary .stl file at name
+func Save(name string, m *objparser.Mesh) error {
+	file, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if err := Write(file, m); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// Write writes the triangles of m as a binary STL file. STL has no
+// materials, uvs or structure, only positions and facet normals are kept.
+func Write(w io.Writer, m *objparser.Mesh) error {
+	bw := bufio.NewWriter(w)
+	var header [headerSize + 4]byte
+	copy(header[:], "binary STL")
+	binary.LittleEndian.PutUint32(header[headerSize:], uint32(m.TriangleCount()))
+	if _, err := bw.Write(header[:]); err != nil {
+		return err
+	}
+
+	var facet [facetSize]byte
+	for t := 0; t < m.TriangleCount(); t++ {
+		n, a, b, c := facetOf(m, t)
+		for i, v := range []mgl32.Vec3{n, a, b, c} {
+			for j := range v {
+				binary.LittleEndian.PutUint32(facet[12*i+4*j:], math.Float32bits(v[j]))
+			}
+		}
+		if _, err := bw.Write(facet[:]); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// WriteASCII writes the triangles of m as one ascii solid called name
+func WriteASCII(w io.Writer, m *objparser.Mesh, name string) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "solid %s\n", name)
+	for t := 0; t < m.TriangleCount(); t++ {
+		n, a, b, c := facetOf(m, t)
+		fmt.Fprintf(bw, "facet normal %s\n", formatVec(n))
+		fmt.Fprintf(bw, "outer loop\n")
+		for _, v := range []mgl32.Vec3{a, b, c} {
+			fmt.Fprintf(bw, "vertex %s\n", formatVec(v))
+		}
+		fmt.Fprintf(bw, "endloop\n")
+		fmt.Fprintf(bw, "endfacet\n")
+	}
+	if _, err := fmt.Fprintf(bw, "endsolid %s\n", name); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// facetOf returns the normal and corners of triangle t. The normal is the
+// one of the corners if they agree, as for facets read from STL files, and
+// the geometric normal otherwise.
+func facetOf(m *objparser.Mesh, t int) (n, a, b, c mgl32.Vec3) {
+	va, vb, vc := &m.Vertices[m.Indices[3*t]], &m.Vertices[m.Indices[3*t+1]], &m.Vertices[m.Indices[3*t+2]]
+	a, b, c = va.Position, vb.Position, vc.Position
+	if va.Flags&vb.Flags&vc.Flags&objparser.HasNormals != 0 && va.Normal == vb.Normal && vb.Normal == vc.Normal {
+		return va.Normal, a, b, c
+	}
+	n = b.Sub(a).Cross(c.Sub(a))
+	if l := n.Len(); l > 0 {
+		n = n.Mul(1 / l)
+	}
+	return n, a, b, c
+}
+
+// formatVec returns the shortest text that parses back to v
+func formatVec(v mgl32.Vec3) string {
+	f := func(x float32) string {
+		return strconv.FormatFloat(float64(x), 'g', -1, 32)
+	}
+	return f(v[0]) + " " + f(v[1]) + " " + f(v[2])
+}
@@ -0,0 +1,64 @@
+package tracer
+
+import (
+	"image"
+	"image/color"
+	"math"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// Image is a float image laid out like the texture of the shader: rows
+// from the bottom up. As an image.Image it is clamped to [0, 1] and the
+// right way up.
+type Image struct {
+	Width, Height int
+	Pix           []mgl32.Vec3
+}
+
+func NewImage(width, height int) *Image {
+	return &Image{Width: width, Height: height, Pix: make([]mgl32.Vec3, width*height)}
+}
+
+func (m *Image) ColorModel() color.Model {
+	return color.RGBA64Model
+}
+
+func (m *Image) Bounds() image.Rectangle {
+	return image.Rect(0, 0, m.Width, m.Height)
+}
+
+func (m *Image) At(x, y int) color.Color {
+	if x < 0 || y < 0 || x >= m.Width || y >= m.Height {
+		return color.RGBA64{}
+	}
+	p := m.Pix[(m.Height-1-y)*m.Width+x]
+	return color.RGBA64{R: channel(p[0]), G: channel(p[1]), B: channel(p[2]), A: 0xffff}
+}
+
+func channel(f float32) uint16 {
+	if !(f > 0) {
+		return 0
+	}
+	if f >= 1 {
+		return 0xffff
+	}
+	return uint16(f*0xffff + 0.5)
+}
+
+// Diff is the root mean square difference of the channels of m and o, for
+// comparing renders. Images of different sizes differ infinitely.
+func (m *Image) Diff(o *Image) float64 {
+	if m.Width != o.Width || m.Height != o.Height {
+		return math.Inf(1)
+	}
+	if len(m.Pix) == 0 {
+		return 0
+	}
+	sum := 0.0
+	for i, p := range m.Pix {
+		d := p.Sub(o.Pix[i])
+		sum += float64(d.Dot(d))
+	}
+	return math.Sqrt(sum / float64(3*len(m.Pix)))
+}
@@ -0,0 +1,138 @@
+package tracer
+
+import (
+	"math"
+
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/supermuesli/computeshader/pkg/accel"
+	"github.com/supermuesli/computeshader/pkg/scene"
+)
+
+// the max distance of the hops of the shader
+const maxDistance = 999999.0
+
+type tracer struct {
+	// scaled like the shader scales it
+	scene *scene.Instanced
+	hops  int
+}
+
+// intersect is traverseScene of the compute shader, it returns the closest
+// triangle the ray hits, the instance it belongs to and the distance
+func (t *tracer) intersect(origin, dir mgl32.Vec3) (tri, inst int32, d float32, ok bool) {
+	in := t.scene
+	if in.Root < 0 {
+		return 0, 0, 0, false
+	}
+	r := accel.Ray{Origin: origin, Dir: dir}
+	d = in.BVH.Traverse(r, maxDistance, in.Root, func(j int32, max float32) (float32, bool) {
+		// the ray in mesh space. the direction is not normalized, so the
+		// distances stay the ones in the scene
+		toMesh := in.Instances[j].Inverse
+		mr := accel.Ray{Origin: toMesh.Mul4x1(origin.Vec4(1)).Vec3(), Dir: toMesh.Mat3().Mul3x1(dir)}
+		found := false
+		max = in.BVH.Traverse(mr, max, in.Instances[j].Root, func(i int32, max float32) (float32, bool) {
+			d, hit := accel.IntersectTriangle(mr, &in.Triangles[i])
+			if !hit || d >= max {
+				return 0, false
+			}
+			tri, found = i, true
+			return d, true
+		})
+		if found {
+			inst, ok = j, true
+		}
+		return max, found
+	})
+	return tri, inst, d, ok
+}
+
+// trace is trace of the compute shader, sample is its samples uniform
+func (t *tracer) trace(origin, dir mgl32.Vec3, sample int) mgl32.Vec3 {
+	col := mgl32.Vec3{1, 1, 1}
+	var inten mgl32.Vec3
+	for hop := 0; hop < t.hops; hop++ {
+		i, j, d, ok := t.intersect(origin, dir)
+		if !ok {
+			// the path left the scene
+			break
+		}
+
+		// mesh space normal back to scene space
+		tri, inst := &t.scene.Triangles[i], &t.scene.Instances[j]
+		v0 := tri.A.Vec3()
+		normal := tri.B.Vec3().Sub(v0).Cross(tri.C.Vec3().Sub(v0))
+		normal = inst.Inverse.Mat3().Transpose().Mul3x1(normal).Normalize()
+
+		triCol, triInten := tri.Color.Vec3(), tri.Intensity.Vec3()
+		if material := int32(tri.Color[3]); inst.Materials >= 0 && material >= 0 {
+			triCol = t.scene.Materials[inst.Materials+material].Color.Vec3()
+			triInten = t.scene.Materials[inst.Materials+material].Intensity.Vec3()
+		}
+
+		inten = inten.Add(triInten.Mul(abs(dir.Dot(normal))))
+		col = mul(col, triCol)
+		origin = origin.Add(dir.Mul(d))
+		s := float32(sample)
+		rand1, rand2, rand3 := random(dir[2]+s), random(dir[1]-s), random(dir[0]*s)
+		dir = rotateRandom(normal, rand1, rand2, rand3).Normalize()
+
+		// account for self intersection
+		origin = origin.Add(dir.Mul(0.001))
+	}
+	return mul(col, inten).Mul(5)
+}
+
+func mul(a, b mgl32.Vec3) mgl32.Vec3 {
+	return mgl32.Vec3{a[0] * b[0], a[1] * b[1], a[2] * b[2]}
+}
+
+func abs(f float32) float32 {
+	return float32(math.Abs(float64(f)))
+}
+
+// rotationMatrix is rotationMatrix of the shader, the glsl constructor
+// fills the matrix column by column like mgl32
+func rotationMatrix(axis mgl32.Vec3, angle float32) mgl32.Mat4 {
+	axis = axis.Normalize()
+	s := float32(math.Sin(float64(angle)))
+	c := float32(math.Cos(float64(angle)))
+	oc := 1 - c
+	x, y, z := axis[0], axis[1], axis[2]
+	return mgl32.Mat4{
+		oc*x*x + c, oc*x*y - z*s, oc*z*x + y*s, 0,
+		oc*x*y + z*s, oc*y*y + c, oc*y*z - x*s, 0,
+		oc*z*x - y*s, oc*y*z + x*s, oc*z*z + c, 0,
+		0, 0, 0, 1,
+	}
+}
+
+func rotate(v, axis mgl32.Vec3, angle float32) mgl32.Vec3 {
+	return rotationMatrix(axis, angle).Mul4x1(v.Vec4(1)).Vec3()
+}
+
+func rotateRandom(v mgl32.Vec3, angle1, angle2, angle3 float32) mgl32.Vec3 {
+	return rotate(rotate(rotate(v, mgl32.Vec3{1, 0, 0}, angle1), mgl32.Vec3{0, 1, 0}, angle2), mgl32.Vec3{0, 0, 1}, angle3)
+}
+
+// hash is one iteration of Bob Jenkins' one at a time hash, as in the shader
+func hash(x uint32) uint32 {
+	x += x << 10
+	x ^= x >> 6
+	x += x << 3
+	x ^= x >> 11
+	x += x << 15
+	return x
+}
+
+// floatConstruct returns a float in [0, 1) made of the low 23 bits of m
+func floatConstruct(m uint32) float32 {
+	const ieeeMantissa = 0x007FFFFF
+	const ieeeOne = 0x3F800000
+	return math.Float32frombits(m&ieeeMantissa|ieeeOne) - 1
+}
+
+// random is rand(float) of the shader, in [-1, 1)
+func random(x float32) float32 {
+	return 2*floatConstruct(hash(math.Float32bits(x))) - 1
+}
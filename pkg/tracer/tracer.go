@@ -0,0 +1,194 @@
+// Package tracer is the path tracer of the compute shader on the CPU, so
+// that renders can be made and compared without a GPU. It follows the
+// trace function of shaders.ComputeSrc step by step, including its camera
+// and random numbers, and renders image tiles on several goroutines.
+package tracer
+
+import (
+	"math"
+	"runtime"
+	"sync"
+
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/supermuesli/computeshader/pkg/bvh"
+	"github.com/supermuesli/computeshader/pkg/objparser"
+	"github.com/supermuesli/computeshader/pkg/scene"
+)
+
+// Renderer configures how images are rendered, the fields are the uniforms
+// of the compute shader
+type Renderer struct {
+	// Width, Height and Hops are taken from scene.DefaultSettings if 0
+	Settings scene.Settings
+	// Camera is where the camera rays start
+	Camera mgl32.Vec3
+	// Cursor is the cursor position in pixels, which turns the camera as
+	// in the window. The center of the image looks along Direction.
+	Cursor mgl32.Vec2
+	// Direction and FOV, the vertical field of view in radians, are taken
+	// from scene.DefaultCamera if they are 0
+	Direction mgl32.Vec3
+	FOV       float32
+	// Workers is the number of goroutines, runtime.NumCPU() if 0
+	Workers int
+	// TileSize is the side of the square tiles the workers take, 32 if 0
+	TileSize int
+}
+
+// New returns a renderer with the camera and settings of sc, looking
+// along the camera direction
+func New(sc *scene.Scene) *Renderer {
+	r := &Renderer{
+		Settings:  sc.Settings,
+		Camera:    sc.Camera.Position,
+		Direction: sc.Camera.LookDirection(),
+		FOV:       sc.Camera.FieldOfView(),
+	}
+	w, h := r.size()
+	r.Cursor = mgl32.Vec2{float32(w) / 2, float32(h) / 2}
+	return r
+}
+
+func (r *Renderer) size() (int, int) {
+	w, h := r.Settings.Width, r.Settings.Height
+	if w <= 0 {
+		w = scene.DefaultSettings.Width
+	}
+	if h <= 0 {
+		h = scene.DefaultSettings.Height
+	}
+	return w, h
+}
+
+// Render renders the instanced scene in with samples paths per pixel, the
+// image the window shows after samples frames
+func (r *Renderer) Render(in *scene.Instanced, samples int) *Image {
+	width, height := r.size()
+	hops := r.Settings.Hops
+	if hops <= 0 {
+		hops = scene.DefaultSettings.Hops
+	}
+	workers := r.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	tileSize := r.TileSize
+	if tileSize <= 0 {
+		tileSize = 32
+	}
+
+	t := &tracer{scene: scaled(in, float32(height)/2), hops: hops}
+
+	img := NewImage(width, height)
+	tiles := make(chan [2]int)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for tile := range tiles {
+				r.renderTile(t, img, tile[0], tile[1], tileSize, samples)
+			}
+		}()
+	}
+	for y := 0; y < height; y += tileSize {
+		for x := 0; x < width; x += tileSize {
+			tiles <- [2]int{x, y}
+		}
+	}
+	close(tiles)
+	wg.Wait()
+	return img
+}
+
+// renderTile renders the tile with the lower left corner x0, y0
+func (r *Renderer) renderTile(t *tracer, img *Image, x0, y0, size, samples int) {
+	v := r.view(img.Width, img.Height)
+	for y := y0; y < y0+size && y < img.Height; y++ {
+		for x := x0; x < x0+size && x < img.Width; x++ {
+			dir := v.dir(x, y)
+			// the running mean of the frames, as the shader keeps it in
+			// the image
+			var pixel mgl32.Vec3
+			for s := 1; s <= samples; s++ {
+				pixel = t.trace(r.Camera, dir, s).Add(pixel.Mul(float32(s - 1))).Mul(1 / float32(s))
+			}
+			img.Pix[y*img.Width+x] = pixel
+		}
+	}
+}
+
+// view is the camera of r for an image of a size, the rays of all pixels
+// start at r.Camera
+type view struct {
+	camera               mgl32.Vec3
+	cursor               mgl32.Vec2
+	width, height        float32
+	distance, pitch, yaw float32
+}
+
+func (r *Renderer) view(width, height int) view {
+	v := view{camera: r.Camera, cursor: r.Cursor, width: float32(width), height: float32(height)}
+	camera := scene.Camera{Direction: r.Direction}
+	look := camera.LookDirection()
+	fov := r.FOV
+	if fov <= 0 {
+		fov = camera.FieldOfView()
+	}
+	v.distance = v.height / 2 / float32(math.Tan(float64(fov/2)))
+	// pitch and yaw of the camera direction, the cursor turns it further
+	v.pitch = -float32(math.Asin(float64(look[1])))
+	v.yaw = float32(math.Atan2(float64(look[0]), float64(-look[2])))
+	return v
+}
+
+// dir is the direction of the ray of the pixel x, y
+func (v *view) dir(x, y int) mgl32.Vec3 {
+	dest := mgl32.Vec3{v.camera[0] - v.width/2 + float32(x), v.camera[1] - v.height/2 + float32(y), v.camera[2] - v.distance}
+	dir := dest.Sub(v.camera).Normalize()
+	return rotate(rotate(dir, mgl32.Vec3{1, 0, 0}, v.pitch+2*v.cursor[1]/v.height-1), mgl32.Vec3{0, 1, 0}, v.yaw+2*v.cursor[0]/v.width-1)
+}
+
+// Render renders sc as it is set up, see New, the way the compute shader
+// renders it
+func Render(sc *scene.Scene, samples int) *Image {
+	return New(sc).Render(sc.Instanced(), samples)
+}
+
+// RenderTriangles renders a triangle soup, like objparser.GetTriangles
+// returns it, without a scene. The triangles are lit by their own
+// Intensity, set up r for the camera.
+func (r *Renderer) RenderTriangles(triangles []objparser.Triangle, samples int) *Image {
+	return r.Render(scene.NewInstanced(triangles), samples)
+}
+
+// scaled returns a copy of in scaled by s. The shader scales the scene by
+// half the height while it traces, here it is scaled once.
+func scaled(in *scene.Instanced, s float32) *scene.Instanced {
+	out := &scene.Instanced{
+		Triangles: make([]objparser.Triangle, len(in.Triangles)),
+		Instances: make([]scene.Instance, len(in.Instances)),
+		Materials: in.Materials,
+		BVH:       &bvh.BVH{Nodes: make([]bvh.Node, len(in.BVH.Nodes)), Indices: in.BVH.Indices},
+		Root:      in.Root,
+	}
+	for i, t := range in.Triangles {
+		t.A = t.A.Vec3().Mul(s).Vec4(t.A[3])
+		t.B = t.B.Vec3().Mul(s).Vec4(t.B[3])
+		t.C = t.C.Vec3().Mul(s).Vec4(t.C[3])
+		out.Triangles[i] = t
+	}
+	for i, n := range in.BVH.Nodes {
+		n.Min, n.Max = n.Min.Mul(s), n.Max.Mul(s)
+		out.BVH.Nodes[i] = n
+	}
+	// scale*(inverse*(origin/scale)) of the shader is a scaled translation
+	for i, inst := range in.Instances {
+		inst.Transform.SetCol(3, inst.Transform.Col(3).Vec3().Mul(s).Vec4(1))
+		inst.Inverse.SetCol(3, inst.Inverse.Col(3).Vec3().Mul(s).Vec4(1))
+		inst.Min = inst.Min.Vec3().Mul(s).Vec4(inst.Min[3])
+		inst.Max = inst.Max.Vec3().Mul(s).Vec4(inst.Max[3])
+		out.Instances[i] = inst
+	}
+	return out
+}
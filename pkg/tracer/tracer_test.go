@@ -0,0 +1,146 @@
+package tracer
+
+import (
+	"flag"
+	"image/png"
+	"os"
+	"testing"
+
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/supermuesli/computeshader/pkg/objparser"
+	"github.com/supermuesli/computeshader/pkg/scene"
+)
+
+var update = flag.Bool("update", false, "write the golden images")
+
+// testScene is the Cornell box with a small copy of itself on the floor in
+// front of the tall block, painted blue by a material override
+func testScene(t *testing.T) *scene.Scene {
+	t.Helper()
+	box, err := objparser.Load("../3dmodels/CornellBox-Original.obj")
+	if err != nil {
+		t.Fatal(err)
+	}
+	blue := append([]objparser.Material{}, box.Materials...)
+	for i := range blue {
+		blue[i].Diffuse = mgl32.Vec3{0.1, 0.2, 0.9}
+	}
+	sc := scene.New()
+	sc.Models = []scene.Model{
+		{Mesh: box, Transform: mgl32.Ident4()},
+		{Mesh: box, Transform: mgl32.Translate3D(-0.5, 0, 0.4).Mul4(mgl32.HomogRotate3DY(0.5)).Mul4(mgl32.Scale3D(0.3, 0.3, 0.3)), Materials: blue},
+	}
+	sc.Settings = scene.Settings{Width: 64, Height: 48, Hops: 3}
+	sc.Camera.Position = mgl32.Vec3{0, 24, 76}
+	return sc
+}
+
+// readImage reads the png file name
+func readImage(t *testing.T, name string) *Image {
+	t.Helper()
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	src, err := png.Decode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := src.Bounds()
+	img := NewImage(b.Dx(), b.Dy())
+	for y := 0; y < img.Height; y++ {
+		for x := 0; x < img.Width; x++ {
+			// rows go up in Image
+			r, g, bl, _ := src.At(b.Min.X+x, b.Max.Y-1-y).RGBA()
+			img.Pix[y*img.Width+x] = mgl32.Vec3{float32(r), float32(g), float32(bl)}.Mul(1.0 / 0xffff)
+		}
+	}
+	return img
+}
+
+// clamped returns img with the channels clamped to [0, 1], as png stores them
+func clamped(img *Image) *Image {
+	out := NewImage(img.Width, img.Height)
+	for i, p := range img.Pix {
+		for k := range p {
+			out.Pix[i][k] = mgl32.Clamp(p[k], 0, 1)
+		}
+	}
+	return out
+}
+
+func TestGolden(t *testing.T) {
+	const golden = "testdata/instanced.png"
+	img := Render(testScene(t), 8)
+	if *update {
+		f, err := os.Create(golden)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := png.Encode(f, img); err != nil {
+			t.Fatal(err)
+		}
+		if err := f.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// fused multiply adds on some platforms move a few paths
+	if d := clamped(img).Diff(readImage(t, golden)); d > 0.01 {
+		t.Errorf("the render differs from %s by %g, run go test -update to accept it", golden, d)
+	}
+
+	// the override paints the pixels the small box is seen in blue
+	sc := testScene(t)
+	sc.Models[1].Materials = nil
+	color, plainColor := boxColor(t, sc, img), boxColor(t, sc, Render(sc, 8))
+	if !blue(color) || blue(plainColor) {
+		t.Errorf("the small box is %v with the override and %v without, want blue only with it", color, plainColor)
+	}
+}
+
+// boxColor returns the summed color of the pixels of img in which the
+// camera sees the second model of sc first
+func boxColor(t *testing.T, sc *scene.Scene, img *Image) mgl32.Vec3 {
+	r := New(sc)
+	tr := &tracer{scene: scaled(sc.Instanced(), float32(img.Height)/2)}
+	v := r.view(img.Width, img.Height)
+	var sum mgl32.Vec3
+	pixels := 0
+	for y := 0; y < img.Height; y++ {
+		for x := 0; x < img.Width; x++ {
+			if _, inst, _, ok := tr.intersect(r.Camera, v.dir(x, y)); ok && inst == 1 {
+				sum = sum.Add(img.Pix[y*img.Width+x])
+				pixels++
+			}
+		}
+	}
+	if pixels == 0 {
+		t.Fatal("the camera does not see the small box")
+	}
+	return sum
+}
+
+func blue(c mgl32.Vec3) bool {
+	return c[2] > 2*c[0] && c[2] > 2*c[1]
+}
+
+func TestRenderTriangles(t *testing.T) {
+	// the soup of a model in place renders like the scene. The random
+	// numbers come from the ray directions, the last bits of a transformed
+	// copy would send the paths elsewhere.
+	sc := testScene(t)
+	sc.Models = sc.Models[:1]
+	want := Render(sc, 8)
+	if d := New(sc).RenderTriangles(sc.Triangles(), 8).Diff(want); d != 0 {
+		t.Errorf("the triangles render %g away from the scene", d)
+	}
+
+	// and the zero Renderer renders with the defaults
+	var r Renderer
+	r.Settings = scene.Settings{Width: 16, Height: 12, Hops: 1}
+	if img := r.RenderTriangles(nil, 1); img.Width != 16 || img.Height != 12 {
+		t.Errorf("got a %dx%d image, want 16x12", img.Width, img.Height)
+	}
+}
@@ -0,0 +1,162 @@
+package triangulate
+
+import (
+	"errors"
+	"math"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// ErrDegenerate is returned for polygons with less than three corners, no
+// area or self intersections that leave no ear to clip
+var ErrDegenerate = errors.New("degenerate polygon")
+
+// Polygon triangulates a planar, convex or concave polygon given by its
+// corners in order. It returns index triples into points that keep the
+// winding of the input.
+func Polygon(points []mgl32.Vec3) ([][3]int, error) {
+	n := len(points)
+	if n < 3 {
+		return nil, ErrDegenerate
+	}
+
+	pts, ok := project(points)
+	if !ok {
+		return nil, ErrDegenerate
+	}
+	if n == 3 {
+		return [][3]int{{0, 1, 2}}, nil
+	}
+
+	// tolerance for "zero" areas, relative to the size of the polygon
+	eps := 1e-12 * extent(pts) * extent(pts)
+
+	remaining := make([]int, n)
+	for i := range remaining {
+		remaining[i] = i
+	}
+
+	tris := make([][3]int, 0, n-2)
+	for len(remaining) > 3 {
+		if ear := findEar(pts, remaining, eps); ear >= 0 {
+			tris = append(tris, corners(remaining, ear))
+			remaining = append(remaining[:ear], remaining[ear+1:]...)
+			continue
+		}
+		// collinear corners are only dropped if there is no ear left, they
+		// would leave t-junctions and fewer than n-2 triangles otherwise
+		flat := -1
+		for i := range remaining {
+			c := corners(remaining, i)
+			if math.Abs(cross(pts[c[0]], pts[c[1]], pts[c[2]])) <= eps {
+				flat = i
+				break
+			}
+		}
+		if flat < 0 {
+			return nil, ErrDegenerate
+		}
+		remaining = append(remaining[:flat], remaining[flat+1:]...)
+	}
+
+	if cross(pts[remaining[0]], pts[remaining[1]], pts[remaining[2]]) > eps {
+		tris = append(tris, [3]int{remaining[0], remaining[1], remaining[2]})
+	}
+	if len(tris) == 0 {
+		return nil, ErrDegenerate
+	}
+
+	return tris, nil
+}
+
+// findEar returns the position in remaining of a convex corner whose
+// triangle has an area and no other corner in it, -1 if there is none
+func findEar(pts []point, remaining []int, eps float64) int {
+	for k := range remaining {
+		// start at corner 1 so that convex polygons come out as a fan around corner 0
+		i := (k + 1) % len(remaining)
+		c := corners(remaining, i)
+		if cross(pts[c[0]], pts[c[1]], pts[c[2]]) > eps && !containsAny(pts, remaining, c[0], c[1], c[2]) {
+			return i
+		}
+	}
+	return -1
+}
+
+// corners returns the corner at position i of remaining with its neighbours
+func corners(remaining []int, i int) [3]int {
+	n := len(remaining)
+	return [3]int{remaining[(i+n-1)%n], remaining[i], remaining[(i+1)%n]}
+}
+
+type point struct {
+	x, y float64
+}
+
+// project drops the dominant axis of the polygon normal so that the
+// resulting 2d polygon is wound counter clockwise
+func project(points []mgl32.Vec3) ([]point, bool) {
+	// newell's method, robust for concave and slightly non-planar polygons
+	var nx, ny, nz float64
+	for i := range points {
+		a, b := points[i], points[(i+1)%len(points)]
+		nx += float64(a[1]-b[1]) * float64(a[2]+b[2])
+		ny += float64(a[2]-b[2]) * float64(a[0]+b[0])
+		nz += float64(a[0]-b[0]) * float64(a[1]+b[1])
+	}
+
+	// u and v are the kept axes, in cyclic order after the dropped one
+	u, v, sign := 1, 2, nx
+	if math.Abs(ny) > math.Abs(nx) && math.Abs(ny) >= math.Abs(nz) {
+		u, v, sign = 2, 0, ny
+	} else if math.Abs(nz) > math.Abs(nx) && math.Abs(nz) > math.Abs(ny) {
+		u, v, sign = 0, 1, nz
+	}
+	if sign < 0 {
+		u, v = v, u
+	}
+
+	pts := make([]point, len(points))
+	for i, p := range points {
+		pts[i] = point{float64(p[u]), float64(p[v])}
+	}
+
+	area := 0.0
+	for i := range pts {
+		a, b := pts[i], pts[(i+1)%len(pts)]
+		area += a.x*b.y - b.x*a.y
+	}
+	return pts, area > 1e-12*extent(pts)*extent(pts)
+}
+
+func extent(pts []point) float64 {
+	minX, minY, maxX, maxY := pts[0].x, pts[0].y, pts[0].x, pts[0].y
+	for _, p := range pts[1:] {
+		minX, maxX = math.Min(minX, p.x), math.Max(maxX, p.x)
+		minY, maxY = math.Min(minY, p.y), math.Max(maxY, p.y)
+	}
+	return math.Max(maxX-minX, maxY-minY)
+}
+
+// cross is twice the signed area of the triangle a b c
+func cross(a, b, c point) float64 {
+	return (b.x-a.x)*(c.y-a.y) - (b.y-a.y)*(c.x-a.x)
+}
+
+// containsAny reports whether a remaining corner other than a, b and c lies
+// inside or on the border of the triangle a b c
+func containsAny(pts []point, remaining []int, a, b, c int) bool {
+	for _, i := range remaining {
+		if i == a || i == b || i == c {
+			continue
+		}
+		p := pts[i]
+		if p == pts[a] || p == pts[b] || p == pts[c] {
+			continue
+		}
+		if cross(pts[a], pts[b], p) >= 0 && cross(pts[b], pts[c], p) >= 0 && cross(pts[c], pts[a], p) >= 0 {
+			return true
+		}
+	}
+	return false
+}
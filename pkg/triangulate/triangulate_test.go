@@ -0,0 +1,135 @@
+package triangulate
+
+import (
+	"math"
+	"testing"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// xy returns the points of a polygon in the xy plane
+func xy(coords ...float32) []mgl32.Vec3 {
+	out := make([]mgl32.Vec3, len(coords)/2)
+	for i := range out {
+		out[i] = mgl32.Vec3{coords[2*i], coords[2*i+1], 0}
+	}
+	return out
+}
+
+// transform returns points transformed by m
+func transform(m mgl32.Mat4, points []mgl32.Vec3) []mgl32.Vec3 {
+	out := make([]mgl32.Vec3, len(points))
+	for i, p := range points {
+		out[i] = mgl32.TransformCoordinate(p, m)
+	}
+	return out
+}
+
+func reverse(points []mgl32.Vec3) []mgl32.Vec3 {
+	out := make([]mgl32.Vec3, len(points))
+	for i, p := range points {
+		out[len(points)-1-i] = p
+	}
+	return out
+}
+
+// normal is the area weighted normal of a polygon, its length is the area
+func normal(points []mgl32.Vec3) mgl32.Vec3 {
+	var n mgl32.Vec3
+	for i := range points {
+		n = n.Add(points[i].Cross(points[(i+1)%len(points)]))
+	}
+	return n.Mul(0.5)
+}
+
+var (
+	square = xy(0, 0, 1, 0, 1, 1, 0, 1)
+	// an L with the reflex corner at 1 1
+	lShape = xy(0, 0, 2, 0, 2, 1, 1, 1, 1, 2, 0, 2)
+	// a five pointed star, every other corner is reflex
+	star = func() []mgl32.Vec3 {
+		out := []mgl32.Vec3{}
+		for i := 0; i < 10; i++ {
+			r := 1.0
+			if i%2 == 1 {
+				r = 0.4
+			}
+			a := float64(i) * math.Pi / 5
+			out = append(out, mgl32.Vec3{float32(r * math.Cos(a)), float32(r * math.Sin(a)), 0})
+		}
+		return out
+	}()
+)
+
+func TestPolygon(t *testing.T) {
+	tilt := mgl32.Translate3D(3, -2, 5).Mul4(mgl32.HomogRotate3D(0.7, mgl32.Vec3{1, 2, 3}.Normalize()))
+	tests := []struct {
+		name   string
+		points []mgl32.Vec3
+	}{
+		{"triangle", xy(0, 0, 1, 0, 0, 1)},
+		{"square", square},
+		{"pentagon", xy(0, 0, 2, 0, 3, 1.5, 1, 3, -1, 1.5)},
+		{"l shape", lShape},
+		{"star", star},
+		{"collinear corner", xy(0, 0, 1, 0, 2, 0, 2, 1, 0, 1)},
+		{"collinear corners", xy(0, 0, 1, 0, 2, 0, 2, 1, 2, 2, 1, 2, 0, 2, 0, 1)},
+		{"reversed square", reverse(square)},
+		{"reversed l shape", reverse(lShape)},
+		{"reversed star", reverse(star)},
+		{"yz plane", transform(mgl32.HomogRotate3DY(math.Pi/2), lShape)},
+		{"xz plane", transform(mgl32.HomogRotate3DX(math.Pi/2), lShape)},
+		{"tilted", transform(tilt, star)},
+		{"tilted reversed", transform(tilt, reverse(lShape))},
+	}
+	for _, tt := range tests {
+		tris, err := Polygon(tt.points)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if len(tris) != len(tt.points)-2 {
+			t.Errorf("%s: got %d triangles, want %d", tt.name, len(tris), len(tt.points)-2)
+		}
+
+		// the triangles cover the polygon with its winding
+		want := normal(tt.points)
+		var sum mgl32.Vec3
+		for _, tri := range tris {
+			for _, i := range tri {
+				if i < 0 || i >= len(tt.points) {
+					t.Fatalf("%s: got triangle %v for %d points", tt.name, tri, len(tt.points))
+				}
+			}
+			n := normal([]mgl32.Vec3{tt.points[tri[0]], tt.points[tri[1]], tt.points[tri[2]]})
+			if n.Dot(want) <= 0 {
+				t.Errorf("%s: triangle %v is wound against the polygon", tt.name, tri)
+			}
+			sum = sum.Add(n)
+		}
+		if math.Abs(float64(sum.Len()-want.Len())) > 1e-4*float64(want.Len()) {
+			t.Errorf("%s: got area %v, want %v", tt.name, sum.Len(), want.Len())
+		}
+	}
+}
+
+func TestPolygonDegenerate(t *testing.T) {
+	tests := []struct {
+		name   string
+		points []mgl32.Vec3
+	}{
+		{"empty", nil},
+		{"two points", xy(0, 0, 1, 0)},
+		{"line", xy(0, 0, 1, 0, 2, 0)},
+		{"flat quad", xy(0, 0, 1, 0, 3, 0, 2, 0)},
+		{"repeated point", xy(1, 1, 1, 1, 1, 1, 1, 1)},
+		{"repeated corner", xy(0, 0, 1, 0, 1, 0)},
+		{"there and back", xy(0, 0, 1, 1, 0, 0, 1, 1)},
+		{"zero area bow tie", xy(0, 0, 1, 1, 1, 0, 0, 1)},
+	}
+	for _, tt := range tests {
+		if tris, err := Polygon(tt.points); err != ErrDegenerate {
+			t.Errorf("%s: got %v, %v, want ErrDegenerate", tt.name, tris, err)
+		}
+	}
+}